@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/woodyDM/simple-block-chain/internal/api"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func runCli(t *testing.T, code int, args ...string) string {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	if r := run(args, stdout, stderr); r != code {
+		t.Fatal(args, "exit", r, stderr.String())
+	}
+	return stdout.String()
+}
+
+func TestCli(t *testing.T) {
+	pool := core.NewTxPool(core.Genesis(core.Env))
+	s := api.NewServer(pool)
+	s.Miner = core.NewMiner(pool, core.GetTestWallet(9))
+	s.Regtest = true
+	s.Wallet = core.NewWalletTracker(pool, nil)
+	s.Wallet.Start()
+	defer s.Wallet.Stop()
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	walletPath := filepath.Join(dir, "wallet.json")
+	core.KeystoreScryptN = 1 << 10
+	k, err := core.CreateKeystore(walletPath, "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = k.Unlock("pass", 0)
+	if err = k.Add(core.GetTestWallet(0)); err != nil {
+		t.Fatal(err)
+	}
+	s.Auth = api.NewAuth()
+	//测试在一秒内发送大量请求，不限流
+	s.Auth.Burst = 1000
+	cookiePath := filepath.Join(dir, ".cookie")
+	if err = s.Auth.WriteCookie(cookiePath); err != nil {
+		t.Fatal(err)
+	}
+	flags := []string{"-node", ts.URL, "-wallet", walletPath, "-rpccookiefile", cookiePath, "-passphrase", "pass"}
+	cmd := func(code int, args ...string) string {
+		return runCli(t, code, append(append([]string{}, flags...), args...)...)
+	}
+	jsonCmd := func(v interface{}, args ...string) {
+		out := cmd(0, append([]string{"-format", "json"}, args...)...)
+		if err := json.Unmarshal([]byte(out), v); err != nil {
+			t.Fatal(out, err)
+		}
+	}
+
+	out := cmd(0, "newaddress")
+	addr := strings.TrimSpace(strings.TrimPrefix(out, "Address"))
+	if _, err = core.AddressToRipemd160PubKey(addr); err != nil {
+		t.Fatal("new address", out)
+	}
+	addrs := make(map[string][]string)
+	jsonCmd(&addrs, "addresses")
+	if len(addrs["Addresses"]) != 2 || addrs["Addresses"][1] != addr {
+		t.Fatal("wallet file")
+	}
+	//钱包中有两个地址时必须指定 -from
+	cmd(1, "send", addr, "10")
+	from := core.GetTestWallet(0).Address()
+	signed := make(map[string]string)
+	jsonCmd(&signed, "-from", addr, "signmessage", "hello")
+	if out = cmd(0, "verifymessage", addr, signed["Signature"], "hello"); !strings.Contains(out, "true") {
+		t.Fatal("verifymessage", out)
+	}
+	cmd(1, "verifymessage", from, signed["Signature"], "hello")
+	txId := make(map[string]string)
+	jsonCmd(&txId, "-from", from, "send", addr, "10")
+	jsonCmd(new(map[string][]string), "mine", "1")
+
+	balance := new(api.BalanceResponse)
+	jsonCmd(balance, "balance", addr)
+	if balance.Balance != 10 {
+		t.Fatal("balance", balance.Balance)
+	}
+	//bech32 写法查询到同一个地址
+	jsonCmd(balance, "balance", convertAddress(t, addr)["Bech32"])
+	if balance.Balance != 10 || balance.Address != addr {
+		t.Fatal("bech32 balance", balance)
+	}
+	utxos := make([]*core.Utxo, 0)
+	jsonCmd(&utxos, "listunspent", from)
+	if len(utxos) != 1 || utxos[0].Fee != core.GenesisCoinCount-10 {
+		t.Fatal("change utxo")
+	}
+	tx := new(core.Transaction)
+	jsonCmd(tx, "gettx", txId["TxId"])
+	if tx.BlockHash == "" {
+		t.Fatal("tx should be mined")
+	}
+	if out = cmd(0, "getblock", "1"); !strings.Contains(out, txId["TxId"]) || !strings.Contains(out, tx.BlockHash) {
+		t.Fatal("getblock", out)
+	}
+	raw, _ := core.EncodeRawTx(tx)
+	if out = cmd(0, "decodetx", raw); !strings.Contains(out, "OP_CHECKSIG") {
+		t.Fatal("decodetx", out)
+	}
+	if out = cmd(0, "peers"); !strings.HasPrefix(out, "ADDR") {
+		t.Fatal("peers", out)
+	}
+	cmd(1, "gettx", "00")
+	//一笔交易支付多个地址
+	to2 := core.GetTestWallet(2).Address()
+	csvPath := filepath.Join(dir, "payouts.csv")
+	_ = ioutil.WriteFile(csvPath, []byte("address,amount\n"+addr+",3\n# comment\n"+to2+", 4\n"), 0600)
+	jsonCmd(&txId, "-from", from, "-fee", "1", "sendmany", csvPath)
+	jsonCmd(new(map[string][]string), "mine", "1")
+	batch := new(core.Transaction)
+	jsonCmd(batch, "gettx", txId["TxId"])
+	if len(batch.Outputs) != 3 || batch.Outputs[1].Address != addr || batch.Outputs[2].Fee != 4 {
+		t.Fatal("sendmany outputs")
+	}
+	//只读节点构建交易，另一个 keystore 离线签名
+	offline := filepath.Join(dir, "offline.json")
+	offKs, _ := core.CreateKeystore(offline, "pass")
+	_ = offKs.Unlock("pass", 0)
+	_ = offKs.Add(core.GetTestWallet(3))
+	psbt := make(map[string]string)
+	jsonCmd(&psbt, "-from", core.GetTestWallet(3).Address(), "createpsbt", addr, "5")
+	unsigned := psbt["Psbt"]
+	cmd(1, "signpsbt", unsigned)
+	jsonCmd(&psbt, "-wallet", offline, "signpsbt", unsigned)
+	jsonCmd(&psbt, "combinepsbt", unsigned, psbt["Psbt"])
+	cmd(1, "finalizepsbt", unsigned)
+	rawTx := make(map[string]string)
+	jsonCmd(&rawTx, "finalizepsbt", psbt["Psbt"])
+	jsonCmd(&txId, "sendrawtx", rawTx["Hex"])
+	cmd(2, "combinepsbt", unsigned)
+	//2-of-2 多重签名的两个私钥都在 keystore 中，signpsbt 一次签完
+	multi := make(map[string]string)
+	jsonCmd(&multi, "createmultisig", "2", from, addr)
+	jsonCmd(&txId, "-from", from, "-fee", "1", "send", multi["Address"], "6")
+	jsonCmd(new(map[string][]string), "mine", "1")
+	jsonCmd(&psbt, "-from", multi["Address"], "createpsbt", to2, "2")
+	jsonCmd(&psbt, "signpsbt", psbt["Psbt"])
+	jsonCmd(&rawTx, "finalizepsbt", psbt["Psbt"])
+	jsonCmd(&txId, "sendrawtx", rawTx["Hex"])
+	jsonCmd(new(map[string][]string), "mine", "1")
+	jsonCmd(balance, "balance", multi["Address"])
+	if balance.Balance != 4 {
+		t.Fatal("multisig balance", balance.Balance)
+	}
+	//同一个多重签名的 P2SH 地址，花费时提供赎回脚本
+	jsonCmd(&txId, "-from", from, "-fee", "1", "send", multi["P2SH"], "6")
+	jsonCmd(new(map[string][]string), "mine", "1")
+	cmd(1, "-from", multi["P2SH"], "-redeemscript", "0102", "createpsbt", to2, "2")
+	jsonCmd(&psbt, "-from", multi["P2SH"], "-redeemscript", multi["RedeemScript"], "createpsbt", to2, "2")
+	jsonCmd(&psbt, "signpsbt", psbt["Psbt"])
+	jsonCmd(&rawTx, "finalizepsbt", psbt["Psbt"])
+	jsonCmd(&txId, "sendrawtx", rawTx["Hex"])
+	jsonCmd(new(map[string][]string), "mine", "1")
+	jsonCmd(balance, "balance", multi["P2SH"])
+	if balance.Balance != 4 {
+		t.Fatal("P2SH balance", balance.Balance)
+	}
+	//有时间锁的 P2SH 地址，下一个区块之后才能花费
+	tip := new(core.Block)
+	jsonCmd(tip, "getblock", "tip")
+	lockTime := strconv.FormatUint(tip.Height+2, 10)
+	lock := make(map[string]string)
+	jsonCmd(&lock, "createtimelock", lockTime, from)
+	cmd(1, "createtimelock", "x", from)
+	jsonCmd(&txId, "-from", from, "-fee", "1", "send", lock["P2SH"], "6")
+	jsonCmd(new(map[string][]string), "mine", "1")
+	jsonCmd(&psbt, "-from", lock["P2SH"], "-redeemscript", lock["RedeemScript"], "createpsbt", to2, "2")
+	jsonCmd(&psbt, "signpsbt", psbt["Psbt"])
+	cmd(1, "finalizepsbt", psbt["Psbt"])
+	jsonCmd(&psbt, "-from", lock["P2SH"], "-redeemscript", lock["RedeemScript"], "-locktime", lockTime, "createpsbt", to2, "2")
+	jsonCmd(&psbt, "signpsbt", psbt["Psbt"])
+	jsonCmd(&rawTx, "finalizepsbt", psbt["Psbt"])
+	cmd(1, "sendrawtx", rawTx["Hex"])
+	jsonCmd(new(map[string][]string), "mine", "1")
+	jsonCmd(&txId, "sendrawtx", rawTx["Hex"])
+	cmd(1, "createmultisig", "3", from, addr)
+	_ = ioutil.WriteFile(csvPath, []byte(addr+",3\n"+addr+",4\n"), 0600)
+	cmd(1, "-from", from, "sendmany", csvPath)
+	_ = ioutil.WriteFile(csvPath, []byte(addr+",x\n"), 0600)
+	cmd(1, "-from", from, "sendmany", csvPath)
+	//修改口令后旧口令不能再转账
+	cmd(0, "-newpassphrase", "new", "changepassphrase")
+	cmd(1, "-from", from, "send", addr, "1")
+	cmd(0, "-passphrase", "new", "-from", from, "send", addr, "1")
+	//导出的私钥导入另一个 keystore，只读地址可以查询余额但不能签名
+	wif := make(map[string]string)
+	jsonCmd(&wif, "-passphrase", "new", "dumpprivkey", from)
+	imported := filepath.Join(dir, "imported.json")
+	cmd(0, "-wallet", imported, "importprivkey", wif["WIF"])
+	cmd(1, "-wallet", imported, "importprivkey", "abc")
+	watch := core.GetTestWallet(5)
+	cmd(0, "-wallet", imported, "importaddress", watch.Bech32Address())
+	cmd(1, "-wallet", imported, "-from", watch.Address(), "signmessage", "x")
+	balances := &struct {
+		Addresses []*walletBalance
+		Total     int64
+	}{}
+	jsonCmd(balances, "-wallet", imported, "walletbalance")
+	if len(balances.Addresses) != 2 || balances.Addresses[0].Address != from || !balances.Addresses[1].WatchOnly ||
+		balances.Addresses[1].Balance != core.GenesisCoinCount || balances.Total != balances.Addresses[0].Balance+core.GenesisCoinCount {
+		t.Fatal("walletbalance", balances)
+	}
+	//节点跟踪 keystore 中的地址，未确认的转账计入 Unconfirmed
+	info := &struct {
+		Balance *core.WalletBalance
+		History []*core.WalletTx
+	}{}
+	jsonCmd(info, "-wallet", imported, "walletinfo")
+	if info.Balance.Confirmed < core.GenesisCoinCount || info.Balance.Unconfirmed == 0 || len(info.History) == 0 ||
+		info.History[0].Confirmations != 0 {
+		t.Fatal("walletinfo", info.Balance)
+	}
+	cmd(1, "-rpcuser", "nobody", "-rpcpassword", "x", "peers")
+	cmd(2, "nope")
+	cmd(2, "getblock")
+	cmd(2, "-format", "xml", "peers")
+	cmd(2, "-coinselect", "nope", "peers")
+	s.Regtest = false
+	cmd(1, "mine", "1")
+}
+
+func TestCli_Restore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	core.KeystoreScryptN = 1 << 10
+	flags := []string{"-passphrase", "pass", "-format", "json"}
+	m := make(map[string]string)
+	if err = json.Unmarshal([]byte(runCli(t, 0, append(flags, "mnemonic")...)), &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(strings.Fields(m["Mnemonic"])) != 24 || !core.IsMnemonicValid(m["Mnemonic"]) {
+		t.Fatal("mnemonic", m)
+	}
+	//两个钱包文件从同一助记词恢复出相同的地址
+	restore := func(name string) []string {
+		r := make(map[string][]string)
+		out := runCli(t, 0, append(flags, "-wallet", filepath.Join(dir, name), "restore", m["Mnemonic"], "3")...)
+		if err := json.Unmarshal([]byte(out), &r); err != nil {
+			t.Fatal(out, err)
+		}
+		return r["Addresses"]
+	}
+	a, b := restore("a.json"), restore("b.json")
+	if len(a) != 3 || strings.Join(a, ",") != strings.Join(b, ",") || a[0] == a[1] {
+		t.Fatal("restored addresses", a, b)
+	}
+	runCli(t, 1, append(flags, "-wallet", filepath.Join(dir, "c.json"), "restore", "abandon abandon", "3")...)
+}
+
+func convertAddress(t *testing.T, addr string) map[string]string {
+	m := make(map[string]string)
+	out := runCli(t, 0, "-format", "json", "convertaddress", addr)
+	if err := json.Unmarshal([]byte(out), &m); err != nil {
+		t.Fatal(out, err)
+	}
+	return m
+}
+
+func TestCli_ConvertAddress(t *testing.T) {
+	w := core.GetTestWallet(3)
+	b := convertAddress(t, w.Address())["Bech32"]
+	if b != w.Bech32Address() || convertAddress(t, b)["Address"] != w.Address() {
+		t.Fatal("convert", b)
+	}
+	//输入错误时标出出错的字符
+	typo := []byte(b)
+	typo[8] = 'q'
+	if typo[8] == b[8] {
+		typo[8] = 'p'
+	}
+	stderr := new(bytes.Buffer)
+	if run([]string{"convertaddress", string(typo)}, new(bytes.Buffer), stderr) != 1 {
+		t.Fatal("typo accepted")
+	}
+	if lines := strings.Split(strings.TrimSpace(stderr.String()), "\n"); lines[len(lines)-1] != strings.Repeat(" ", 8)+"^" {
+		t.Fatal(stderr.String())
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/woodyDM/simple-block-chain/internal/api"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//节点 HTTP 接口的客户端
+type client struct {
+	base string
+	http *http.Client
+	//HTTP Basic 认证，user 为空时不认证
+	user     string
+	password string
+}
+
+func newClient(base string) *client {
+	return &client{
+		base: strings.TrimRight(base, "/"),
+		http: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *client) get(path string, v interface{}) error {
+	return c.do("GET", path, nil, v)
+}
+
+func (c *client) post(path string, body, v interface{}) error {
+	return c.do("POST", path, body, v)
+}
+
+func (c *client) do(method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.base+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := new(api.ErrorResponse)
+		if json.Unmarshal(b, e) == nil && e.Error != "" {
+			return fmt.Errorf("%s (HTTP %d)", e.Error, resp.StatusCode)
+		}
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(b, v)
+}
+
+//区块可以用 hash、高度 或 tip 指定
+func (c *client) block(id string) (*core.Block, error) {
+	b := new(core.Block)
+	path := "/blocks/" + id
+	if isHeight(id) {
+		path = "/blocks/height/" + id
+	}
+	return b, c.get(path, b)
+}
+
+func (c *client) tx(hash string) (*core.Transaction, error) {
+	t := new(core.Transaction)
+	return t, c.get("/tx/"+hash, t)
+}
+
+func (c *client) utxos(addr string) ([]*core.Utxo, error) {
+	r := make([]*core.Utxo, 0)
+	return r, c.get("/address/"+addr+"/utxos", &r)
+}
+
+func (c *client) balance(addr string) (*api.BalanceResponse, error) {
+	r := new(api.BalanceResponse)
+	return r, c.get("/address/"+addr+"/balance", r)
+}
+
+func (c *client) feeEstimate(target int) (*api.FeeEstimateResponse, error) {
+	r := new(api.FeeEstimateResponse)
+	return r, c.get("/fee/estimate?target="+strconv.Itoa(target), r)
+}
+
+//加入节点钱包跟踪的地址
+func (c *client) watch(addr string) error {
+	return c.post("/wallet/addresses", &api.WatchAddressRequest{Address: addr}, new(api.WalletAddressesResponse))
+}
+
+func (c *client) walletBalance() (*core.WalletBalance, error) {
+	r := new(core.WalletBalance)
+	return r, c.get("/wallet/balance", r)
+}
+
+func (c *client) walletHistory() ([]*core.WalletTx, error) {
+	r := make([]*core.WalletTx, 0)
+	return r, c.get("/wallet/history", &r)
+}
+
+func (c *client) submit(tx *core.Transaction) (string, error) {
+	raw, err := core.EncodeRawTx(tx)
+	if err != nil {
+		return "", err
+	}
+	r := new(api.TxIdResponse)
+	return r.Hash, c.post("/tx", &api.RawTxRequest{Hex: raw}, r)
+}
+
+func isHeight(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, it := range s {
+		if it < '0' || it > '9' {
+			return false
+		}
+	}
+	return true
+}
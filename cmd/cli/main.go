@@ -0,0 +1,723 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/woodyDM/simple-block-chain/internal/api"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"github.com/woodyDM/simple-block-chain/internal/p2p"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==================================== CLI ====================================
+// 通过节点的 HTTP 接口查询和转账，交易在本地签名后提交
+// cli [flags] <command> [args]
+
+type cli struct {
+	node   *client
+	out    *printer
+	wallet string
+	from   string
+	extra  string
+	//交易手续费和选择输入的策略
+	fee      int64
+	selector core.CoinSelector
+	//花费 P2SH 地址时的赎回脚本 hex
+	redeemScript string
+	//交易的 LockTime 和输入的 Sequence
+	lockTime int64
+	sequence uint32
+	//keystore 口令
+	passphrase    string
+	newPassphrase string
+}
+
+type command struct {
+	usage string
+	//参数个数，为负数时表示至少 -args 个
+	args int
+	run  func(c *cli, args []string) error
+}
+
+var commands = map[string]*command{
+	"getblock":         {"<hash|height|tip>", 1, (*cli).getBlock},
+	"gettx":            {"<txid>", 1, (*cli).getTx},
+	"balance":          {"<address>", 1, (*cli).balance},
+	"listunspent":      {"<address>", 1, (*cli).listUnspent},
+	"send":             {"<to> <amount>", 2, (*cli).send},
+	"sendmany":         {"<csv file of address,amount>", 1, (*cli).sendMany},
+	"createpsbt":       {"<to> <amount>  (-from address, -redeemscript for P2SH, no keystore needed)", 2, (*cli).createPsbt},
+	"signpsbt":         {"<psbt>", 1, (*cli).signPsbt},
+	"combinepsbt":      {"<psbt> <psbt>...", -2, (*cli).combinePsbt},
+	"finalizepsbt":     {"<psbt>", 1, (*cli).finalizePsbt},
+	"sendrawtx":        {"<hex>", 1, (*cli).sendRawTx},
+	"newaddress":       {"", 0, (*cli).newAddress},
+	"addresses":        {"", 0, (*cli).addresses},
+	"convertaddress":   {"<address>", 1, (*cli).convertAddress},
+	"importprivkey":    {"<wif>", 1, (*cli).importPrivKey},
+	"dumpprivkey":      {"<address>", 1, (*cli).dumpPrivKey},
+	"importaddress":    {"<address|pubkey>  (watch-only)", 1, (*cli).importAddress},
+	"createmultisig":   {"<m> <pubkey|address>...  (addresses from keystore)", -2, (*cli).createMultiSig},
+	"createtimelock":   {"<locktime|+sequence> <address>  (P2SH address spendable after the lock)", 2, (*cli).createTimeLock},
+	"walletbalance":    {"", 0, (*cli).walletBalance},
+	"walletinfo":       {"(node tracks keystore addresses, shows confirmed and pending balance)", 0, (*cli).walletInfo},
+	"signmessage":      {"<message>", 1, (*cli).signMessage},
+	"verifymessage":    {"<address> <signature> <message>", 3, (*cli).verifyMessage},
+	"changepassphrase": {"", 0, (*cli).changePassphrase},
+	"mnemonic":         {"", 0, (*cli).mnemonic},
+	"restore":          {"\"<mnemonic>\" <count>", 2, (*cli).restore},
+	"decodetx":         {"<hex>", 1, (*cli).decodeTx},
+	"mine":             {"<n>  (regtest only)", 1, (*cli).mine},
+	"peers":            {"", 0, (*cli).peers},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(argv []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("cli", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	node := fs.String("node", "http://127.0.0.1:8080", "node HTTP api address")
+	format := fs.String("format", formatTable, "output format: table or json")
+	wallet := fs.String("wallet", "wallet.json", "encrypted keystore file")
+	pass := fs.String("passphrase", "", "keystore passphrase, or set "+envPassphrase)
+	newPass := fs.String("newpassphrase", "", "new passphrase for changepassphrase, or set "+envNewPassphrase)
+	from := fs.String("from", "", "address to send from, required when wallet has more than one address")
+	extra := fs.String("extra", "", "extra data of the transaction")
+	redeem := fs.String("redeemscript", "", "redeem script hex of the -from P2SH address for createpsbt")
+	lockTime := fs.Int64("locktime", 0, "lock time of the transaction, a block height or a unix time")
+	sequence := fs.Uint64("sequence", 0, "sequence of every input, for relative lock time")
+	fee := fs.Int64("fee", -1, "transaction fee paid to the miner, -1 to pay the fee rate estimated by the node")
+	coinSelect := fs.String("coinselect", core.CoinSelectDefault, "coin selection: default, largest, smallest, bnb or random")
+	user := fs.String("rpcuser", "", "HTTP api user")
+	password := fs.String("rpcpassword", "", "HTTP api password")
+	cookie := fs.String("rpccookiefile", ".cookie", "cookie file of the node, used when -rpcuser is empty")
+	netName := fs.String("net", core.MainNetParams.Name, "network of the node: main, test or regtest")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: cli [flags] <command> [args]")
+		fmt.Fprintln(stderr, "Commands:")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(stderr, "  "+name+" "+commands[name].usage)
+		}
+		fmt.Fprintln(stderr, "Flags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(argv); err != nil {
+		return 2
+	}
+	if *format != formatTable && *format != formatJson {
+		fmt.Fprintln(stderr, "invalid format", *format)
+		return 2
+	}
+	selector, err := core.ParseCoinSelector(*coinSelect)
+	if err != nil || *fee < -1 {
+		fmt.Fprintln(stderr, "invalid -coinselect or -fee")
+		return 2
+	}
+	if *lockTime < 0 || *sequence > math.MaxUint32 {
+		fmt.Fprintln(stderr, "invalid -locktime or -sequence")
+		return 2
+	}
+	net, err := core.ParseNet(*netName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	//地址版本随网络不同
+	core.SetActiveNet(net)
+	args := fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok || (cmd.args >= 0 && len(args)-1 != cmd.args) || len(args)-1 < -cmd.args {
+		fs.Usage()
+		return 2
+	}
+	nc := newClient(*node)
+	nc.user, nc.password = *user, *password
+	if nc.user == "" && *cookie != "" {
+		//cookie 文件不存在时不认证
+		if u, p, err := api.ReadCookie(*cookie); err == nil {
+			nc.user, nc.password = u, p
+		}
+	}
+	c := &cli{
+		node:   nc,
+		out:    &printer{w: stdout, json: *format == formatJson},
+		wallet: *wallet,
+		from:   *from,
+		extra:  *extra,
+
+		fee:           *fee,
+		selector:      selector,
+		redeemScript:  *redeem,
+		lockTime:      *lockTime,
+		sequence:      uint32(*sequence),
+		passphrase:    *pass,
+		newPassphrase: *newPass,
+	}
+	if err := cmd.run(c, args[1:]); err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+func (c *cli) getBlock(args []string) error {
+	b, err := c.node.block(args[0])
+	if err != nil {
+		return err
+	}
+	return c.out.block(b)
+}
+
+func (c *cli) getTx(args []string) error {
+	tx, err := c.node.tx(args[0])
+	if err != nil {
+		return err
+	}
+	return c.out.tx(tx)
+}
+
+func (c *cli) balance(args []string) error {
+	r, err := c.node.balance(args[0])
+	if err != nil {
+		return err
+	}
+	return c.out.balance(r)
+}
+
+func (c *cli) listUnspent(args []string) error {
+	us, err := c.node.utxos(args[0])
+	if err != nil {
+		return err
+	}
+	return c.out.utxos(us)
+}
+
+func (c *cli) send(args []string) error {
+	to := args[0]
+	if _, err := core.CanonicalAddress(to); err != nil {
+		return err
+	}
+	amount, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || amount <= 0 {
+		return fmt.Errorf("invalid amount %s", args[1])
+	}
+	return c.pay([]*core.Recipient{{Address: to, Amount: amount}})
+}
+
+//从 csv 文件读取 address,amount，在一笔交易中全部支付
+func (c *cli) sendMany(args []string) error {
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rs, err := readPayouts(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", args[0], err)
+	}
+	return c.pay(rs)
+}
+
+//在本地签名后提交
+func (c *cli) pay(rs []*core.Recipient) error {
+	k, err := c.unlock(false)
+	if err != nil {
+		return err
+	}
+	defer k.Lock()
+	w, err := findWallet(k, c.from)
+	if err != nil {
+		return err
+	}
+	req := w.RequestMany(rs, c.extra)
+	req.LockTime, req.Sequence = c.lockTime, c.sequence
+	selectInputs := func(target int64) ([]*core.Output, error) {
+		return c.selectInputs(w.Address(), target)
+	}
+	tx, err := c.buildTx(req, selectInputs)
+	if err != nil {
+		return err
+	}
+	hash, err := c.node.submit(tx)
+	if err != nil {
+		return err
+	}
+	return c.out.value("TxId", hash)
+}
+
+//-fee 为负数时按节点估算的费率付手续费
+func (c *cli) buildTx(req *core.TxRequest, selectInputs func(target int64) ([]*core.Output, error)) (*core.Transaction, error) {
+	if c.fee >= 0 {
+		req.TxFee = c.fee
+		target, err := req.Target()
+		if err != nil {
+			return nil, err
+		}
+		prevOuts, err := selectInputs(target)
+		if err != nil {
+			return nil, err
+		}
+		return core.BuildTx(prevOuts, req, time.Now().Unix())
+	}
+	rate, err := c.feeRate()
+	if err != nil {
+		return nil, err
+	}
+	return core.BuildTxWithFeeRate(req, rate, selectInputs, time.Now().Unix())
+}
+
+//节点估算的费率，节点没有足够的数据时不付手续费
+func (c *cli) feeRate() (int64, error) {
+	r, err := c.node.feeEstimate(core.DefaultFeeTarget)
+	if err != nil {
+		return 0, err
+	}
+	if len(r.Errors) != 0 {
+		return 0, nil
+	}
+	return r.FeeRate, nil
+}
+
+//选择足够的utxo，返回它们对应的之前交易的输出
+func (c *cli) selectInputs(address string, target int64) ([]*core.Output, error) {
+	us, err := c.node.utxos(address)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := c.selector.Select(us, target)
+	if err != nil {
+		return nil, fmt.Errorf("select coins for %d: %v", target, err)
+	}
+	prevOuts := make([]*core.Output, 0, len(selected))
+	for _, u := range selected {
+		tx, err := c.node.tx(u.TxHash)
+		if err != nil {
+			return nil, err
+		}
+		if u.TxOutputIndex >= len(tx.Outputs) {
+			return nil, fmt.Errorf("utxo %s:%d not found in transaction", u.TxHash, u.TxOutputIndex)
+		}
+		prevOuts = append(prevOuts, tx.Outputs[u.TxOutputIndex])
+	}
+	return prevOuts, nil
+}
+
+//在线节点构建未签名交易，找零付给 -from
+func (c *cli) createPsbt(args []string) error {
+	if c.from == "" {
+		return fmt.Errorf("-from is required")
+	}
+	to := args[0]
+	amount, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || amount <= 0 {
+		return fmt.Errorf("invalid amount %s", args[1])
+	}
+	//签名前不知道交易大小，不估算手续费
+	fee := c.fee
+	if fee < 0 {
+		fee = 0
+	}
+	req := &core.TxRequest{From: c.from, To: to, Fee: amount, TxFee: fee, Extra: c.extra, LockTime: c.lockTime, Sequence: c.sequence}
+	prevOuts, err := c.selectInputs(c.from, amount+fee)
+	if err != nil {
+		return err
+	}
+	p, err := core.CreatePartialTx(prevOuts, req, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if c.redeemScript != "" {
+		b, err := hex.DecodeString(c.redeemScript)
+		if err != nil {
+			return fmt.Errorf("invalid -redeemscript: %v", err)
+		}
+		redeem, err := core.ParseScript(b)
+		if err != nil {
+			return err
+		}
+		if p.AddRedeemScript(redeem) == 0 {
+			return fmt.Errorf("-redeemscript does not match -from %s", c.from)
+		}
+	}
+	return c.out.value("Psbt", p.String())
+}
+
+//用 keystore 中的全部钱包签名，不需要连接节点
+func (c *cli) signPsbt(args []string) error {
+	p, err := core.ParsePartialTx(args[0])
+	if err != nil {
+		return err
+	}
+	k, err := c.unlock(false)
+	if err != nil {
+		return err
+	}
+	defer k.Lock()
+	ws, err := k.Wallets()
+	if err != nil {
+		return err
+	}
+	signed := 0
+	for _, w := range ws {
+		n, err := p.Sign(w)
+		if err != nil {
+			return err
+		}
+		signed += n
+	}
+	if signed == 0 {
+		return fmt.Errorf("no input can be signed by %s", c.wallet)
+	}
+	return c.out.value("Psbt", p.String())
+}
+
+func (c *cli) combinePsbt(args []string) error {
+	ps := make([]*core.PartialTx, 0, len(args))
+	for _, it := range args {
+		p, err := core.ParsePartialTx(it)
+		if err != nil {
+			return err
+		}
+		ps = append(ps, p)
+	}
+	p, err := core.CombinePartialTx(ps...)
+	if err != nil {
+		return err
+	}
+	return c.out.value("Psbt", p.String())
+}
+
+//输出可以用 sendrawtx 提交的交易
+func (c *cli) finalizePsbt(args []string) error {
+	p, err := core.ParsePartialTx(args[0])
+	if err != nil {
+		return err
+	}
+	tx, err := p.Finalize()
+	if err != nil {
+		return err
+	}
+	raw, err := core.EncodeRawTx(tx)
+	if err != nil {
+		return err
+	}
+	return c.out.value("Hex", raw)
+}
+
+func (c *cli) sendRawTx(args []string) error {
+	tx, err := core.DecodeRawTx(args[0])
+	if err != nil {
+		return err
+	}
+	hash, err := c.node.submit(tx)
+	if err != nil {
+		return err
+	}
+	return c.out.value("TxId", hash)
+}
+
+func (c *cli) newAddress(args []string) error {
+	k, err := c.unlock(true)
+	if err != nil {
+		return err
+	}
+	defer k.Lock()
+	w, err := k.NewWallet()
+	if err != nil {
+		return err
+	}
+	return c.out.value("Address", w.Address())
+}
+
+//不需要口令
+func (c *cli) addresses(args []string) error {
+	k, err := core.OpenKeystore(c.wallet)
+	if err != nil {
+		return err
+	}
+	return c.out.list("Addresses", k.Addresses())
+}
+
+func (c *cli) importPrivKey(args []string) error {
+	w, err := core.ParseWIF(args[0])
+	if err != nil {
+		return err
+	}
+	k, err := c.unlock(true)
+	if err != nil {
+		return err
+	}
+	defer k.Lock()
+	if err = k.Add(w); err != nil {
+		return err
+	}
+	return c.out.value("Address", w.Address())
+}
+
+func (c *cli) dumpPrivKey(args []string) error {
+	k, err := c.unlock(false)
+	if err != nil {
+		return err
+	}
+	defer k.Lock()
+	w, err := findWallet(k, args[0])
+	if err != nil {
+		return err
+	}
+	return c.out.value("WIF", w.WIF())
+}
+
+//m-of-n 多重签名地址，公钥可以用 keystore 中的地址指定
+func (c *cli) createMultiSig(args []string) error {
+	m, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid m %s", args[0])
+	}
+	keys := make([][]byte, 0, len(args)-1)
+	var k *core.Keystore
+	for _, it := range args[1:] {
+		if pub, err := hex.DecodeString(it); err == nil {
+			keys = append(keys, pub)
+			continue
+		}
+		if k == nil {
+			if k, err = c.unlock(false); err != nil {
+				return err
+			}
+			defer k.Lock()
+		}
+		w, err := k.Wallet(it)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, w.PublicKey())
+	}
+	address, err := core.MultiSigAddress(m, keys)
+	if err != nil {
+		return err
+	}
+	redeem, _ := core.AddressToScript(address)
+	return c.out.multiSig(address, core.P2SHAddress(redeem), hex.EncodeToString(redeem.Bytes()))
+}
+
+//有时间锁的 P2SH 地址，+ 开头时为相对时间锁的 sequence
+func (c *cli) createTimeLock(args []string) error {
+	inner, err := core.AddressToScript(args[1])
+	if err != nil {
+		return err
+	}
+	var redeem *core.Script
+	if strings.HasPrefix(args[0], "+") {
+		sequence, err := strconv.ParseUint(args[0][1:], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid sequence %s", args[0])
+		}
+		redeem = core.SequenceLockScript(uint32(sequence), inner)
+	} else {
+		lockTime, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || lockTime <= 0 {
+			return fmt.Errorf("invalid lock time %s", args[0])
+		}
+		redeem = core.LockTimeScript(lockTime, inner)
+	}
+	return c.out.timeLock(core.P2SHAddress(redeem), hex.EncodeToString(redeem.Bytes()))
+}
+
+//只读地址不需要口令
+func (c *cli) importAddress(args []string) error {
+	k, err := core.OpenKeystore(c.wallet)
+	if err != nil {
+		return err
+	}
+	address, err := k.AddWatchOnly(args[0])
+	if err != nil {
+		return err
+	}
+	return c.out.value("Address", address)
+}
+
+//keystore 中每个地址的余额，包括只读地址
+func (c *cli) walletBalance(args []string) error {
+	k, err := core.OpenKeystore(c.wallet)
+	if err != nil {
+		return err
+	}
+	rs := make([]*walletBalance, 0)
+	var total int64 = 0
+	for _, it := range k.Addresses() {
+		b, err := c.node.balance(it)
+		if err != nil {
+			return err
+		}
+		rs = append(rs, &walletBalance{Address: it, Balance: b.Balance, WatchOnly: k.IsWatchOnly(it)})
+		total += b.Balance
+	}
+	return c.out.walletBalance(rs, total)
+}
+
+//keystore 中的地址加入节点钱包跟踪，输出按确认状态分类的余额和交易历史
+func (c *cli) walletInfo(args []string) error {
+	k, err := core.OpenKeystore(c.wallet)
+	if err != nil {
+		return err
+	}
+	for _, it := range k.Addresses() {
+		if err = c.node.watch(it); err != nil {
+			return err
+		}
+	}
+	b, err := c.node.walletBalance()
+	if err != nil {
+		return err
+	}
+	h, err := c.node.walletHistory()
+	if err != nil {
+		return err
+	}
+	return c.out.walletInfo(b, h)
+}
+
+//输出地址的 Base58Check 和 bech32 写法，bech32 地址有输入错误时标出可能出错的字符
+func (c *cli) convertAddress(args []string) error {
+	key, err := core.AddressToRipemd160PubKey(args[0])
+	if err != nil {
+		if ps := core.AddressErrorPositions(args[0]); len(ps) != 0 {
+			mark := []byte(strings.Repeat(" ", len(args[0])))
+			for _, it := range ps {
+				mark[it] = '^'
+			}
+			return fmt.Errorf("%v\n%s\n%s", err, args[0], mark)
+		}
+		return err
+	}
+	return c.out.address(core.Ripemd160ToAddress(key), core.Ripemd160ToBech32Address(key))
+}
+
+//用 -from 地址签名消息，证明拥有该地址
+func (c *cli) signMessage(args []string) error {
+	k, err := c.unlock(false)
+	if err != nil {
+		return err
+	}
+	defer k.Lock()
+	w, err := findWallet(k, c.from)
+	if err != nil {
+		return err
+	}
+	sign, err := core.SignMessage(w, args[0])
+	if err != nil {
+		return err
+	}
+	return c.out.value("Signature", sign)
+}
+
+//在本地验证，不需要节点
+func (c *cli) verifyMessage(args []string) error {
+	if err := core.VerifyMessage(args[0], args[1], args[2]); err != nil {
+		return err
+	}
+	return c.out.value("Verified", true)
+}
+
+func (c *cli) changePassphrase(args []string) error {
+	old, err := passphrase(c.passphrase, envPassphrase)
+	if err != nil {
+		return err
+	}
+	pass, err := passphrase(c.newPassphrase, envNewPassphrase)
+	if err != nil {
+		return err
+	}
+	k, err := core.OpenKeystore(c.wallet)
+	if err != nil {
+		return err
+	}
+	if err = k.ChangePassphrase(old, pass); err != nil {
+		return err
+	}
+	return c.out.value("Changed", c.wallet)
+}
+
+//生成新的助记词，需要自行抄写保存
+func (c *cli) mnemonic(args []string) error {
+	e, err := core.NewEntropy(mnemonicBits)
+	if err != nil {
+		return err
+	}
+	m, err := core.NewMnemonic(e)
+	if err != nil {
+		return err
+	}
+	return c.out.value("Mnemonic", m)
+}
+
+//从助记词恢复 DefaultHDPath 下的前 count 个地址到 keystore
+func (c *cli) restore(args []string) error {
+	count, err := strconv.Atoi(args[1])
+	if err != nil || count <= 0 || count > maxRestoreCount {
+		return fmt.Errorf("invalid address count %s", args[1])
+	}
+	ws, err := restoreWallets(args[0], count)
+	if err != nil {
+		return err
+	}
+	k, err := c.unlock(true)
+	if err != nil {
+		return err
+	}
+	defer k.Lock()
+	addrs := make([]string, 0, len(ws))
+	for _, w := range ws {
+		if err = k.Add(w); err != nil {
+			return err
+		}
+		addrs = append(addrs, w.Address())
+	}
+	return c.out.list("Addresses", addrs)
+}
+
+func (c *cli) decodeTx(args []string) error {
+	tx, err := core.DecodeRawTx(args[0])
+	if err != nil {
+		return err
+	}
+	return c.out.tx(tx)
+}
+
+func (c *cli) mine(args []string) error {
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid block count %s", args[0])
+	}
+	r := new(api.GenerateResponse)
+	if err = c.node.post("/generate", &api.GenerateRequest{Blocks: n}, r); err != nil {
+		return err
+	}
+	return c.out.list("Hashes", r.Hashes)
+}
+
+func (c *cli) peers(args []string) error {
+	ps := make([]*p2p.PeerInfo, 0)
+	if err := c.node.get("/peers", &ps); err != nil {
+		return err
+	}
+	return c.out.peers(ps)
+}
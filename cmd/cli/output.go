@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/woodyDM/simple-block-chain/internal/api"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"github.com/woodyDM/simple-block-chain/internal/p2p"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	formatTable = "table"
+	formatJson  = "json"
+)
+
+//按 -format 输出结果，json 时直接输出原始对象
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func (p *printer) print(v interface{}, table func(t *tabwriter.Writer)) error {
+	if p.json {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(p.w, string(b))
+		return err
+	}
+	t := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	table(t)
+	return t.Flush()
+}
+
+func row(t *tabwriter.Writer, cols ...interface{}) {
+	s := make([]string, len(cols))
+	for i, it := range cols {
+		s[i] = fmt.Sprint(it)
+	}
+	fmt.Fprintln(t, strings.Join(s, "\t"))
+}
+
+//创世区块的时间戳是毫秒
+func blockTime(b *core.Block) string {
+	ts := b.Timestamp
+	if b.Height == 0 {
+		ts /= 1000
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+func (p *printer) block(b *core.Block) error {
+	return p.print(b, func(t *tabwriter.Writer) {
+		row(t, "Hash", b.Hash)
+		row(t, "Height", b.Height)
+		row(t, "PreHash", b.PreHash)
+		row(t, "Time", blockTime(b))
+		row(t, "Nonce", b.Nonce)
+		row(t, "Difficulty", core.Difficulty(b.Difficulty))
+		row(t, "MerkleRoot", b.MerkleTreeRoot)
+		row(t, "Transactions", len(b.Tx))
+		row(t)
+		row(t, "#", "TXID", "IN", "OUT")
+		for i, tx := range b.Tx {
+			row(t, i, tx.Hash, len(tx.Inputs), len(tx.Outputs))
+		}
+	})
+}
+
+func (p *printer) tx(tx *core.Transaction) error {
+	return p.print(tx, func(t *tabwriter.Writer) {
+		row(t, "TxId", tx.Hash)
+		row(t, "Block", tx.BlockHash)
+		row(t, "Time", tx.Timestamp)
+		row(t, "Extra", string(tx.Extra))
+		if tx.LockTime != 0 {
+			row(t, "LockTime", tx.LockTime)
+		}
+		row(t)
+		row(t, "INPUT", "PREVOUT", "ADDRESS", "AMOUNT")
+		for i, in := range tx.Inputs {
+			row(t, i, fmt.Sprintf("%s:%d", in.Output.TxHash, in.Output.TxIndex), in.Output.Address, in.Output.Fee)
+		}
+		row(t)
+		row(t, "OUTPUT", "ADDRESS", "AMOUNT", "SCRIPT")
+		for _, o := range tx.Outputs {
+			row(t, o.TxIndex, o.Address, o.Fee, o.Script.Asm())
+		}
+	})
+}
+
+func (p *printer) utxos(us []*core.Utxo) error {
+	return p.print(us, func(t *tabwriter.Writer) {
+		row(t, "TXID", "INDEX", "AMOUNT")
+		for _, u := range us {
+			row(t, u.TxHash, u.TxOutputIndex, u.Fee)
+		}
+	})
+}
+
+func (p *printer) balance(r *api.BalanceResponse) error {
+	return p.print(r, func(t *tabwriter.Writer) {
+		row(t, "Address", r.Address)
+		row(t, "Balance", r.Balance)
+	})
+}
+
+type walletBalance struct {
+	Address   string
+	Balance   int64
+	WatchOnly bool
+}
+
+func (p *printer) walletBalance(rs []*walletBalance, total int64) error {
+	v := map[string]interface{}{"Addresses": rs, "Total": total}
+	return p.print(v, func(t *tabwriter.Writer) {
+		row(t, "ADDRESS", "BALANCE", "WATCHONLY")
+		for _, it := range rs {
+			row(t, it.Address, it.Balance, it.WatchOnly)
+		}
+		row(t, "Total", total)
+	})
+}
+
+func (p *printer) walletInfo(b *core.WalletBalance, h []*core.WalletTx) error {
+	v := map[string]interface{}{"Balance": b, "History": h}
+	return p.print(v, func(t *tabwriter.Writer) {
+		row(t, "Confirmed", b.Confirmed)
+		row(t, "Unconfirmed", b.Unconfirmed)
+		row(t)
+		row(t, "TXID", "CONFIRMATIONS", "RECEIVED", "SENT", "COINBASE")
+		for _, it := range h {
+			row(t, it.Hash, it.Confirmations, it.Received, it.Sent, it.Coinbase)
+		}
+	})
+}
+
+//同一个地址的两种写法
+func (p *printer) address(address, bech32 string) error {
+	v := map[string]string{"Address": address, "Bech32": bech32}
+	return p.print(v, func(t *tabwriter.Writer) {
+		row(t, "Address", address)
+		row(t, "Bech32", bech32)
+	})
+}
+
+//多重签名的两种地址，花费 P2SH 地址时需要赎回脚本
+func (p *printer) multiSig(address, p2sh, redeem string) error {
+	v := map[string]string{"Address": address, "P2SH": p2sh, "RedeemScript": redeem}
+	return p.print(v, func(t *tabwriter.Writer) {
+		row(t, "Address", address)
+		row(t, "P2SH", p2sh)
+		row(t, "RedeemScript", redeem)
+	})
+}
+
+func (p *printer) timeLock(p2sh, redeem string) error {
+	v := map[string]string{"P2SH": p2sh, "RedeemScript": redeem}
+	return p.print(v, func(t *tabwriter.Writer) {
+		row(t, "P2SH", p2sh)
+		row(t, "RedeemScript", redeem)
+	})
+}
+
+func (p *printer) peers(ps []*p2p.PeerInfo) error {
+	return p.print(ps, func(t *tabwriter.Writer) {
+		row(t, "ADDR", "INBOUND", "IDENTITY", "CONNECTED")
+		for _, it := range ps {
+			row(t, it.Addr, it.Inbound, it.Identity, time.Unix(it.ConnectedAt, 0).UTC().Format(time.RFC3339))
+		}
+	})
+}
+
+//单个字段的结果
+func (p *printer) value(key string, v interface{}) error {
+	return p.print(map[string]interface{}{key: v}, func(t *tabwriter.Writer) {
+		row(t, key, v)
+	})
+}
+
+func (p *printer) list(key string, vs []string) error {
+	return p.print(map[string]interface{}{key: vs}, func(t *tabwriter.Writer) {
+		for _, it := range vs {
+			row(t, it)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	//口令也可以通过环境变量传入，避免出现在命令行历史中
+	envPassphrase    = "SBC_PASSPHRASE"
+	envNewPassphrase = "SBC_NEW_PASSPHRASE"
+
+	//24 个单词
+	mnemonicBits    = 256
+	maxRestoreCount = 1000
+)
+
+func passphrase(flagValue, env string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if v := os.Getenv(env); v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("passphrase required, use flag or %s", env)
+}
+
+//打开并解锁 keystore，create 为 true 时不存在则新建
+func (c *cli) unlock(create bool) (*core.Keystore, error) {
+	pass, err := passphrase(c.passphrase, envPassphrase)
+	if err != nil {
+		return nil, err
+	}
+	var k *core.Keystore
+	if _, err = os.Stat(c.wallet); os.IsNotExist(err) && create {
+		k, err = core.CreateKeystore(c.wallet, pass)
+	} else {
+		k, err = core.OpenKeystore(c.wallet)
+	}
+	if err != nil {
+		return nil, err
+	}
+	//一条命令执行完就退出，不需要超时
+	if err = k.Unlock(pass, 0); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+//from 为空时钱包中只能有一个地址
+func findWallet(k *core.Keystore, from string) (*core.Wallet, error) {
+	if from == "" {
+		addrs := k.Addresses()
+		if len(addrs) != 1 {
+			return nil, fmt.Errorf("wallet has %d addresses, use -from to choose one", len(addrs))
+		}
+		from = addrs[0]
+	}
+	w, err := k.Wallet(from)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", from, err)
+	}
+	return w, nil
+}
+
+//按 DefaultHDPath/i 推导前 count 个钱包
+func restoreWallets(mnemonic string, count int) ([]*core.Wallet, error) {
+	seed, err := core.MnemonicToSeed(mnemonic, "")
+	if err != nil {
+		return nil, err
+	}
+	master, err := core.NewMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	account, err := master.Derive(core.DefaultHDPath)
+	if err != nil {
+		return nil, err
+	}
+	r := make([]*core.Wallet, 0, count)
+	for i := 0; i < count; i++ {
+		k, err := account.Child(uint32(i))
+		if err != nil {
+			return nil, err
+		}
+		w, err := k.Wallet()
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, w)
+	}
+	return r, nil
+}
+
+//每行 address,amount，可以有 address,amount 表头，# 开头的行为注释
+func readPayouts(r io.Reader) ([]*core.Recipient, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+	rs := make([]*core.Recipient, 0)
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		address, amount := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if line == 1 && strings.EqualFold(address, "address") {
+			continue
+		}
+		if _, err = core.CanonicalAddress(address); err != nil {
+			return nil, fmt.Errorf("record %d: %v", line, err)
+		}
+		n, err := strconv.ParseInt(amount, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("record %d: invalid amount %s", line, amount)
+		}
+		rs = append(rs, &core.Recipient{Address: address, Amount: n})
+	}
+	if len(rs) == 0 {
+		return nil, fmt.Errorf("no payouts")
+	}
+	return rs, nil
+}
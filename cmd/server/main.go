@@ -1,14 +1,173 @@
 package main
 
 import (
+	"flag"
+	"github.com/woodyDM/simple-block-chain/internal/api"
 	"github.com/woodyDM/simple-block-chain/internal/core"
 	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
+//可重复的参数，如 -rpcuser 和 -watch
+type listFlags []string
+
+func (u *listFlags) String() string {
+	return strings.Join(*u, ",")
+}
+
+func (u *listFlags) Set(v string) error {
+	*u = append(*u, v)
+	return nil
+}
+
+var (
+	rpcUsers   listFlags
+	watch      listFlags
+	cookieFile = flag.String("rpccookiefile", ".cookie", "cookie file with a random admin password generated at startup, empty to disable")
+	noAuth     = flag.Bool("noauth", false, "disable HTTP api authentication")
+	keystore   = flag.String("keystore", "", "encrypted keystore holding the mining payout key, passphrase from SBC_PASSPHRASE")
+	payout     = flag.String("payout", "", "mining payout address in -keystore, defaults to the only address")
+	httpAddr   = flag.String("http", ":8080", "HTTP api listen address, empty to disable")
+	regtest    = flag.Bool("regtest", false, "regtest mode: no random transfers, mine blocks on demand")
+	testnet    = flag.Bool("testnet", false, "use the test network")
+	feeFile    = flag.String("feeestimates", "fee_estimates.json", "file keeping fee estimation statistics across restarts, empty to disable saving")
+)
+
+func init() {
+	flag.Var(&rpcUsers, "rpcuser", "HTTP api user as name:password[:readonly|wallet|admin], can be repeated")
+	flag.Var(&watch, "watch", "address tracked by the node wallet besides the mining payout address, can be repeated")
+}
+
+func newAuth() *api.Auth {
+	a := api.NewAuth()
+	for _, it := range rpcUsers {
+		name, password, role, err := api.ParseUser(it)
+		if err == nil {
+			err = a.AddUser(name, password, role)
+		}
+		if err != nil {
+			core.Log.Fatal("Invalid -rpcuser ", err)
+		}
+	}
+	if *cookieFile != "" {
+		if err := a.WriteCookie(*cookieFile); err != nil {
+			core.Log.Fatal(err)
+		}
+		core.Log.Info("HTTP api cookie written to ", *cookieFile)
+	}
+	if *cookieFile == "" && len(rpcUsers) == 0 {
+		core.Log.Fatal("No HTTP api user, set -rpcuser, -rpccookiefile or -noauth")
+	}
+	return a
+}
+
+//挖矿收益的钱包，没有配置 keystore 时使用测试钱包
+func minerWallet() *core.Wallet {
+	if *keystore == "" {
+		return core.GetTestWallet(9)
+	}
+	k, err := core.OpenKeystore(*keystore)
+	if err != nil {
+		core.Log.Fatal(err)
+	}
+	address := *payout
+	if address == "" {
+		if addrs := k.Addresses(); len(addrs) == 1 {
+			address = addrs[0]
+		} else {
+			core.Log.Fatal("Keystore has ", len(addrs), " addresses, set -payout")
+		}
+	}
+	if err = k.Unlock(os.Getenv("SBC_PASSPHRASE"), 0); err != nil {
+		core.Log.Fatal("Unlock keystore ", err)
+	}
+	defer k.Lock()
+	w, err := k.Wallet(address)
+	if err != nil {
+		core.Log.Fatal("Payout address ", address, " ", err)
+	}
+	return w
+}
+
+//地址和创世区块随网络变化，需要在创建区块链之前设置
+func selectNet() {
+	if *regtest && *testnet {
+		core.Log.Fatal("-regtest and -testnet can't be used together")
+	}
+	if *regtest {
+		core.SetActiveNet(core.RegTestParams)
+	} else if *testnet {
+		core.SetActiveNet(core.TestNetParams)
+	}
+	core.Log.Info("Network ", core.ActiveNet().Name)
+}
+
+func startFeeEstimator(pool *core.TxPool) *core.FeeEstimator {
+	e, err := core.NewFeeEstimator(pool, *feeFile)
+	if err != nil {
+		core.Log.Fatal(err)
+	}
+	e.Start()
+	pool.FeeEstimator = e
+	return e
+}
+
+//收到 SIGINT 或 SIGTERM 后保存手续费统计再退出
+func stopOnSignal(e *core.FeeEstimator) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		core.Log.Info("Received ", <-sig, ", shutting down")
+		if err := e.Stop(); err != nil {
+			core.Log.Error("Save fee estimates ", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+}
+
+//节点钱包跟踪挖矿收益地址和 -watch 地址，通过 /wallet 接口查询
+func startWalletTracker(pool *core.TxPool, payout string) *core.WalletTracker {
+	w := core.NewWalletTracker(pool, []string{payout})
+	for _, it := range watch {
+		if err := w.AddAddress(it); err != nil {
+			core.Log.Fatal("Invalid -watch ", it, " ", err)
+		}
+	}
+	w.Start()
+	return w
+}
+
 func main() {
+	flag.Parse()
+	selectNet()
 	pool := core.NewTxPool(core.Genesis(core.Env))
-	core.NewMiner(pool, core.GetTestWallet(9))
+	stopOnSignal(startFeeEstimator(pool))
+	mw := minerWallet()
+	miner := core.NewMiner(pool, mw)
+	tracker := startWalletTracker(pool, mw.Address())
+	if *httpAddr != "" {
+		server := api.NewServer(pool)
+		server.Miner = miner
+		server.Wallet = tracker
+		//节点之间还没有转发区块和交易的协议，暂不启动 P2P 节点，Node 为空时 /peers 返回空列表
+		server.Regtest = *regtest
+		if !*noAuth {
+			server.Auth = newAuth()
+		}
+		go func() {
+			if err := server.Run(*httpAddr); err != nil {
+				core.Log.Fatal("HTTP api stopped ", err)
+			}
+		}()
+	}
+	if *regtest {
+		select {}
+	}
 	rd := rand.New(rand.NewSource(time.Now().UnixNano()))
 	tick := time.Tick(1 * time.Second)
 	for {
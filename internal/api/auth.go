@@ -0,0 +1,307 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================================== Auth ====================================
+// HTTP Basic 认证，用户来自启动时生成的 cookie 文件或配置的 user:password
+// 每个用户有一个角色: readonly < wallet < admin，RPC 方法和写接口声明需要的角色
+// 按客户端 IP 限流，连续认证失败后锁定一段时间
+
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleReadOnly
+	RoleWallet
+	RoleAdmin
+)
+
+const (
+	//cookie 文件中的用户名，与 Bitcoin Core 相同
+	CookieUser = "__cookie__"
+
+	DefaultRate            = 20
+	DefaultBurst           = 40
+	DefaultMaxAuthFailures = 5
+	DefaultLockout         = time.Minute
+	//超过这个数量时清理空闲的客户端状态
+	maxClients    = 10000
+	clientIdleTTL = 10 * time.Minute
+
+	roleKey = "auth.role"
+	realm   = `Basic realm="simple-block-chain"`
+)
+
+var roleNames = map[Role]string{
+	RoleReadOnly: "readonly",
+	RoleWallet:   "wallet",
+	RoleAdmin:    "admin",
+}
+
+type Auth struct {
+	//每个客户端每秒允许的请求数，以及允许的突发数量
+	Rate  float64
+	Burst int
+	//连续认证失败多少次后锁定，以及锁定时长
+	MaxFailures int
+	Lockout     time.Duration
+
+	mu      sync.Mutex
+	users   map[string]*authUser
+	clients map[string]*authClient
+	now     func() time.Time
+}
+
+type authUser struct {
+	hash [sha256.Size]byte
+	role Role
+}
+
+//单个客户端 IP 的限流和失败计数
+type authClient struct {
+	tokens      float64
+	last        time.Time
+	failures    int
+	lockedUntil time.Time
+}
+
+// ==================================== func below ====================================
+
+func NewAuth() *Auth {
+	return &Auth{
+		Rate:        DefaultRate,
+		Burst:       DefaultBurst,
+		MaxFailures: DefaultMaxAuthFailures,
+		Lockout:     DefaultLockout,
+		users:       make(map[string]*authUser),
+		clients:     make(map[string]*authClient),
+		now:         time.Now,
+	}
+}
+
+func (r Role) String() string {
+	if n, ok := roleNames[r]; ok {
+		return n
+	}
+	return "none"
+}
+
+func ParseRole(s string) (Role, error) {
+	for r, n := range roleNames {
+		if n == s {
+			return r, nil
+		}
+	}
+	return RoleNone, core.ErrWrapf("Unknown role %s", s)
+}
+
+//解析 name:password[:role]，role 默认为 readonly
+func ParseUser(spec string) (string, string, Role, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return "", "", RoleNone, core.ErrWrapf("Invalid user %q, should be name:password[:role]", spec)
+	}
+	role := RoleReadOnly
+	if len(parts) == 3 {
+		r, err := ParseRole(parts[2])
+		if err != nil {
+			return "", "", RoleNone, err
+		}
+		role = r
+	}
+	return parts[0], parts[1], role, nil
+}
+
+func (a *Auth) AddUser(name, password string, role Role) error {
+	if name == "" || strings.Contains(name, ":") {
+		return core.ErrWrapf("Invalid user name %q", name)
+	}
+	if password == "" {
+		return core.ErrWrapf("Empty password for user %s", name)
+	}
+	if _, ok := roleNames[role]; !ok {
+		return core.ErrWrapf("Invalid role %d", role)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users[name] = &authUser{hash: sha256.Sum256([]byte(password)), role: role}
+	return nil
+}
+
+//生成随机密码的 admin 用户并写入 cookie 文件 (__cookie__:password)，只有本机用户可读
+func (a *Auth) WriteCookie(path string) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return core.ErrWrap("generate cookie", err)
+	}
+	password := hex.EncodeToString(b)
+	//替换已存在的 cookie 文件，原来的权限较宽时也只有本机用户可读
+	if err := core.WriteFileAtomic(path, []byte(CookieUser+":"+password), 0600); err != nil {
+		return core.ErrWrap("write cookie file", err)
+	}
+	return a.AddUser(CookieUser, password, RoleAdmin)
+}
+
+//客户端读取 cookie 文件
+func ReadCookie(path string) (string, string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", core.ErrWrap("read cookie file", err)
+	}
+	parts := strings.SplitN(strings.TrimSpace(string(b)), ":", 2)
+	if len(parts) != 2 {
+		return "", "", core.ErrWrapf("Invalid cookie file %s", path)
+	}
+	return parts[0], parts[1], nil
+}
+
+//返回用户的角色，用户不存在或密码错误时为 RoleNone
+func (a *Auth) authenticate(name, password string) Role {
+	a.mu.Lock()
+	u, ok := a.users[name]
+	a.mu.Unlock()
+	hash := sha256.Sum256([]byte(password))
+	if !ok {
+		return RoleNone
+	}
+	if subtle.ConstantTimeCompare(hash[:], u.hash[:]) != 1 {
+		return RoleNone
+	}
+	return u.role
+}
+
+func (a *Auth) client(ip string, now time.Time) *authClient {
+	cl, ok := a.clients[ip]
+	if !ok {
+		if len(a.clients) >= maxClients {
+			a.prune(now)
+		}
+		cl = &authClient{tokens: float64(a.Burst), last: now}
+		a.clients[ip] = cl
+	}
+	return cl
+}
+
+func (a *Auth) prune(now time.Time) {
+	for ip, cl := range a.clients {
+		if now.Sub(cl.last) > clientIdleTTL && now.After(cl.lockedUntil) {
+			delete(a.clients, ip)
+		}
+	}
+}
+
+//客户端被锁定或超过速率时返回需要等待的时间
+func (a *Auth) allow(ip string) time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	cl := a.client(ip, now)
+	if now.Before(cl.lockedUntil) {
+		return cl.lockedUntil.Sub(now)
+	}
+	cl.tokens += now.Sub(cl.last).Seconds() * a.Rate
+	if cl.tokens > float64(a.Burst) {
+		cl.tokens = float64(a.Burst)
+	}
+	cl.last = now
+	if cl.tokens < 1 {
+		if a.Rate <= 0 {
+			return time.Second
+		}
+		return time.Duration((1 - cl.tokens) / a.Rate * float64(time.Second))
+	}
+	cl.tokens--
+	return 0
+}
+
+//记录认证结果，连续失败达到上限时锁定
+func (a *Auth) record(ip string, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	cl := a.client(ip, now)
+	if ok {
+		cl.failures = 0
+		return
+	}
+	cl.failures++
+	if a.MaxFailures > 0 && cl.failures >= a.MaxFailures {
+		cl.failures = 0
+		cl.lockedUntil = now.Add(a.Lockout)
+		core.Log.Warn("Client ", ip, " locked out after repeated auth failures")
+	}
+}
+
+//不使用 X-Forwarded-For，避免客户端伪造 IP 绕过限流
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+//所有请求先经过认证，没有配置 Auth 时不校验
+func (s *Server) authMiddleware(c *gin.Context) {
+	a := s.Auth
+	if a == nil {
+		c.Next()
+		return
+	}
+	ip := remoteIP(c.Request)
+	if wait := a.allow(ip); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+		fail(c, http.StatusTooManyRequests, "too many requests")
+		return
+	}
+	name, password, ok := c.Request.BasicAuth()
+	role := RoleNone
+	//浏览器和 Prometheus 的第一个请求不带认证，只有密码错误才算失败
+	if ok {
+		role = a.authenticate(name, password)
+		a.record(ip, role != RoleNone)
+	}
+	if role == RoleNone {
+		c.Header("WWW-Authenticate", realm)
+		fail(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	c.Set(roleKey, role)
+	c.Next()
+}
+
+//当前请求的角色，没有配置 Auth 时拥有全部权限
+func (s *Server) role(c *gin.Context) Role {
+	if s.Auth == nil {
+		return RoleAdmin
+	}
+	if r, ok := c.Get(roleKey); ok {
+		return r.(Role)
+	}
+	return RoleNone
+}
+
+//要求角色不低于 r
+func (s *Server) require(r Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.role(c) < r {
+			fail(c, http.StatusForbidden, "requires role "+r.String())
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.t
+}
+
+func newAuthServer(t *testing.T) (*Server, *testClock) {
+	s := newTestServer()
+	s.Auth = NewAuth()
+	clock := &testClock{time.Unix(1630814880, 0)}
+	s.Auth.now = clock.now
+	for _, it := range []string{"reader:r", "payer:p:wallet", "root:x:admin"} {
+		name, pw, role, err := ParseUser(it)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Auth.AddUser(name, pw, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, clock
+}
+
+func authRequest(s *Server, method, path, user, password, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func rpcAs(t *testing.T, s *Server, user, password, body string) *testRpcResponse {
+	w := authRequest(s, "POST", "/", user, password, body)
+	if w.Code != http.StatusOK {
+		t.Fatal("status", w.Code)
+	}
+	r := new(testRpcResponse)
+	decode(t, w, r)
+	return r
+}
+
+func TestAuth_Roles(t *testing.T) {
+	s, _ := newAuthServer(t)
+	w := authRequest(s, "GET", "/blocks/tip", "", "", "")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatal("anonymous", w.Code)
+	}
+	if w = authRequest(s, "GET", "/blocks/tip", "reader", "r", ""); w.Code != http.StatusOK {
+		t.Fatal("reader get", w.Code)
+	}
+	expectError(t, authRequest(s, "POST", "/tx", "reader", "r", `{"hex":"00"}`), http.StatusForbidden)
+	expectError(t, authRequest(s, "POST", "/tx", "payer", "p", `{"hex":"zz"}`), http.StatusBadRequest)
+	expectError(t, authRequest(s, "POST", "/generate", "payer", "p", `{"blocks":1}`), http.StatusForbidden)
+	//admin 通过认证，但不是 regtest
+	expectError(t, authRequest(s, "POST", "/generate", "root", "x", `{"blocks":1}`), http.StatusForbidden)
+
+	call := `{"jsonrpc":"2.0","id":1,"method":"sendrawtransaction","params":["zz"]}`
+	if r := rpcAs(t, s, "reader", "r", call); r.Error == nil || r.Error.Code != RpcForbidden {
+		t.Fatal("reader should be forbidden")
+	}
+	if r := rpcAs(t, s, "payer", "p", call); r.Error == nil || r.Error.Code != RpcDeserializationError {
+		t.Fatal("payer should be allowed")
+	}
+	batch := `[{"jsonrpc":"2.0","id":1,"method":"getblockcount"},{"jsonrpc":"2.0","id":2,"method":"generate","params":[1]}]`
+	w = authRequest(s, "POST", "/", "payer", "p", batch)
+	resps := make([]*testRpcResponse, 0)
+	decode(t, w, &resps)
+	if len(resps) != 2 || resps[0].Error != nil || resps[1].Error.Code != RpcForbidden {
+		t.Fatal("batch roles", w.Body.String())
+	}
+}
+
+func TestAuth_Lockout(t *testing.T) {
+	s, clock := newAuthServer(t)
+	for i := 0; i < DefaultMaxAuthFailures; i++ {
+		expectError(t, authRequest(s, "GET", "/blocks/tip", "reader", "bad", ""), http.StatusUnauthorized)
+	}
+	//锁定期间正确的密码也被拒绝
+	w := authRequest(s, "GET", "/blocks/tip", "reader", "r", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Fatal("locked", w.Code, w.Header().Get("Retry-After"))
+	}
+	clock.t = clock.t.Add(DefaultLockout)
+	if w = authRequest(s, "GET", "/blocks/tip", "reader", "r", ""); w.Code != http.StatusOK {
+		t.Fatal("lockout should expire", w.Code)
+	}
+	//成功后重新计数
+	for i := 0; i < DefaultMaxAuthFailures-1; i++ {
+		authRequest(s, "GET", "/blocks/tip", "reader", "bad", "")
+	}
+	authRequest(s, "GET", "/blocks/tip", "reader", "r", "")
+	if w = authRequest(s, "GET", "/blocks/tip", "reader", "bad", ""); w.Code != http.StatusUnauthorized {
+		t.Fatal("failures should reset", w.Code)
+	}
+}
+
+//没有带认证信息的请求不算失败
+func TestAuth_AnonymousNotLocked(t *testing.T) {
+	s, clock := newAuthServer(t)
+	for i := 0; i < DefaultMaxAuthFailures*2; i++ {
+		clock.t = clock.t.Add(time.Second)
+		expectError(t, authRequest(s, "GET", "/metrics", "", "", ""), http.StatusUnauthorized)
+	}
+	if w := authRequest(s, "GET", "/blocks/tip", "reader", "r", ""); w.Code != http.StatusOK {
+		t.Fatal("anonymous requests should not lock out", w.Code)
+	}
+}
+
+func TestAuth_RateLimit(t *testing.T) {
+	s, clock := newAuthServer(t)
+	s.Auth.Rate = 1
+	s.Auth.Burst = 3
+	for i := 0; i < 3; i++ {
+		if w := authRequest(s, "GET", "/blocks/tip", "reader", "r", ""); w.Code != http.StatusOK {
+			t.Fatal("burst", i, w.Code)
+		}
+	}
+	expectError(t, authRequest(s, "GET", "/blocks/tip", "reader", "r", ""), http.StatusTooManyRequests)
+	clock.t = clock.t.Add(time.Second)
+	if w := authRequest(s, "GET", "/blocks/tip", "reader", "r", ""); w.Code != http.StatusOK {
+		t.Fatal("refill", w.Code)
+	}
+	//批量请求中的每个调用都计入限流
+	clock.t = clock.t.Add(2 * time.Second)
+	batch := `[{"jsonrpc":"2.0","id":1,"method":"getblockcount"},{"jsonrpc":"2.0","id":2,"method":"getblockcount"},{"jsonrpc":"2.0","id":3,"method":"getblockcount"}]`
+	w := authRequest(s, "POST", "/", "reader", "r", batch)
+	resps := make([]*testRpcResponse, 0)
+	decode(t, w, &resps)
+	if len(resps) != 3 || resps[1].Error != nil || resps[2].Error == nil || resps[2].Error.Code != RpcTooManyRequests {
+		t.Fatal("batch rate limit", w.Body.String())
+	}
+	expectError(t, authRequest(s, "GET", "/blocks/tip", "reader", "r", ""), http.StatusTooManyRequests)
+	//不同客户端分别计算
+	req := httptest.NewRequest("GET", "/blocks/tip", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	req.SetBasicAuth("reader", "r")
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatal("other client", w.Code)
+	}
+}
+
+func TestAuth_Cookie(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".cookie")
+	s := NewServer(core.NewTxPool(core.Genesis(core.Env)))
+	s.Auth = NewAuth()
+	if err = s.Auth.WriteCookie(path); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0600 {
+		t.Fatal("cookie file mode", fi.Mode())
+	}
+	//重新生成时不保留旧文件的权限
+	if err = os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Auth.WriteCookie(path); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0600 {
+		t.Fatal("rewritten cookie file mode", fi.Mode())
+	}
+	user, password, err := ReadCookie(path)
+	if err != nil || user != CookieUser || len(password) != 64 {
+		t.Fatal("read cookie", user, err)
+	}
+	if r := rpcAs(t, s, user, password, `{"jsonrpc":"2.0","id":1,"method":"generate","params":[1]}`); r.Error.Code != RpcMethodNotFound {
+		t.Fatal("cookie user should be admin", r.Error)
+	}
+}
+
+func TestParseUser(t *testing.T) {
+	if _, _, r, err := ParseUser("a:b"); err != nil || r != RoleReadOnly {
+		t.Fatal("default role")
+	}
+	for _, it := range []string{"a", "a:", ":b", "a:b:root", "a:b:c:d"} {
+		if _, _, _, err := ParseUser(it); err == nil {
+			t.Fatal("should fail", it)
+		}
+	}
+	if err := NewAuth().AddUser("a:b", "c", RoleAdmin); err == nil {
+		t.Fatal("name with colon")
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ==================================== Server-Sent Events ====================================
+// GET /events?type=block_connected,tx_accepted&address=<addr>&address=<addr>
+// 每个事件为一条 SSE 消息, event 为事件类型, data 为 EventView json
+
+const (
+	sseKeepAlive = 30 * time.Second
+)
+
+var eventTypes = map[core.EventType]bool{
+	core.EventBlockConnected:    true,
+	core.EventBlockDisconnected: true,
+	core.EventTxAccepted:        true,
+	core.EventTxEvicted:         true,
+}
+
+type EventView struct {
+	Type      core.EventType `json:"type"`
+	BlockHash string         `json:"blockHash,omitempty"`
+	Height    uint64         `json:"height,omitempty"`
+	TxHash    string         `json:"txHash,omitempty"`
+	TxIds     []string       `json:"txIds,omitempty"`
+	Reason    string         `json:"reason,omitempty"`
+	Addresses []string       `json:"addresses"`
+}
+
+func (s *Server) eventRoutes() {
+	s.engine.GET("/events", s.events)
+}
+
+func newEventView(e *core.Event) *EventView {
+	v := &EventView{
+		Type:      e.Type,
+		Reason:    e.Reason,
+		Addresses: e.Addresses(),
+	}
+	if e.Block != nil {
+		v.BlockHash = e.Block.Hash
+		v.Height = e.Block.Height
+		v.TxIds = make([]string, 0, len(e.Block.Tx))
+		for _, t := range e.Block.Tx {
+			v.TxIds = append(v.TxIds, t.Hash)
+		}
+	}
+	if e.Tx != nil {
+		v.TxHash = e.Tx.Hash
+	}
+	return v
+}
+
+func parseEventFilter(c *gin.Context) (*core.EventFilter, bool) {
+	types := make([]core.EventType, 0)
+	for _, param := range c.QueryArray("type") {
+		for _, it := range strings.Split(param, ",") {
+			t := core.EventType(strings.TrimSpace(it))
+			if !eventTypes[t] {
+				fail(c, http.StatusBadRequest, "unknown event type "+string(t))
+				return nil, false
+			}
+			types = append(types, t)
+		}
+	}
+	addresses := c.QueryArray("address")
+	for i, it := range addresses {
+		addr, err := core.CanonicalAddress(it)
+		if err != nil {
+			fail(c, http.StatusBadRequest, err.Error())
+			return nil, false
+		}
+		addresses[i] = addr
+	}
+	return core.NewEventFilter(types, addresses), true
+}
+
+func (s *Server) events(c *gin.Context) {
+	filter, ok := parseEventFilter(c)
+	if !ok {
+		return
+	}
+	sub := s.Chain.Events.Subscribe(filter, core.DefaultEventBuffer)
+	defer sub.Unsubscribe()
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	//先发送响应头，客户端可以确认订阅成功
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return false
+			}
+			c.SSEvent(string(e.Type), newEventView(e))
+			return true
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
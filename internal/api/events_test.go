@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func readSSE(t *testing.T, r *bufio.Reader) (string, *EventView) {
+	var name string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "event:") {
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		}
+		if strings.HasPrefix(line, "data:") {
+			v := new(EventView)
+			if err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), v); err != nil {
+				t.Fatal(err)
+			}
+			return name, v
+		}
+	}
+}
+
+func TestEvents_Stream(t *testing.T) {
+	s := newTestServer()
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	w1 := core.GetTestWallet(0)
+	w2 := core.GetTestWallet(1)
+	w3 := core.GetTestWallet(2)
+	resp, err := http.Get(ts.URL + "/events?type=tx_accepted&address=" + w2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatal("sse headers", resp.StatusCode)
+	}
+	//与订阅地址无关的交易不会推送
+	if r := w3.Transform(s.Pool, w1.Address(), 3, "other"); r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	r := w1.Transform(s.Pool, w2.Address(), 5, "sse")
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	name, v := readSSE(t, bufio.NewReader(resp.Body))
+	if name != string(core.EventTxAccepted) || v.TxHash != r.Tx().Hash {
+		t.Fatal("event", name, v)
+	}
+	found := false
+	for _, it := range v.Addresses {
+		found = found || it == w2.Address()
+	}
+	if !found {
+		t.Fatal("addresses")
+	}
+}
+
+func TestEvents_BadFilter(t *testing.T) {
+	s := newTestServer()
+	expectError(t, doRequest(s, "GET", "/events?type=nope", nil), http.StatusBadRequest)
+	expectError(t, doRequest(s, "GET", "/events?address=abc", nil), http.StatusBadRequest)
+}
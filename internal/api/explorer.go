@@ -0,0 +1,226 @@
+package api
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ==================================== Explorer ====================================
+// 服务端渲染的区块浏览器
+// GET /explorer/                 最近的区块
+// GET /explorer/block/{hash}     区块详情
+// GET /explorer/tx/{hash}        交易详情
+// GET /explorer/address/{addr}   地址的utxo和历史
+// GET /explorer/search?q=        按 区块hash / 高度 / 交易hash / 地址 搜索
+
+const (
+	recentBlocks = 20
+)
+
+var explorerPages map[string]*template.Template
+
+func init() {
+	funcs := template.FuncMap{
+		"difficulty": core.Difficulty,
+		"totalOut":   totalOut,
+	}
+	pages := map[string]string{
+		"index":   indexTmpl,
+		"block":   blockTmpl,
+		"tx":      txTmpl,
+		"address": addressTmpl,
+		"error":   errorTmpl,
+	}
+	explorerPages = make(map[string]*template.Template)
+	for name, content := range pages {
+		t := template.Must(template.New(name).Funcs(funcs).Parse(layoutTmpl))
+		explorerPages[name] = template.Must(t.Parse(content))
+	}
+}
+
+type page struct {
+	Title string
+}
+
+type indexPage struct {
+	page
+	Blocks []*core.Block
+}
+
+type blockPage struct {
+	page
+	Block         *core.Block
+	Next          *core.Block
+	Confirmations uint64
+}
+
+type txPage struct {
+	page
+	Tx            *core.Transaction
+	Height        uint64
+	Confirmations uint64
+}
+
+type addressPage struct {
+	page
+	Address string
+	Balance int64
+	Utxos   []*core.Utxo
+	History []*addressTx
+}
+
+type addressTx struct {
+	Tx     *core.Transaction
+	Height uint64
+	//本交易对地址余额的影响
+	Change int64
+}
+
+type errorPage struct {
+	page
+	Message string
+}
+
+func (s *Server) explorerRoutes() {
+	g := s.engine.Group("/explorer")
+	g.GET("/", s.explorerIndex)
+	g.GET("/block/:hash", s.explorerBlock)
+	g.GET("/tx/:hash", s.explorerTx)
+	g.GET("/address/:addr", s.explorerAddress)
+	g.GET("/search", s.explorerSearch)
+}
+
+func totalOut(tx *core.Transaction) int64 {
+	var r int64 = 0
+	for _, o := range tx.Outputs {
+		r += o.Fee
+	}
+	return r
+}
+
+func render(c *gin.Context, status int, name string, data interface{}) {
+	buf := new(bytes.Buffer)
+	if err := explorerPages[name].ExecuteTemplate(buf, "layout", data); err != nil {
+		core.Log.Error("Render explorer page ", name, " failed ", err)
+		c.String(http.StatusInternalServerError, "render error")
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
+
+func renderError(c *gin.Context, status int, msg string) {
+	render(c, status, "error", &errorPage{page{"Error"}, msg})
+}
+
+func (s *Server) explorerIndex(c *gin.Context) {
+	tip := s.Chain.Tip()
+	blocks := make([]*core.Block, 0, recentBlocks)
+	for h := int64(tip.Height); h >= 0 && len(blocks) < recentBlocks; h-- {
+		if b, ok := s.Chain.GetBlockByHeight(uint64(h)); ok {
+			blocks = append(blocks, b)
+		}
+	}
+	render(c, http.StatusOK, "index", &indexPage{page{"Recent blocks"}, blocks})
+}
+
+func (s *Server) explorerBlock(c *gin.Context) {
+	b, ok := s.Chain.GetBlock(c.Param("hash"))
+	if !ok {
+		renderError(c, http.StatusNotFound, "Block not found")
+		return
+	}
+	next, _ := s.Chain.GetBlockByHeight(b.Height + 1)
+	render(c, http.StatusOK, "block", &blockPage{
+		page:          page{"Block " + strconv.FormatUint(b.Height, 10)},
+		Block:         b,
+		Next:          next,
+		Confirmations: s.Chain.Tip().Height - b.Height + 1,
+	})
+}
+
+func (s *Server) explorerTx(c *gin.Context) {
+	hash := c.Param("hash")
+	tx, ok := s.Chain.GetTx(hash)
+	if !ok {
+		tx, ok = s.Pool.GetPendingTx(hash)
+	}
+	if !ok {
+		renderError(c, http.StatusNotFound, "Transaction not found")
+		return
+	}
+	p := &txPage{page: page{"Transaction " + tx.Hash}, Tx: tx}
+	if b, ok := s.Chain.GetBlock(tx.BlockHash); ok {
+		p.Height = b.Height
+		p.Confirmations = s.Chain.Tip().Height - b.Height + 1
+	}
+	render(c, http.StatusOK, "tx", p)
+}
+
+func (s *Server) explorerAddress(c *gin.Context) {
+	addr, err := core.CanonicalAddress(c.Param("addr"))
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "Invalid address: "+err.Error())
+		return
+	}
+	history := make([]*addressTx, 0)
+	for _, tx := range s.Chain.AddressHistory(addr) {
+		it := &addressTx{Tx: tx}
+		if b, ok := s.Chain.GetBlock(tx.BlockHash); ok {
+			it.Height = b.Height
+		}
+		for _, in := range tx.Inputs {
+			if in.Output.Address == addr {
+				it.Change -= in.Output.Fee
+			}
+		}
+		for _, o := range tx.Outputs {
+			if o.Address == addr {
+				it.Change += o.Fee
+			}
+		}
+		history = append(history, it)
+	}
+	render(c, http.StatusOK, "address", &addressPage{
+		page:    page{"Address " + addr},
+		Address: addr,
+		Balance: s.Chain.Balance(addr),
+		Utxos:   s.Chain.GetUtxo(addr),
+		History: history,
+	})
+}
+
+func (s *Server) explorerSearch(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.Redirect(http.StatusFound, "/explorer/")
+		return
+	}
+	if h, err := strconv.ParseUint(q, 10, 64); err == nil {
+		if b, ok := s.Chain.GetBlockByHeight(h); ok {
+			c.Redirect(http.StatusFound, "/explorer/block/"+b.Hash)
+			return
+		}
+	}
+	if _, ok := s.Chain.GetBlock(q); ok {
+		c.Redirect(http.StatusFound, "/explorer/block/"+q)
+		return
+	}
+	if _, ok := s.Chain.GetTx(q); ok {
+		c.Redirect(http.StatusFound, "/explorer/tx/"+q)
+		return
+	}
+	if _, ok := s.Pool.GetPendingTx(q); ok {
+		c.Redirect(http.StatusFound, "/explorer/tx/"+q)
+		return
+	}
+	if addr, err := core.CanonicalAddress(q); err == nil {
+		c.Redirect(http.StatusFound, "/explorer/address/"+addr)
+		return
+	}
+	renderError(c, http.StatusNotFound, "Nothing found for "+q)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func expectPage(t *testing.T, s *Server, path string, status int, contains ...string) {
+	w := doRequest(s, "GET", path, nil)
+	if w.Code != status {
+		t.Fatal(path, "status", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatal(path, "should be html")
+	}
+	body := w.Body.String()
+	for _, it := range contains {
+		if !strings.Contains(body, it) {
+			t.Fatal(path, "should contain", it)
+		}
+	}
+}
+
+func expectRedirect(t *testing.T, s *Server, q, location string) {
+	w := doRequest(s, "GET", "/explorer/search?q="+url.QueryEscape(q), nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != location {
+		t.Fatal("search", q, w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestExplorer_Pages(t *testing.T) {
+	s := newTestServer()
+	genesis := s.Chain.Tip()
+	tx := genesis.Tx[0]
+	addr := tx.Outputs[0].Address
+	expectPage(t, s, "/explorer/", http.StatusOK, genesis.Hash)
+	expectPage(t, s, "/explorer/block/"+genesis.Hash, http.StatusOK, genesis.MerkleTreeRoot, genesis.Nonce, tx.Hash)
+	expectPage(t, s, "/explorer/tx/"+tx.Hash, http.StatusOK, "coinbase", "OP_DUP OP_SHA160 OP_PUSHDATA", addr)
+	expectPage(t, s, "/explorer/address/"+addr, http.StatusOK, "100", tx.Hash)
+	expectPage(t, s, "/explorer/block/abc", http.StatusNotFound, "Block not found")
+	expectPage(t, s, "/explorer/tx/abc", http.StatusNotFound, "Transaction not found")
+	expectPage(t, s, "/explorer/address/abc", http.StatusBadRequest, "Invalid address")
+}
+
+func TestExplorer_PendingTx(t *testing.T) {
+	s := newTestServer()
+	w1 := core.GetTestWallet(0)
+	r := w1.Transform(s.Pool, core.GetTestWallet(1).Address(), 5, "explorer")
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	expectPage(t, s, "/explorer/tx/"+r.Tx().Hash, http.StatusOK, "unconfirmed", "OP_CHECKSIG")
+	expectRedirect(t, s, r.Tx().Hash, "/explorer/tx/"+r.Tx().Hash)
+}
+
+func TestExplorer_Search(t *testing.T) {
+	s := newTestServer()
+	genesis := s.Chain.Tip()
+	tx := genesis.Tx[0]
+	expectRedirect(t, s, "0", "/explorer/block/"+genesis.Hash)
+	expectRedirect(t, s, genesis.Hash, "/explorer/block/"+genesis.Hash)
+	expectRedirect(t, s, tx.Hash, "/explorer/tx/"+tx.Hash)
+	expectRedirect(t, s, tx.Outputs[0].Address, "/explorer/address/"+tx.Outputs[0].Address)
+	expectRedirect(t, s, "", "/explorer/")
+	expectPage(t, s, "/explorer/search?q="+url.QueryEscape("<script>"), http.StatusNotFound, "&lt;script&gt;")
+}
@@ -0,0 +1,123 @@
+package api
+
+// ==================================== Explorer templates ====================================
+// 每个页面都是 layout 加上自己的 content
+
+const layoutTmpl = `{{define "layout"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - Simple Block Chain Explorer</title>
+<style>
+body { font-family: monospace; margin: 20px; }
+table { border-collapse: collapse; margin-bottom: 16px; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+.asm { word-break: break-all; max-width: 600px; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<div>
+<a href="/explorer/">Simple Block Chain Explorer</a>
+<form action="/explorer/search" method="get" style="display:inline">
+<input type="text" name="q" size="70" placeholder="block hash / height / tx hash / address">
+<input type="submit" value="Search">
+</form>
+</div>
+<hr>
+{{template "content" .}}
+</body>
+</html>{{end}}`
+
+const indexTmpl = `{{define "content"}}
+<h2>Recent blocks</h2>
+<table>
+<tr><th>Height</th><th>Hash</th><th>Time</th><th>Txs</th><th>Difficulty</th></tr>
+{{range .Blocks}}
+<tr><td><a href="/explorer/block/{{.Hash}}">{{.Height}}</a></td><td><a href="/explorer/block/{{.Hash}}">{{.Hash}}</a></td><td>{{.Timestamp}}</td><td>{{len .Tx}}</td><td>{{difficulty .Difficulty}}</td></tr>
+{{end}}
+</table>
+{{end}}`
+
+const blockTmpl = `{{define "content"}}
+{{with .Block}}
+<h2>Block {{.Height}}</h2>
+<table>
+<tr><th>Hash</th><td>{{.Hash}}</td></tr>
+<tr><th>Height</th><td>{{.Height}}</td></tr>
+<tr><th>Confirmations</th><td>{{$.Confirmations}}</td></tr>
+<tr><th>Previous block</th><td>{{if .Height}}<a href="/explorer/block/{{.PreHash}}">{{.PreHash}}</a>{{else}}-{{end}}</td></tr>
+<tr><th>Next block</th><td>{{if $.Next}}<a href="/explorer/block/{{$.Next.Hash}}">{{$.Next.Hash}}</a>{{else}}-{{end}}</td></tr>
+<tr><th>Timestamp</th><td>{{.Timestamp}}</td></tr>
+<tr><th>Nonce</th><td>{{.Nonce}}</td></tr>
+<tr><th>Target</th><td>{{.Difficulty}}</td></tr>
+<tr><th>Difficulty</th><td>{{difficulty .Difficulty}}</td></tr>
+<tr><th>Merkle root</th><td>{{.MerkleTreeRoot}}</td></tr>
+<tr><th>Transactions</th><td>{{len .Tx}}</td></tr>
+</table>
+<h3>Transactions</h3>
+<table>
+<tr><th>#</th><th>Hash</th><th>Inputs</th><th>Outputs</th><th>Total out</th></tr>
+{{range $i, $tx := .Tx}}
+<tr><td>{{$i}}</td><td><a href="/explorer/tx/{{$tx.Hash}}">{{$tx.Hash}}</a></td><td>{{len $tx.Inputs}}</td><td>{{len $tx.Outputs}}</td><td>{{totalOut $tx}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{end}}`
+
+const txTmpl = `{{define "content"}}
+{{with .Tx}}
+<h2>Transaction</h2>
+<table>
+<tr><th>Hash</th><td>{{.Hash}}</td></tr>
+<tr><th>Status</th><td>{{if .BlockHash}}confirmed in <a href="/explorer/block/{{.BlockHash}}">{{$.Height}}</a>, {{$.Confirmations}} confirmations{{else}}unconfirmed{{end}}</td></tr>
+<tr><th>Timestamp</th><td>{{.Timestamp}}</td></tr>
+<tr><th>Extra</th><td>{{printf "%s" .Extra}}</td></tr>
+{{if .LockTime}}<tr><th>Lock time</th><td>{{.LockTime}}</td></tr>{{end}}
+</table>
+<h3>Inputs</h3>
+<table>
+<tr><th>#</th><th>Previous output</th><th>Address</th><th>Value</th><th>Script ASM</th></tr>
+{{range $i, $in := .Inputs}}
+<tr><td>{{$i}}</td><td><a href="/explorer/tx/{{$in.Output.TxHash}}">{{$in.Output.TxHash}}</a>:{{$in.Output.TxIndex}}</td><td><a href="/explorer/address/{{$in.Output.Address}}">{{$in.Output.Address}}</a></td><td>{{$in.Output.Fee}}</td><td class="asm">{{$in.Script.Asm}}</td></tr>
+{{else}}
+<tr><td colspan="5">coinbase</td></tr>
+{{end}}
+</table>
+<h3>Outputs</h3>
+<table>
+<tr><th>#</th><th>Address</th><th>Value</th><th>Script ASM</th></tr>
+{{range .Outputs}}
+<tr><td>{{.TxIndex}}</td><td><a href="/explorer/address/{{.Address}}">{{.Address}}</a></td><td>{{.Fee}}</td><td class="asm">{{.Script.Asm}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{end}}`
+
+const addressTmpl = `{{define "content"}}
+<h2>Address {{.Address}}</h2>
+<table>
+<tr><th>Balance</th><td>{{.Balance}}</td></tr>
+<tr><th>Unspent outputs</th><td>{{len .Utxos}}</td></tr>
+<tr><th>Transactions</th><td>{{len .History}}</td></tr>
+</table>
+<h3>Unspent outputs</h3>
+<table>
+<tr><th>Output</th><th>Value</th></tr>
+{{range .Utxos}}
+<tr><td><a href="/explorer/tx/{{.TxHash}}">{{.TxHash}}</a>:{{.TxOutputIndex}}</td><td>{{.Fee}}</td></tr>
+{{end}}
+</table>
+<h3>History</h3>
+<table>
+<tr><th>Transaction</th><th>Block</th><th>Change</th></tr>
+{{range .History}}
+<tr><td><a href="/explorer/tx/{{.Tx.Hash}}">{{.Tx.Hash}}</a></td><td><a href="/explorer/block/{{.Tx.BlockHash}}">{{.Height}}</a></td><td>{{.Change}}</td></tr>
+{{end}}
+</table>
+{{end}}`
+
+const errorTmpl = `{{define "content"}}
+<h2 class="error">{{.Message}}</h2>
+{{end}}`
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"github.com/woodyDM/simple-block-chain/internal/metrics"
+	"net/http"
+)
+
+// ==================================== Metrics ====================================
+// GET /metrics  Prometheus 文本格式
+// 链、交易池的数据在抓取时读取；挖矿和节点数在没有设置 Miner / Node 时为 0
+
+func (s *Server) metricsRoutes() {
+	s.engine.GET("/metrics", s.metricsHandler)
+}
+
+func (s *Server) newRegistry() *metrics.Registry {
+	r := metrics.NewRegistry()
+	r.Register("sbc_chain_height", "Height of the best block.", metrics.GaugeFunc(func() float64 {
+		return float64(s.Chain.Tip().Height)
+	}))
+	r.Register("sbc_chain_tip_age_seconds", "Seconds since the timestamp of the best block.", metrics.GaugeFunc(func() float64 {
+		return float64(s.Chain.Env.UnixTime() - core.BlockUnixTime(s.Chain.Tip()))
+	}))
+	r.Register("sbc_chain_difficulty", "Difficulty of the best block relative to genesis.", metrics.GaugeFunc(func() float64 {
+		return core.Difficulty(s.Chain.Tip().Difficulty)
+	}))
+	r.Register("sbc_chain_block_connect_seconds", "Time spent connecting a block to the chain.", s.Chain.ConnectLatency)
+	r.Register("sbc_chain_utxo_count", "Number of unspent outputs in the UTXO set.", metrics.GaugeFunc(func() float64 {
+		return float64(s.Chain.UtxoCount())
+	}))
+	r.Register("sbc_miner_blocks_mined_total", "Blocks mined by this node.", metrics.CounterFunc(func() float64 {
+		if s.Miner == nil {
+			return 0
+		}
+		return s.Miner.Mined.Value()
+	}))
+	r.Register("sbc_miner_hashes_total", "Hashes tried by the miner.", metrics.CounterFunc(func() float64 {
+		if s.Miner == nil {
+			return 0
+		}
+		return s.Miner.Hashes.Value()
+	}))
+	r.Register("sbc_miner_hashrate", "Hashes per second while mining the last block.", metrics.GaugeFunc(func() float64 {
+		if s.Miner == nil {
+			return 0
+		}
+		return s.Miner.HashRate.Value()
+	}))
+	r.Register("sbc_mempool_size", "Transactions waiting in the pool.", metrics.GaugeFunc(func() float64 {
+		return float64(len(s.Pool.PendingTx()))
+	}))
+	r.Register("sbc_mempool_bytes", "Encoded size of the transactions waiting in the pool.", metrics.GaugeFunc(func() float64 {
+		return float64(s.Pool.PendingBytes())
+	}))
+	r.Register("sbc_pool_accepted_total", "Transactions accepted into the pool.", s.Pool.Accepted)
+	r.Register("sbc_pool_rejected_total", "Transactions rejected by the pool by reason.", s.Pool.Rejected)
+	r.Register("sbc_peers", "Connected peers.", metrics.GaugeFunc(func() float64 {
+		if s.Node == nil {
+			return 0
+		}
+		return float64(s.Node.PeerCount())
+	}))
+	return r
+}
+
+func (s *Server) metricsHandler(c *gin.Context) {
+	buf := new(bytes.Buffer)
+	if err := s.metrics.Write(buf); err != nil {
+		fail(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, metrics.ContentType, buf.Bytes())
+}
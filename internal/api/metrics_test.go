@@ -0,0 +1,51 @@
+package api
+
+import (
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func expectMetric(t *testing.T, body, line string) {
+	for _, it := range strings.Split(body, "\n") {
+		if it == line {
+			return
+		}
+	}
+	t.Fatal("metric not found:", line, "\n", body)
+}
+
+func TestMetrics(t *testing.T) {
+	s := newTestServer()
+
+	w1 := core.GetTestWallet(0)
+	if r := w1.Transform(s.Pool, core.GetTestWallet(1).Address(), 5, "metrics"); r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	if r := w1.Transform(s.Pool, core.GetTestWallet(1).Address(), 500, "metrics"); r.Err() == nil {
+		t.Fatal("should reject")
+	}
+	if r := s.Pool.Submit(nil); r.Err() == nil {
+		t.Fatal("should reject")
+	}
+	w := doRequest(s, "GET", "/metrics", nil)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatal("status", w.Code)
+	}
+	body := w.Body.String()
+	expectMetric(t, body, "# TYPE sbc_chain_block_connect_seconds histogram")
+	expectMetric(t, body, "sbc_chain_height 0")
+	expectMetric(t, body, "sbc_chain_difficulty 1")
+	expectMetric(t, body, "sbc_chain_block_connect_seconds_count 1")
+	expectMetric(t, body, "sbc_chain_utxo_count 10")
+	expectMetric(t, body, "sbc_miner_blocks_mined_total 0")
+	expectMetric(t, body, "sbc_mempool_size 1")
+	expectMetric(t, body, "sbc_pool_accepted_total 1")
+	expectMetric(t, body, `sbc_pool_rejected_total{reason="insufficient"} 1`)
+	expectMetric(t, body, `sbc_pool_rejected_total{reason="invalid"} 1`)
+	expectMetric(t, body, "sbc_peers 0")
+	if strings.Contains(body, "sbc_mempool_bytes 0\n") {
+		t.Fatal("mempool bytes")
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"github.com/woodyDM/simple-block-chain/internal/p2p"
+	"net/http"
+)
+
+// ==================================== Node ====================================
+// GET  /peers       已连接的节点
+// POST /generate    {"blocks": n} 立即挖出 n 个区块，仅 regtest，需要 admin 角色
+
+const (
+	maxGenerateBlocks = 100
+)
+
+var (
+	errNotRegtest = errors.New("generate is only available in regtest mode")
+)
+
+type GenerateRequest struct {
+	Blocks int `json:"blocks"`
+}
+
+type GenerateResponse struct {
+	Hashes []string `json:"hashes"`
+}
+
+func (s *Server) nodeRoutes() {
+	s.engine.GET("/peers", s.getPeers)
+	s.engine.POST("/generate", s.require(RoleAdmin), s.postGenerate)
+}
+
+func (s *Server) chainName() string {
+	if s.Regtest {
+		return core.RegTestParams.Name
+	}
+	return core.ActiveNet().Name
+}
+
+func (s *Server) peerInfo() []*p2p.PeerInfo {
+	r := make([]*p2p.PeerInfo, 0)
+	if s.Node == nil {
+		return r
+	}
+	for _, p := range s.Node.Peers() {
+		r = append(r, p.Info())
+	}
+	return r
+}
+
+func (s *Server) generate(n int) ([]string, error) {
+	if !s.Regtest || s.Miner == nil {
+		return nil, errNotRegtest
+	}
+	if n <= 0 || n > maxGenerateBlocks {
+		return nil, core.ErrWrapf("Invalid block count %d, should be 1 ~ %d", n, maxGenerateBlocks)
+	}
+	blocks, err := s.Miner.Generate(n)
+	hashes := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		hashes = append(hashes, b.Hash)
+	}
+	return hashes, err
+}
+
+func (s *Server) getPeers(c *gin.Context) {
+	c.JSON(http.StatusOK, s.peerInfo())
+}
+
+func (s *Server) postGenerate(c *gin.Context) {
+	req := new(GenerateRequest)
+	if err := c.ShouldBindJSON(req); err != nil {
+		fail(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	hashes, err := s.generate(req.Blocks)
+	if err == errNotRegtest {
+		fail(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		fail(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, &GenerateResponse{Hashes: hashes})
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"github.com/woodyDM/simple-block-chain/internal/p2p"
+	"net/http"
+	"testing"
+)
+
+func TestNode_Generate(t *testing.T) {
+	s := newTestServer()
+	s.Miner = core.NewMiner(s.Pool, core.GetTestWallet(9))
+	expectError(t, doRequest(s, "POST", "/generate", &GenerateRequest{Blocks: 1}), http.StatusForbidden)
+	rpcError(t, s, RpcMethodNotFound, "generate", 1)
+
+	s.Regtest = true
+	w1 := core.GetTestWallet(0)
+	r := w1.Transform(s.Pool, core.GetTestWallet(1).Address(), 5, "regtest")
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	w := doRequest(s, "POST", "/generate", &GenerateRequest{Blocks: 2})
+	if w.Code != http.StatusOK {
+		t.Fatal("status", w.Code, w.Body.String())
+	}
+	resp := new(GenerateResponse)
+	decode(t, w, resp)
+	if len(resp.Hashes) != 2 || s.Chain.Tip().Hash != resp.Hashes[1] {
+		t.Fatal("generate", resp.Hashes)
+	}
+	tx, ok := s.Chain.GetTx(r.Tx().Hash)
+	if !ok || tx.BlockHash != resp.Hashes[0] {
+		t.Fatal("pending tx should be mined in first block")
+	}
+	var hashes []string
+	rpcResult(t, s, &hashes, "generate", 1)
+	if len(hashes) != 1 || s.Chain.Tip().Height != 3 {
+		t.Fatal("rpc generate")
+	}
+	info := new(RpcMiningInfo)
+	rpcResult(t, s, info, "getmininginfo")
+	if info.Chain != "regtest" {
+		t.Fatal("chain name")
+	}
+	expectError(t, doRequest(s, "POST", "/generate", &GenerateRequest{Blocks: 0}), http.StatusBadRequest)
+	rpcError(t, s, RpcInvalidParameter, "generate", maxGenerateBlocks+1)
+}
+
+func TestNode_Peers(t *testing.T) {
+	s := newTestServer()
+	peers := make([]*p2p.PeerInfo, 0)
+	decode(t, doRequest(s, "GET", "/peers", nil), &peers)
+	if len(peers) != 0 {
+		t.Fatal("no node")
+	}
+	remote := p2p.NewNode(p2p.NewPlainTransport(), nil)
+	if err := remote.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	s.Node = p2p.NewNode(p2p.NewPlainTransport(), nil)
+	defer s.Node.Close()
+	if _, err := s.Node.Connect(remote.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	decode(t, doRequest(s, "GET", "/peers", nil), &peers)
+	if len(peers) != 1 || peers[0].Addr != remote.Addr().String() || peers[0].Inbound {
+		t.Fatal("peers", peers)
+	}
+	rpcResult(t, s, &peers, "getpeerinfo")
+	if len(peers) != 1 {
+		t.Fatal("rpc peers")
+	}
+	expectMetric(t, doRequest(s, "GET", "/metrics", nil).Body.String(), "sbc_peers 1")
+}
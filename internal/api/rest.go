@@ -0,0 +1,182 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"net/http"
+	"strconv"
+)
+
+// ==================================== REST ====================================
+// GET  /blocks/tip
+// GET  /blocks/{hash}
+// GET  /blocks/height/{n}
+// GET  /tx/{hash}
+// GET  /address/{addr}/utxos
+// GET  /address/{addr}/balance
+// GET  /fee/estimate?target=6&mode=conservative
+// POST /tx             {"hex": "<raw tx>"}  需要 wallet 角色
+
+const (
+	blockTip    = "tip"
+	blockHeight = "height"
+)
+
+type BalanceResponse struct {
+	Address string `json:"address"`
+	Balance int64  `json:"balance"`
+}
+
+//费率为每 core.FeeRateUnit 字节的手续费，没有估算结果时 Errors 不为空
+type FeeEstimateResponse struct {
+	FeeRate int64    `json:"feerate"`
+	Blocks  int      `json:"blocks"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+type RawTxRequest struct {
+	Hex string `json:"hex"`
+}
+
+type TxIdResponse struct {
+	Hash string `json:"hash"`
+}
+
+func (s *Server) restRoutes() {
+	//gin 中 /blocks/tip 和 /blocks/height/:n 不能与 /blocks/:hash 同时注册
+	s.engine.GET("/blocks/:id", s.getBlock)
+	s.engine.GET("/blocks/:id/:n", s.getBlockByHeight)
+	s.engine.GET("/tx/:hash", s.getTx)
+	s.engine.POST("/tx", s.require(RoleWallet), s.postTx)
+	s.engine.GET("/address/:addr/utxos", s.getUtxos)
+	s.engine.GET("/address/:addr/balance", s.getBalance)
+	s.engine.GET("/fee/estimate", s.getFeeEstimate)
+}
+
+func (s *Server) getBlock(c *gin.Context) {
+	id := c.Param("id")
+	if id == blockTip {
+		c.JSON(http.StatusOK, s.Chain.Tip())
+		return
+	}
+	b, ok := s.Chain.GetBlock(id)
+	if !ok {
+		fail(c, http.StatusNotFound, "block not found")
+		return
+	}
+	c.JSON(http.StatusOK, b)
+}
+
+func (s *Server) getBlockByHeight(c *gin.Context) {
+	if c.Param("id") != blockHeight {
+		fail(c, http.StatusNotFound, "not found")
+		return
+	}
+	n, err := strconv.ParseUint(c.Param("n"), 10, 64)
+	if err != nil {
+		fail(c, http.StatusBadRequest, "invalid height")
+		return
+	}
+	b, ok := s.Chain.GetBlockByHeight(n)
+	if !ok {
+		fail(c, http.StatusNotFound, "block not found")
+		return
+	}
+	c.JSON(http.StatusOK, b)
+}
+
+func (s *Server) getTx(c *gin.Context) {
+	tx, ok := s.Chain.GetTx(c.Param("hash"))
+	if !ok {
+		fail(c, http.StatusNotFound, "transaction not found")
+		return
+	}
+	c.JSON(http.StatusOK, tx)
+}
+
+func (s *Server) postTx(c *gin.Context) {
+	req := new(RawTxRequest)
+	if err := c.ShouldBindJSON(req); err != nil || req.Hex == "" {
+		fail(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	tx, err := core.DecodeRawTx(req.Hex)
+	if err != nil {
+		fail(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp := s.Pool.Submit(tx)
+	if resp.Err() != nil {
+		fail(c, http.StatusUnprocessableEntity, resp.Err().Error())
+		return
+	}
+	c.JSON(http.StatusOK, &TxIdResponse{Hash: resp.Tx().Hash})
+}
+
+func (s *Server) checkAddress(c *gin.Context) (string, bool) {
+	//bech32 地址转换为 utxo 索引使用的地址
+	addr, err := core.CanonicalAddress(c.Param("addr"))
+	if err != nil {
+		fail(c, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	return addr, true
+}
+
+func (s *Server) getUtxos(c *gin.Context) {
+	addr, ok := s.checkAddress(c)
+	if !ok {
+		return
+	}
+	utxos := s.Chain.GetUtxo(addr)
+	if utxos == nil {
+		utxos = make([]*core.Utxo, 0)
+	}
+	c.JSON(http.StatusOK, utxos)
+}
+
+func (s *Server) getBalance(c *gin.Context) {
+	addr, ok := s.checkAddress(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, &BalanceResponse{Address: addr, Balance: s.Chain.Balance(addr)})
+}
+
+func (s *Server) getFeeEstimate(c *gin.Context) {
+	target, err := strconv.Atoi(c.DefaultQuery("target", strconv.Itoa(core.DefaultFeeTarget)))
+	if err != nil {
+		fail(c, http.StatusBadRequest, "invalid target")
+		return
+	}
+	mode, err := core.ParseFeeEstimateMode(c.Query("mode"))
+	if err != nil {
+		fail(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	r, err := s.estimateFee(target, mode)
+	if err != nil {
+		fail(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+//参数错误时返回 error，数据不足时在结果中说明
+func (s *Server) estimateFee(target int, mode core.FeeEstimateMode) (*FeeEstimateResponse, error) {
+	if target < 1 || target > core.MaxFeeTarget {
+		return nil, core.ErrWrapf("invalid target %d, should in [1, %d]", target, core.MaxFeeTarget)
+	}
+	r := &FeeEstimateResponse{Blocks: target}
+	if s.Pool.FeeEstimator == nil {
+		r.Errors = []string{"fee estimation disabled"}
+		return r, nil
+	}
+	rate, err := s.Pool.FeeEstimator.EstimateFee(target, mode)
+	if err != nil {
+		r.Errors = []string{err.Error()}
+		return r, nil
+	}
+	r.FeeRate = rate
+	return r, nil
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var testTime int64 = core.GenesisTime
+
+func newTestServer() *Server {
+	env := &core.GlobalEnv{UnixTime: func() int64 {
+		testTime += 2000
+		return testTime
+	}}
+	return NewServer(core.NewTxPool(core.Genesis(env)))
+}
+
+func doRequest(s *Server, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var b []byte
+	if body != nil {
+		b, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatal(err, w.Body.String())
+	}
+}
+
+func expectError(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	if w.Code != status {
+		t.Fatal("status", w.Code, "expect", status, w.Body.String())
+	}
+	e := new(ErrorResponse)
+	decode(t, w, e)
+	if e.Error == "" {
+		t.Fatal("should have error message")
+	}
+}
+
+func TestRest_Blocks(t *testing.T) {
+	s := newTestServer()
+	w := doRequest(s, "GET", "/blocks/tip", nil)
+	tip := new(core.Block)
+	decode(t, w, tip)
+	if w.Code != http.StatusOK || tip.Hash != core.GenesisBlockHash {
+		t.Fatal("tip should be genesis")
+	}
+	w = doRequest(s, "GET", "/blocks/"+core.GenesisBlockHash, nil)
+	b := new(core.Block)
+	decode(t, w, b)
+	if b.Height != 0 || len(b.Tx) != len(core.GenesisPrivateKeys) {
+		t.Fatal("genesis block")
+	}
+	w = doRequest(s, "GET", "/blocks/height/0", nil)
+	decode(t, w, b)
+	if b.Hash != core.GenesisBlockHash {
+		t.Fatal("height 0")
+	}
+	expectError(t, doRequest(s, "GET", "/blocks/height/1", nil), http.StatusNotFound)
+	expectError(t, doRequest(s, "GET", "/blocks/height/abc", nil), http.StatusBadRequest)
+	expectError(t, doRequest(s, "GET", "/blocks/abc", nil), http.StatusNotFound)
+	expectError(t, doRequest(s, "GET", "/nothing", nil), http.StatusNotFound)
+}
+
+func TestRest_AddressAndTx(t *testing.T) {
+	s := newTestServer()
+	w1 := core.GetTestWallet(0)
+	w := doRequest(s, "GET", "/address/"+w1.Address()+"/balance", nil)
+	balance := new(BalanceResponse)
+	decode(t, w, balance)
+	if balance.Balance != core.GenesisCoinCount {
+		t.Fatal("balance")
+	}
+	utxos := make([]*core.Utxo, 0)
+	decode(t, doRequest(s, "GET", "/address/"+w1.Address()+"/utxos", nil), &utxos)
+	if len(utxos) != 1 {
+		t.Fatal("utxo 1")
+	}
+	w = doRequest(s, "GET", "/tx/"+utxos[0].TxHash, nil)
+	tx := new(core.Transaction)
+	decode(t, w, tx)
+	if tx.Hash != utxos[0].TxHash {
+		t.Fatal("tx hash")
+	}
+	expectError(t, doRequest(s, "GET", "/tx/abc", nil), http.StatusNotFound)
+	expectError(t, doRequest(s, "GET", "/address/abc/balance", nil), http.StatusBadRequest)
+	fee := new(FeeEstimateResponse)
+	decode(t, doRequest(s, "GET", "/fee/estimate", nil), fee)
+	if fee.Blocks != core.DefaultFeeTarget || len(fee.Errors) == 0 {
+		t.Fatal("fee estimate", fee)
+	}
+	expectError(t, doRequest(s, "GET", "/fee/estimate?target=100", nil), http.StatusBadRequest)
+	expectError(t, doRequest(s, "GET", "/fee/estimate?mode=fast", nil), http.StatusBadRequest)
+}
+
+func TestRest_PostTx(t *testing.T) {
+	s := newTestServer()
+	w1 := core.GetTestWallet(0)
+	w2 := core.GetTestWallet(1)
+	utxo := s.Chain.GetUtxo(w1.Address())[0]
+	prev, _ := s.Chain.GetTx(utxo.TxHash)
+	tx, err := core.BuildTx(prev.Outputs, w1.Request(w2.Address(), 10, "rest"), s.Chain.Env.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := core.EncodeRawTx(tx)
+	w := doRequest(s, "POST", "/tx", &RawTxRequest{Hex: raw})
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Body.String())
+	}
+	id := new(TxIdResponse)
+	decode(t, w, id)
+	if id.Hash != tx.Hash {
+		t.Fatal("hash")
+	}
+	expectError(t, doRequest(s, "POST", "/tx", &RawTxRequest{Hex: raw}), http.StatusUnprocessableEntity)
+	expectError(t, doRequest(s, "POST", "/tx", &RawTxRequest{Hex: "zz"}), http.StatusBadRequest)
+	expectError(t, doRequest(s, "POST", "/tx", nil), http.StatusBadRequest)
+}
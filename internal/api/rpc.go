@@ -0,0 +1,602 @@
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"io/ioutil"
+	"net/http"
+)
+
+// ==================================== JSON-RPC 2.0 ====================================
+// 兼容 Bitcoin Core RPC 的一个子集, POST / 或 POST /rpc, 支持批量请求
+
+const (
+	//JSON-RPC 2.0 标准错误码
+	RpcParseError     = -32700
+	RpcInvalidRequest = -32600
+	RpcMethodNotFound = -32601
+	RpcInvalidParams  = -32602
+	RpcInternalError  = -32603
+	//Bitcoin Core 错误码
+	RpcInvalidParameter     = -8
+	RpcInvalidAddressOrKey  = -5
+	RpcDeserializationError = -22
+	RpcVerifyRejected       = -26
+	//实现自定义的服务端错误: 当前用户的角色不能调用该方法
+	RpcForbidden = -32001
+	//批量请求中超过限流的调用
+	RpcTooManyRequests = -32002
+
+	jsonRpcVersion = "2.0"
+	//估算全网算力使用的区块数
+	hashPsBlocks = 120
+	//单个批量请求最多包含的调用数
+	maxBatchSize = 100
+	//请求体的最大字节数，超过时不再读取
+	maxRpcBodySize = 1 << 20
+)
+
+type RpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcRequest struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Id      json.RawMessage `json:"id"`
+}
+
+type rpcResponse struct {
+	Result interface{}
+	Error  *RpcError
+	Id     json.RawMessage
+}
+
+type rpcParams []json.RawMessage
+
+type rpcHandler func(s *Server, p rpcParams) (interface{}, *RpcError)
+
+type rpcMethod struct {
+	//参数名，按位置排列，用于支持命名参数
+	params  []string
+	handler rpcHandler
+	//调用需要的最低角色
+	role Role
+}
+
+var rpcMethods map[string]*rpcMethod
+
+func init() {
+	rpcMethods = map[string]*rpcMethod{
+		"getblockcount":      {nil, rpcGetBlockCount, RoleReadOnly},
+		"getbestblockhash":   {nil, rpcGetBestBlockHash, RoleReadOnly},
+		"getblock":           {[]string{"blockhash", "verbosity"}, rpcGetBlock, RoleReadOnly},
+		"getblockhash":       {[]string{"height"}, rpcGetBlockHash, RoleReadOnly},
+		"getrawtransaction":  {[]string{"txid", "verbose"}, rpcGetRawTransaction, RoleReadOnly},
+		"sendrawtransaction": {[]string{"hexstring"}, rpcSendRawTransaction, RoleWallet},
+		"getdifficulty":      {nil, rpcGetDifficulty, RoleReadOnly},
+		"getmininginfo":      {nil, rpcGetMiningInfo, RoleReadOnly},
+		"validateaddress":    {[]string{"address"}, rpcValidateAddress, RoleReadOnly},
+		"getbalance":         {[]string{"address"}, rpcGetBalance, RoleReadOnly},
+		"verifymessage":      {[]string{"address", "signature", "message"}, rpcVerifyMessage, RoleReadOnly},
+		"getpeerinfo":        {nil, rpcGetPeerInfo, RoleReadOnly},
+		"estimatesmartfee":   {[]string{"conf_target", "estimate_mode"}, rpcEstimateSmartFee, RoleReadOnly},
+		"generate":           {[]string{"nblocks"}, rpcGenerate, RoleAdmin},
+	}
+}
+
+func (s *Server) rpcRoutes() {
+	s.engine.POST("/", s.rpc)
+	s.engine.POST("/rpc", s.rpc)
+}
+
+func rpcErr(code int, msg string) *RpcError {
+	return &RpcError{Code: code, Message: msg}
+}
+
+func (r *rpcResponse) MarshalJSON() ([]byte, error) {
+	id := r.Id
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	if r.Error != nil {
+		return json.Marshal(&struct {
+			JsonRpc string          `json:"jsonrpc"`
+			Error   *RpcError       `json:"error"`
+			Id      json.RawMessage `json:"id"`
+		}{jsonRpcVersion, r.Error, id})
+	}
+	return json.Marshal(&struct {
+		JsonRpc string          `json:"jsonrpc"`
+		Result  interface{}     `json:"result"`
+		Id      json.RawMessage `json:"id"`
+	}{jsonRpcVersion, r.Result, id})
+}
+
+func (s *Server) rpc(c *gin.Context) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxRpcBodySize))
+	if err != nil {
+		c.JSON(http.StatusOK, &rpcResponse{Error: rpcErr(RpcParseError, "Parse error")})
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		batch := make([]json.RawMessage, 0)
+		if err = json.Unmarshal(body, &batch); err != nil {
+			c.JSON(http.StatusOK, &rpcResponse{Error: rpcErr(RpcParseError, "Parse error")})
+			return
+		}
+		if len(batch) == 0 {
+			c.JSON(http.StatusOK, &rpcResponse{Error: rpcErr(RpcInvalidRequest, "Empty batch")})
+			return
+		}
+		if len(batch) > maxBatchSize {
+			c.JSON(http.StatusOK, &rpcResponse{Error: rpcErr(RpcInvalidRequest, "Batch too large")})
+			return
+		}
+		result := make([]*rpcResponse, 0, len(batch))
+		for i, it := range batch {
+			//第一个调用已在认证时计入限流
+			if resp := s.rpcCall(c, it, i > 0); resp != nil {
+				result = append(result, resp)
+			}
+		}
+		if len(result) == 0 {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	resp := s.rpcCall(c, body, false)
+	if resp == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+//处理单个请求，通知(没有id)返回nil，charge 为 true 时按客户端限流
+func (s *Server) rpcCall(c *gin.Context, raw json.RawMessage, charge bool) *rpcResponse {
+	req := new(rpcRequest)
+	if err := json.Unmarshal(raw, req); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return &rpcResponse{Error: rpcErr(RpcParseError, "Parse error")}
+		}
+		return &rpcResponse{Error: rpcErr(RpcInvalidRequest, "Invalid request")}
+	}
+	//Bitcoin Core 的客户端使用 1.0, 不带 jsonrpc 字段也接受
+	if (req.JsonRpc != "" && req.JsonRpc != jsonRpcVersion && req.JsonRpc != "1.0") || req.Method == "" {
+		return &rpcResponse{Error: rpcErr(RpcInvalidRequest, "Invalid request"), Id: req.Id}
+	}
+	var result interface{}
+	var e *RpcError
+	if charge && s.Auth != nil && s.Auth.allow(remoteIP(c.Request)) > 0 {
+		e = rpcErr(RpcTooManyRequests, "Too many requests")
+	} else {
+		result, e = s.rpcDispatch(c, req)
+	}
+	if len(req.Id) == 0 {
+		return nil
+	}
+	return &rpcResponse{Result: result, Error: e, Id: req.Id}
+}
+
+func (s *Server) rpcDispatch(c *gin.Context, req *rpcRequest) (interface{}, *RpcError) {
+	m, ok := rpcMethods[req.Method]
+	if !ok {
+		return nil, rpcErr(RpcMethodNotFound, "Method not found")
+	}
+	if s.role(c) < m.role {
+		return nil, rpcErr(RpcForbidden, "Method "+req.Method+" requires role "+m.role.String())
+	}
+	params, e := parseParams(req.Params, m.params)
+	if e != nil {
+		return nil, e
+	}
+	return m.handler(s, params)
+}
+
+//支持位置参数 [..] 和命名参数 {..}
+func parseParams(raw json.RawMessage, names []string) (rpcParams, *RpcError) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return rpcParams{}, nil
+	}
+	if raw[0] == '[' {
+		p := make(rpcParams, 0)
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, rpcErr(RpcInvalidParams, "Invalid params")
+		}
+		if len(p) > len(names) {
+			return nil, rpcErr(RpcInvalidParams, "Too many params")
+		}
+		return p, nil
+	}
+	named := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(raw, &named); err != nil {
+		return nil, rpcErr(RpcInvalidParams, "Invalid params")
+	}
+	p := make(rpcParams, len(names))
+	for i, n := range names {
+		p[i] = named[n]
+		delete(named, n)
+	}
+	if len(named) != 0 {
+		return nil, rpcErr(RpcInvalidParams, "Unknown named param")
+	}
+	return p, nil
+}
+
+func (p rpcParams) has(i int) bool {
+	return i < len(p) && len(p[i]) != 0 && !bytes.Equal(p[i], []byte("null"))
+}
+
+func (p rpcParams) string(i int) (string, *RpcError) {
+	var r string
+	if !p.has(i) {
+		return "", rpcErr(RpcInvalidParams, "Missing param")
+	}
+	if err := json.Unmarshal(p[i], &r); err != nil {
+		return "", rpcErr(RpcInvalidParams, "Expected string param")
+	}
+	return r, nil
+}
+
+func (p rpcParams) int(i int, def int64) (int64, *RpcError) {
+	var r int64
+	if !p.has(i) {
+		return def, nil
+	}
+	if err := json.Unmarshal(p[i], &r); err != nil {
+		return 0, rpcErr(RpcInvalidParams, "Expected integer param")
+	}
+	return r, nil
+}
+
+//verbose 参数 bitcoin 中可以是 bool 或 数字
+func (p rpcParams) bool(i int) (bool, *RpcError) {
+	var r bool
+	if !p.has(i) {
+		return false, nil
+	}
+	if err := json.Unmarshal(p[i], &r); err != nil {
+		n, e := p.int(i, 0)
+		if e != nil {
+			return false, rpcErr(RpcInvalidParams, "Expected bool param")
+		}
+		return n != 0, nil
+	}
+	return r, nil
+}
+
+// ==================================== Methods ====================================
+
+type RpcBlock struct {
+	Hash              string      `json:"hash"`
+	Confirmations     int64       `json:"confirmations"`
+	Height            uint64      `json:"height"`
+	MerkleRoot        string      `json:"merkleroot"`
+	Time              int64       `json:"time"`
+	Nonce             string      `json:"nonce"`
+	Target            string      `json:"target"`
+	Difficulty        float64     `json:"difficulty"`
+	NTx               int         `json:"nTx"`
+	PreviousBlockHash string      `json:"previousblockhash,omitempty"`
+	NextBlockHash     string      `json:"nextblockhash,omitempty"`
+	Tx                interface{} `json:"tx"`
+}
+
+type RpcTx struct {
+	TxId          string     `json:"txid"`
+	Hex           string     `json:"hex"`
+	Time          int64      `json:"time"`
+	Extra         string     `json:"extra"`
+	LockTime      int64      `json:"locktime"`
+	Vin           []*RpcVin  `json:"vin"`
+	Vout          []*RpcVout `json:"vout"`
+	BlockHash     string     `json:"blockhash,omitempty"`
+	Confirmations int64      `json:"confirmations"`
+}
+
+type RpcVin struct {
+	TxId      string `json:"txid"`
+	Vout      int    `json:"vout"`
+	ScriptSig string `json:"scriptSig"`
+	Sequence  uint32 `json:"sequence"`
+}
+
+type RpcVout struct {
+	Value        int64  `json:"value"`
+	N            int    `json:"n"`
+	Address      string `json:"address"`
+	ScriptPubKey string `json:"scriptPubKey"`
+}
+
+type RpcMiningInfo struct {
+	Blocks         uint64  `json:"blocks"`
+	CurrentBlockTx int     `json:"currentblocktx"`
+	Difficulty     float64 `json:"difficulty"`
+	NetworkHashPs  float64 `json:"networkhashps"`
+	PooledTx       int     `json:"pooledtx"`
+	Chain          string  `json:"chain"`
+}
+
+type RpcValidateAddress struct {
+	IsValid      bool   `json:"isvalid"`
+	Address      string `json:"address,omitempty"`
+	ScriptPubKey string `json:"scriptPubKey,omitempty"`
+	IsScript     bool   `json:"isscript"`
+	Error        string `json:"error,omitempty"`
+}
+
+func rpcGetBlockCount(s *Server, p rpcParams) (interface{}, *RpcError) {
+	return s.Chain.Tip().Height, nil
+}
+
+func rpcGetBestBlockHash(s *Server, p rpcParams) (interface{}, *RpcError) {
+	return s.Chain.Tip().Hash, nil
+}
+
+func rpcGetBlockHash(s *Server, p rpcParams) (interface{}, *RpcError) {
+	h, e := p.int(0, -1)
+	if e != nil {
+		return nil, e
+	}
+	if h < 0 {
+		return nil, rpcErr(RpcInvalidParameter, "Block height out of range")
+	}
+	b, ok := s.Chain.GetBlockByHeight(uint64(h))
+	if !ok {
+		return nil, rpcErr(RpcInvalidParameter, "Block height out of range")
+	}
+	return b.Hash, nil
+}
+
+// verbosity 0: 区块的hex, 1: 交易id, 2: 交易详情
+func rpcGetBlock(s *Server, p rpcParams) (interface{}, *RpcError) {
+	hash, e := p.string(0)
+	if e != nil {
+		return nil, e
+	}
+	verbosity, e := p.int(1, 1)
+	if e != nil {
+		return nil, e
+	}
+	b, ok := s.Chain.GetBlock(hash)
+	if !ok {
+		return nil, rpcErr(RpcInvalidAddressOrKey, "Block not found")
+	}
+	if verbosity == 0 {
+		bs, err := json.Marshal(b)
+		if err != nil {
+			return nil, rpcErr(RpcInternalError, err.Error())
+		}
+		return hex.EncodeToString(bs), nil
+	}
+	tip := s.Chain.Tip()
+	r := &RpcBlock{
+		Hash:          b.Hash,
+		Confirmations: int64(tip.Height-b.Height) + 1,
+		Height:        b.Height,
+		MerkleRoot:    b.MerkleTreeRoot,
+		Time:          b.Timestamp,
+		Nonce:         b.Nonce,
+		Target:        b.Difficulty,
+		Difficulty:    core.Difficulty(b.Difficulty),
+		NTx:           len(b.Tx),
+	}
+	if b.Height > 0 {
+		r.PreviousBlockHash = b.PreHash
+	}
+	if next, ok := s.Chain.GetBlockByHeight(b.Height + 1); ok {
+		r.NextBlockHash = next.Hash
+	}
+	if verbosity == 1 {
+		ids := make([]string, 0, len(b.Tx))
+		for _, tx := range b.Tx {
+			ids = append(ids, tx.Hash)
+		}
+		r.Tx = ids
+	} else {
+		txs := make([]*RpcTx, 0, len(b.Tx))
+		for _, tx := range b.Tx {
+			txs = append(txs, s.rpcTx(tx))
+		}
+		r.Tx = txs
+	}
+	return r, nil
+}
+
+func (s *Server) rpcTx(tx *core.Transaction) *RpcTx {
+	raw, _ := core.EncodeRawTx(tx)
+	r := &RpcTx{
+		TxId:     tx.Hash,
+		Hex:      raw,
+		Time:     tx.Timestamp,
+		Extra:    string(tx.Extra),
+		LockTime: tx.LockTime,
+		Vin:      make([]*RpcVin, 0),
+		Vout:     make([]*RpcVout, 0),
+	}
+	for _, in := range tx.Inputs {
+		r.Vin = append(r.Vin, &RpcVin{
+			TxId:      in.Output.TxHash,
+			Vout:      in.Output.TxIndex,
+			ScriptSig: hex.EncodeToString(in.Script.Bytes()),
+			Sequence:  in.Sequence,
+		})
+	}
+	for _, o := range tx.Outputs {
+		r.Vout = append(r.Vout, &RpcVout{
+			Value:        o.Fee,
+			N:            o.TxIndex,
+			Address:      o.Address,
+			ScriptPubKey: hex.EncodeToString(o.Script.Bytes()),
+		})
+	}
+	if tx.BlockHash != "" {
+		if b, ok := s.Chain.GetBlock(tx.BlockHash); ok {
+			r.BlockHash = b.Hash
+			r.Confirmations = int64(s.Chain.Tip().Height-b.Height) + 1
+		}
+	}
+	return r
+}
+
+func rpcGetRawTransaction(s *Server, p rpcParams) (interface{}, *RpcError) {
+	txId, e := p.string(0)
+	if e != nil {
+		return nil, e
+	}
+	verbose, e := p.bool(1)
+	if e != nil {
+		return nil, e
+	}
+	tx, ok := s.Chain.GetTx(txId)
+	if !ok {
+		tx, ok = s.Pool.GetPendingTx(txId)
+	}
+	if !ok {
+		return nil, rpcErr(RpcInvalidAddressOrKey, "No such mempool or blockchain transaction")
+	}
+	if verbose {
+		return s.rpcTx(tx), nil
+	}
+	raw, err := core.EncodeRawTx(tx)
+	if err != nil {
+		return nil, rpcErr(RpcInternalError, err.Error())
+	}
+	return raw, nil
+}
+
+func rpcSendRawTransaction(s *Server, p rpcParams) (interface{}, *RpcError) {
+	raw, e := p.string(0)
+	if e != nil {
+		return nil, e
+	}
+	tx, err := core.DecodeRawTx(raw)
+	if err != nil {
+		return nil, rpcErr(RpcDeserializationError, "TX decode failed")
+	}
+	resp := s.Pool.Submit(tx)
+	if resp.Err() != nil {
+		return nil, rpcErr(RpcVerifyRejected, resp.Err().Error())
+	}
+	return resp.Tx().Hash, nil
+}
+
+func rpcGetDifficulty(s *Server, p rpcParams) (interface{}, *RpcError) {
+	return core.Difficulty(s.Chain.Tip().Difficulty), nil
+}
+
+func rpcGetMiningInfo(s *Server, p rpcParams) (interface{}, *RpcError) {
+	tip := s.Chain.Tip()
+	return &RpcMiningInfo{
+		Blocks:         tip.Height,
+		CurrentBlockTx: len(tip.Tx),
+		Difficulty:     core.Difficulty(tip.Difficulty),
+		NetworkHashPs:  s.Chain.NetworkHashPs(hashPsBlocks),
+		PooledTx:       len(s.Pool.PendingTx()),
+		Chain:          s.chainName(),
+	}, nil
+}
+
+func rpcValidateAddress(s *Server, p rpcParams) (interface{}, *RpcError) {
+	addr, e := p.string(0)
+	if e != nil {
+		return nil, e
+	}
+	script, err := core.AddressToScript(addr)
+	if err != nil {
+		return &RpcValidateAddress{IsValid: false, Error: err.Error()}, nil
+	}
+	_, err = core.AddressToScriptHash(addr)
+	return &RpcValidateAddress{
+		IsValid:      true,
+		Address:      addr,
+		ScriptPubKey: hex.EncodeToString(script.Bytes()),
+		IsScript:     err == nil,
+	}, nil
+}
+
+//节点没有钱包, getbalance 需要指定地址
+func rpcGetBalance(s *Server, p rpcParams) (interface{}, *RpcError) {
+	addr, e := p.string(0)
+	if e != nil {
+		return nil, e
+	}
+	addr, err := core.CanonicalAddress(addr)
+	if err != nil {
+		return nil, rpcErr(RpcInvalidAddressOrKey, "Invalid address")
+	}
+	return s.Chain.Balance(addr), nil
+}
+
+//地址无效时返回错误，签名不匹配时返回 false
+func rpcVerifyMessage(s *Server, p rpcParams) (interface{}, *RpcError) {
+	addr, e := p.string(0)
+	if e != nil {
+		return nil, e
+	}
+	sign, e := p.string(1)
+	if e != nil {
+		return nil, e
+	}
+	msg, e := p.string(2)
+	if e != nil {
+		return nil, e
+	}
+	if _, err := core.AddressToRipemd160PubKey(addr); err != nil {
+		return nil, rpcErr(RpcInvalidAddressOrKey, "Invalid address")
+	}
+	return core.VerifyMessage(addr, sign, msg) == nil, nil
+}
+
+func rpcEstimateSmartFee(s *Server, p rpcParams) (interface{}, *RpcError) {
+	target, e := p.int(0, 0)
+	if e != nil {
+		return nil, e
+	}
+	mode := core.FeeConservative
+	if p.has(1) {
+		m, e := p.string(1)
+		if e != nil {
+			return nil, e
+		}
+		var err error
+		if mode, err = core.ParseFeeEstimateMode(m); err != nil {
+			return nil, rpcErr(RpcInvalidParameter, "Invalid estimate_mode parameter")
+		}
+	}
+	r, err := s.estimateFee(int(target), mode)
+	if err != nil {
+		return nil, rpcErr(RpcInvalidParameter, err.Error())
+	}
+	return r, nil
+}
+
+func rpcGetPeerInfo(s *Server, p rpcParams) (interface{}, *RpcError) {
+	return s.peerInfo(), nil
+}
+
+//仅 regtest 可用
+func rpcGenerate(s *Server, p rpcParams) (interface{}, *RpcError) {
+	n, e := p.int(0, -1)
+	if e != nil {
+		return nil, e
+	}
+	hashes, err := s.generate(int(n))
+	if err != nil {
+		if err == errNotRegtest {
+			return nil, rpcErr(RpcMethodNotFound, "Method not found")
+		}
+		return nil, rpcErr(RpcInvalidParameter, err.Error())
+	}
+	return hashes, nil
+}
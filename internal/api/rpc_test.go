@@ -0,0 +1,235 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testRpcResponse struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *RpcError       `json:"error"`
+	Id      json.RawMessage `json:"id"`
+}
+
+func rpcRequestBody(s *Server, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func callRpc(t *testing.T, s *Server, method string, params ...interface{}) *testRpcResponse {
+	if params == nil {
+		params = make([]interface{}, 0)
+	}
+	b, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	w := rpcRequestBody(s, string(b))
+	if w.Code != http.StatusOK {
+		t.Fatal("status", w.Code)
+	}
+	r := new(testRpcResponse)
+	decode(t, w, r)
+	if r.JsonRpc != "2.0" || string(r.Id) != "1" {
+		t.Fatal("invalid response", w.Body.String())
+	}
+	return r
+}
+
+func rpcResult(t *testing.T, s *Server, v interface{}, method string, params ...interface{}) {
+	r := callRpc(t, s, method, params...)
+	if r.Error != nil {
+		t.Fatal(method, r.Error.Message)
+	}
+	if err := json.Unmarshal(r.Result, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func rpcError(t *testing.T, s *Server, code int, method string, params ...interface{}) {
+	r := callRpc(t, s, method, params...)
+	if r.Error == nil || r.Error.Code != code {
+		t.Fatal(method, "expect error code", code, r.Error)
+	}
+	if r.Result != nil {
+		t.Fatal("error response should not have result")
+	}
+}
+
+func TestRpc_Chain(t *testing.T) {
+	s := newTestServer()
+	var count int
+	rpcResult(t, s, &count, "getblockcount")
+	if count != 0 {
+		t.Fatal("count 0")
+	}
+	var hash string
+	rpcResult(t, s, &hash, "getbestblockhash")
+	if hash != core.GenesisBlockHash {
+		t.Fatal("best hash")
+	}
+	rpcResult(t, s, &hash, "getblockhash", 0)
+	if hash != core.GenesisBlockHash {
+		t.Fatal("block hash")
+	}
+	rpcError(t, s, RpcInvalidParameter, "getblockhash", 1)
+	rpcError(t, s, RpcInvalidParams, "getblockhash", "a")
+	b := new(RpcBlock)
+	rpcResult(t, s, b, "getblock", core.GenesisBlockHash)
+	if b.Confirmations != 1 || b.NTx != len(core.GenesisPrivateKeys) || b.Difficulty != 1 {
+		t.Fatal("block", b)
+	}
+	if ids := b.Tx.([]interface{}); len(ids) != b.NTx {
+		t.Fatal("tx ids")
+	}
+	var raw string
+	rpcResult(t, s, &raw, "getblock", core.GenesisBlockHash, 0)
+	if raw == "" {
+		t.Fatal("raw block")
+	}
+	rpcError(t, s, RpcInvalidAddressOrKey, "getblock", "00")
+	var diff float64
+	rpcResult(t, s, &diff, "getdifficulty")
+	if diff != 1 {
+		t.Fatal("genesis difficulty 1")
+	}
+	info := new(RpcMiningInfo)
+	rpcResult(t, s, info, "getmininginfo")
+	if info.Blocks != 0 || info.Chain != "main" {
+		t.Fatal("mining info")
+	}
+	fee := new(FeeEstimateResponse)
+	rpcResult(t, s, fee, "estimatesmartfee", 2)
+	if fee.Blocks != 2 || len(fee.Errors) == 0 {
+		t.Fatal("fee estimation disabled", fee)
+	}
+	s.Pool.FeeEstimator, _ = core.NewFeeEstimator(s.Pool, "")
+	rpcResult(t, s, fee, "estimatesmartfee", 2, "economical")
+	if fee.Errors[0] != core.ErrInsufficientFeeData.Error() {
+		t.Fatal("insufficient fee data", fee)
+	}
+	rpcError(t, s, RpcInvalidParameter, "estimatesmartfee", 0)
+	rpcError(t, s, RpcInvalidParameter, "estimatesmartfee", 2, "fast")
+	rpcError(t, s, RpcMethodNotFound, "stop")
+}
+
+func TestRpc_Transaction(t *testing.T) {
+	s := newTestServer()
+	w1 := core.GetTestWallet(0)
+	w2 := core.GetTestWallet(1)
+	var balance int64
+	rpcResult(t, s, &balance, "getbalance", w1.Address())
+	if balance != core.GenesisCoinCount {
+		t.Fatal("balance")
+	}
+	rpcError(t, s, RpcInvalidAddressOrKey, "getbalance", "abc")
+	v := new(RpcValidateAddress)
+	rpcResult(t, s, v, "validateaddress", w1.Address())
+	if !v.IsValid || v.ScriptPubKey == "" || v.IsScript {
+		t.Fatal("valid address")
+	}
+	rpcResult(t, s, v, "validateaddress", core.P2SHAddress(&core.Script{core.OpPushNumA, core.ScriptNum(1)}))
+	if !v.IsValid || !v.IsScript {
+		t.Fatal("valid P2SH address")
+	}
+	rpcResult(t, s, v, "validateaddress", "abc")
+	if v.IsValid {
+		t.Fatal("invalid address")
+	}
+	sign, _ := core.SignMessage(w1, "hello")
+	var verified bool
+	rpcResult(t, s, &verified, "verifymessage", w1.Address(), sign, "hello")
+	if !verified {
+		t.Fatal("verify message")
+	}
+	rpcResult(t, s, &verified, "verifymessage", w2.Address(), sign, "hello")
+	if verified {
+		t.Fatal("verify message with other address")
+	}
+	rpcError(t, s, RpcInvalidAddressOrKey, "verifymessage", "abc", sign, "hello")
+
+	utxo := s.Chain.GetUtxo(w1.Address())[0]
+	prev, _ := s.Chain.GetTx(utxo.TxHash)
+	tx, err := core.BuildTx(prev.Outputs, w1.Request(w2.Address(), 10, "rpc"), s.Chain.Env.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := core.EncodeRawTx(tx)
+	var txId string
+	rpcResult(t, s, &txId, "sendrawtransaction", raw)
+	if txId != tx.Hash {
+		t.Fatal("tx id")
+	}
+	rpcError(t, s, RpcVerifyRejected, "sendrawtransaction", raw)
+	rpcError(t, s, RpcDeserializationError, "sendrawtransaction", "zz")
+	//交易池中的交易
+	var got string
+	rpcResult(t, s, &got, "getrawtransaction", txId)
+	if got != raw {
+		t.Fatal("raw tx")
+	}
+	verbose := new(RpcTx)
+	rpcResult(t, s, verbose, "getrawtransaction", utxo.TxHash, true)
+	if verbose.TxId != utxo.TxHash || verbose.Confirmations != 1 || len(verbose.Vout) != 1 {
+		t.Fatal("verbose tx")
+	}
+	rpcError(t, s, RpcInvalidAddressOrKey, "getrawtransaction", "00")
+}
+
+func TestRpc_Protocol(t *testing.T) {
+	s := newTestServer()
+	//命名参数
+	w := rpcRequestBody(s, `{"jsonrpc":"2.0","id":"a","method":"getblockhash","params":{"height":0}}`)
+	r := new(testRpcResponse)
+	decode(t, w, r)
+	if r.Error != nil || string(r.Id) != `"a"` {
+		t.Fatal("named params", w.Body.String())
+	}
+	//批量请求, 通知没有响应
+	w = rpcRequestBody(s, `[{"jsonrpc":"2.0","id":1,"method":"getblockcount"},
+		{"jsonrpc":"2.0","method":"getblockcount"},
+		{"jsonrpc":"2.0","id":3,"method":"nope"},
+		1]`)
+	batch := make([]*testRpcResponse, 0)
+	decode(t, w, &batch)
+	if len(batch) != 3 {
+		t.Fatal("batch size", w.Body.String())
+	}
+	if batch[0].Error != nil || batch[1].Error.Code != RpcMethodNotFound || batch[2].Error.Code != RpcInvalidRequest {
+		t.Fatal("batch result", w.Body.String())
+	}
+	w = rpcRequestBody(s, `{"jsonrpc":"2.0","method":"getblockcount"}`)
+	if w.Code != http.StatusNoContent {
+		t.Fatal("notification")
+	}
+	w = rpcRequestBody(s, `{"jsonrpc":`)
+	decode(t, w, r)
+	if r.Error.Code != RpcParseError || string(r.Id) != "null" {
+		t.Fatal("parse error")
+	}
+	w = rpcRequestBody(s, `[]`)
+	decode(t, w, r)
+	if r.Error.Code != RpcInvalidRequest {
+		t.Fatal("empty batch")
+	}
+	w = rpcRequestBody(s, "["+strings.Repeat(`{"jsonrpc":"2.0","id":1,"method":"getblockcount"},`, maxBatchSize)+"1]")
+	decode(t, w, r)
+	if r.Error.Code != RpcInvalidRequest {
+		t.Fatal("batch too large")
+	}
+	w = rpcRequestBody(s, `{"jsonrpc":"2.0","id":1,"method":"getblockcount","params":["`+strings.Repeat("a", maxRpcBodySize)+`"]}`)
+	decode(t, w, r)
+	if r.Error.Code != RpcParseError {
+		t.Fatal("body too large")
+	}
+	w = rpcRequestBody(s, `{"jsonrpc":"2.0","id":1,"method":"getblockhash","params":[0,1]}`)
+	decode(t, w, r)
+	if r.Error.Code != RpcInvalidParams {
+		t.Fatal("too many params")
+	}
+}
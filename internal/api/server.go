@@ -0,0 +1,70 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"github.com/woodyDM/simple-block-chain/internal/metrics"
+	"github.com/woodyDM/simple-block-chain/internal/p2p"
+	"net/http"
+)
+
+//节点对外的 HTTP 接口
+type Server struct {
+	Chain *core.BlockChain
+	Pool  *core.TxPool
+	//可选, 用于挖矿指标和 regtest 下的 generate
+	Miner *core.Miner
+	//可选, 用于查询已连接的节点
+	Node *p2p.Node
+	//可选, 跟踪钱包地址的余额和交易历史
+	Wallet *core.WalletTracker
+	//regtest 模式下允许按需挖矿
+	Regtest bool
+	//可选, 为空时不做认证
+	Auth    *Auth
+	engine  *gin.Engine
+	metrics *metrics.Registry
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewServer(pool *core.TxPool) *Server {
+	gin.SetMode(gin.ReleaseMode)
+	s := &Server{
+		Chain:  pool.Chain,
+		Pool:   pool,
+		engine: gin.New(),
+	}
+	s.engine.Use(gin.Recovery(), s.authMiddleware)
+	s.engine.NoRoute(func(c *gin.Context) {
+		fail(c, http.StatusNotFound, "not found")
+	})
+	s.metrics = s.newRegistry()
+	s.routes()
+	return s
+}
+
+func (s *Server) routes() {
+	s.restRoutes()
+	s.rpcRoutes()
+	s.eventRoutes()
+	s.explorerRoutes()
+	s.metricsRoutes()
+	s.nodeRoutes()
+	s.walletRoutes()
+}
+
+func (s *Server) Handler() http.Handler {
+	return s.engine
+}
+
+func (s *Server) Run(addr string) error {
+	core.Log.Info("HTTP api listen on ", addr)
+	return http.ListenAndServe(addr, s.engine)
+}
+
+func fail(c *gin.Context, status int, msg string) {
+	c.AbortWithStatusJSON(status, &ErrorResponse{Error: msg})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// ==================================== Wallet ====================================
+// 节点跟踪的钱包地址，需要 wallet 角色，没有配置 Server.Wallet 时返回 404
+// GET  /wallet/balance     已确认、未确认和未成熟的余额
+// GET  /wallet/history     交易历史，未确认的在前
+// POST /wallet/addresses   {"address": "..."} 加入跟踪的地址
+
+type WatchAddressRequest struct {
+	Address string `json:"address"`
+}
+
+type WalletAddressesResponse struct {
+	Addresses []string `json:"addresses"`
+}
+
+func (s *Server) walletRoutes() {
+	g := s.engine.Group("/wallet", s.require(RoleWallet), s.requireWallet)
+	g.GET("/balance", s.getWalletBalance)
+	g.GET("/history", s.getWalletHistory)
+	g.POST("/addresses", s.postWalletAddress)
+}
+
+func (s *Server) requireWallet(c *gin.Context) {
+	if s.Wallet == nil {
+		fail(c, http.StatusNotFound, "wallet tracker not enabled")
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) getWalletBalance(c *gin.Context) {
+	c.JSON(http.StatusOK, s.Wallet.Balance())
+}
+
+func (s *Server) getWalletHistory(c *gin.Context) {
+	c.JSON(http.StatusOK, s.Wallet.History())
+}
+
+func (s *Server) postWalletAddress(c *gin.Context) {
+	req := new(WatchAddressRequest)
+	if err := c.ShouldBindJSON(req); err != nil || req.Address == "" {
+		fail(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.Wallet.AddAddress(req.Address); err != nil {
+		fail(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, &WalletAddressesResponse{Addresses: s.Wallet.Addresses()})
+}
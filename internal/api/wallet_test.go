@@ -0,0 +1,34 @@
+package api
+
+import (
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"net/http"
+	"testing"
+)
+
+func TestWallet(t *testing.T) {
+	s := newTestServer()
+	expectError(t, doRequest(s, "GET", "/wallet/balance", nil), http.StatusNotFound)
+	s.Wallet = core.NewWalletTracker(s.Pool, nil)
+	expectError(t, doRequest(s, "POST", "/wallet/addresses", &WatchAddressRequest{Address: "nope"}), http.StatusBadRequest)
+	w1 := core.GetTestWallet(1)
+	addrs := new(WalletAddressesResponse)
+	decode(t, doRequest(s, "POST", "/wallet/addresses", &WatchAddressRequest{Address: w1.Bech32Address()}), addrs)
+	if len(addrs.Addresses) != 1 || addrs.Addresses[0] != w1.Address() {
+		t.Fatal("addresses", addrs.Addresses)
+	}
+	balance := new(core.WalletBalance)
+	decode(t, doRequest(s, "GET", "/wallet/balance", nil), balance)
+	if *balance != (core.WalletBalance{Confirmed: core.GenesisCoinCount}) {
+		t.Fatal("balance", balance)
+	}
+	history := make([]*core.WalletTx, 0)
+	decode(t, doRequest(s, "GET", "/wallet/history", nil), &history)
+	if len(history) != 1 || history[0].Received != core.GenesisCoinCount || history[0].Confirmations != 1 {
+		t.Fatal("history", history)
+	}
+	//需要 wallet 角色
+	s.Auth = NewAuth()
+	_ = s.Auth.AddUser("reader", "r", RoleReadOnly)
+	expectError(t, authRequest(s, "GET", "/wallet/history", "reader", "r", ""), http.StatusForbidden)
+}
@@ -0,0 +1,265 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ==================================== Bech32 ====================================
+// BIP173 (bech32) 和 BIP350 (bech32m) 编码，只用小写字母和数字，便于朗读和抄写
+// 校验和是 GF(32) 上的 BCH 码，保证检测出 4 个以内的错误字符，并能定位 2 个以内的错误字符
+// 地址为 hrp + "1" + 版本 + 公钥 hash160，版本 0 使用 bech32，其他版本使用 bech32m
+// bech32 地址与 Base58Check 地址是同一个公钥 hash 的两种写法，输出中统一保存 Base58Check 地址
+
+type Bech32Encoding int
+
+const (
+	Bech32 Bech32Encoding = iota + 1
+	Bech32m
+
+	//地址的见证版本
+	Bech32AddressVersion byte = 0
+
+	bech32Charset     = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32Separator   = '1'
+	bech32ChecksumLen = 6
+	bech32MaxLen      = 90
+	bech32Const       = 1
+	bech32mConst      = 0x2bc830a3
+)
+
+var bech32Gen = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+//解码失败的原因，Positions 为可能出错的字符在字符串中的下标，无法定位时为空
+type Bech32Error struct {
+	Msg       string
+	Positions []int
+}
+
+// ==================================== func below ====================================
+
+func (e *Bech32Error) Error() string {
+	if len(e.Positions) == 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s, check characters at %v", e.Msg, e.Positions)
+}
+
+func (e Bech32Encoding) constant() uint32 {
+	if e == Bech32m {
+		return bech32mConst
+	}
+	return bech32Const
+}
+
+func bech32Polymod(values []byte) uint32 {
+	var chk uint32 = 1
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range bech32Gen {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HrpExpand(hrp string) []byte {
+	r := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		r = append(r, hrp[i]>>5)
+	}
+	r = append(r, 0)
+	for i := 0; i < len(hrp); i++ {
+		r = append(r, hrp[i]&31)
+	}
+	return r
+}
+
+//data 为 5 bit 一组的值
+func Bech32Encode(hrp string, data []byte, enc Bech32Encoding) (string, error) {
+	if len(hrp) == 0 || len(hrp)+1+len(data)+bech32ChecksumLen > bech32MaxLen {
+		return "", ErrWrapf("invalid bech32 length")
+	}
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 || (hrp[i] >= 'A' && hrp[i] <= 'Z') {
+			return "", ErrWrapf("invalid bech32 hrp %q", hrp)
+		}
+	}
+	values := ConcatBytes(bech32HrpExpand(hrp), data, make([]byte, bech32ChecksumLen))
+	mod := bech32Polymod(values) ^ enc.constant()
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte(bech32Separator)
+	for _, it := range data {
+		if it >= 32 {
+			return "", ErrWrapf("invalid bech32 data %d", it)
+		}
+		b.WriteByte(bech32Charset[it])
+	}
+	for i := 0; i < bech32ChecksumLen; i++ {
+		b.WriteByte(bech32Charset[(mod>>uint(5*(5-i)))&31])
+	}
+	return b.String(), nil
+}
+
+//返回小写的 hrp 和去掉校验和的数据，校验失败时返回 *Bech32Error
+func Bech32Decode(s string) (string, []byte, Bech32Encoding, error) {
+	if len(s) > bech32MaxLen {
+		return "", nil, 0, &Bech32Error{Msg: fmt.Sprintf("bech32 string too long %d", len(s))}
+	}
+	lower, upper := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			return "", nil, 0, &Bech32Error{Msg: "invalid bech32 character", Positions: []int{i}}
+		}
+		lower = lower || (c >= 'a' && c <= 'z')
+		upper = upper || (c >= 'A' && c <= 'Z')
+	}
+	//只能全部大写或全部小写
+	if lower && upper {
+		return "", nil, 0, &Bech32Error{Msg: "mixed case bech32 string"}
+	}
+	s = strings.ToLower(s)
+	sep := strings.LastIndexByte(s, bech32Separator)
+	if sep < 1 || sep+1+bech32ChecksumLen > len(s) {
+		return "", nil, 0, &Bech32Error{Msg: "missing bech32 separator or checksum"}
+	}
+	hrp := s[:sep]
+	values := make([]byte, len(s)-sep-1)
+	invalid := make([]int, 0)
+	for i := range values {
+		v := strings.IndexByte(bech32Charset, s[sep+1+i])
+		if v < 0 {
+			invalid = append(invalid, sep+1+i)
+			continue
+		}
+		values[i] = byte(v)
+	}
+	if len(invalid) != 0 {
+		return "", nil, 0, &Bech32Error{Msg: "invalid bech32 character", Positions: invalid}
+	}
+	data := values[:len(values)-bech32ChecksumLen]
+	switch bech32Polymod(ConcatBytes(bech32HrpExpand(hrp), values)) {
+	case bech32Const:
+		return hrp, data, Bech32, nil
+	case bech32mConst:
+		return hrp, data, Bech32m, nil
+	}
+	positions := locateBech32Errors(hrp, values)
+	for i := range positions {
+		positions[i] += sep + 1
+	}
+	return "", nil, 0, &Bech32Error{Msg: "invalid bech32 checksum", Positions: positions}
+}
+
+//校验和是线性的，替换第 i 个值带来的变化与其他值无关
+//先算出每个位置每种替换的变化量，再找 1 个或 2 个替换使校验和变为 bech32 或 bech32m 的常数
+//返回 values 中的下标，优先返回只有 1 个错误的结果，找不到时返回空
+func locateBech32Errors(hrp string, values []byte) []int {
+	expand := bech32HrpExpand(hrp)
+	mod := bech32Polymod(ConcatBytes(expand, values))
+	zero := make([]byte, len(expand)+len(values))
+	base := bech32Polymod(zero)
+	effects := make([][32]uint32, len(values))
+	//变化量对应的位置
+	byEffect := make(map[uint32][]int)
+	for i := range values {
+		for v := byte(1); v < 32; v++ {
+			zero[len(expand)+i] = v
+			e := bech32Polymod(zero) ^ base
+			effects[i][v] = e
+			byEffect[e] = append(byEffect[e], i)
+		}
+		zero[len(expand)+i] = 0
+	}
+	encodings := []Bech32Encoding{Bech32, Bech32m}
+	for _, enc := range encodings {
+		if cs := byEffect[mod^enc.constant()]; len(cs) != 0 {
+			return []int{cs[0]}
+		}
+	}
+	for _, enc := range encodings {
+		syndrome := mod ^ enc.constant()
+		for i := range values {
+			for v := 1; v < 32; v++ {
+				for _, j := range byEffect[syndrome^effects[i][v]] {
+					if j > i {
+						return []int{i, j}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//按位重新分组，8 bit 转 5 bit 时补 0，5 bit 转 8 bit 时不允许多余的非 0 位
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxV := uint(1)<<to - 1
+	r := make([]byte, 0, len(data)*int(from)/int(to)+1)
+	for _, it := range data {
+		if uint(it)>>from != 0 {
+			return nil, ErrWrapf("invalid data range %d", it)
+		}
+		acc = acc<<from | uint(it)
+		bits += from
+		for bits >= to {
+			bits -= to
+			r = append(r, byte((acc>>bits)&maxV))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			r = append(r, byte((acc<<(to-bits))&maxV))
+		}
+	} else if bits >= from || (acc<<(to-bits))&maxV != 0 {
+		return nil, ErrWrapf("invalid padding")
+	}
+	return r, nil
+}
+
+func EncodeBech32Address(hrp string, version byte, program []byte) (string, error) {
+	if version > 16 {
+		return "", ErrWrapf("invalid address version %d", version)
+	}
+	data, err := convertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	enc := Bech32m
+	if version == 0 {
+		enc = Bech32
+	}
+	return Bech32Encode(hrp, ConcatBytes([]byte{version}, data), enc)
+}
+
+//解码地址并检查 hrp、版本和编码是否匹配
+func DecodeBech32Address(hrp, address string) (byte, []byte, error) {
+	h, data, enc, err := Bech32Decode(address)
+	if err != nil {
+		return 0, nil, err
+	}
+	if h != hrp {
+		return 0, nil, ErrWrapf("invalid bech32 hrp %s, expect %s", h, hrp)
+	}
+	if len(data) == 0 || data[0] > 16 {
+		return 0, nil, ErrWrapf("invalid bech32 address version")
+	}
+	version := data[0]
+	if (version == 0) != (enc == Bech32) {
+		return 0, nil, ErrWrapf("address version %d with wrong checksum encoding", version)
+	}
+	program, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return 0, nil, ErrWrap("invalid bech32 address", err)
+	}
+	if len(program) < 2 || len(program) > 40 {
+		return 0, nil, ErrWrapf("invalid bech32 program size %d", len(program))
+	}
+	return version, program, nil
+}
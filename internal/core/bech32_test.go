@@ -0,0 +1,124 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBech32_Vectors(t *testing.T) {
+	//BIP173 和 BIP350 的测试向量
+	valid := map[string]Bech32Encoding{
+		"A12UEL5L": Bech32,
+		"a12uel5l": Bech32,
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw":                Bech32,
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w": Bech32,
+		"A1LQFN3A": Bech32m,
+		"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx": Bech32m,
+	}
+	for s, enc := range valid {
+		hrp, data, e, err := Bech32Decode(s)
+		if err != nil || e != enc {
+			t.Fatal(s, err, e)
+		}
+		r, err := Bech32Encode(hrp, data, enc)
+		if err != nil || r != strings.ToLower(s) {
+			t.Fatal(s, r, err)
+		}
+	}
+	invalid := []string{
+		"pzry9x0s0muk",
+		"1pzry9x0s0muk",
+		"x1b4n0q5v",
+		"li1dgmt3",
+		"A1G7SGD8",
+		"10a06t8",
+		"A12uEL5L",
+		"a" + strings.Repeat("q", 84) + "1qqqqqq",
+	}
+	for _, s := range invalid {
+		if _, _, _, err := Bech32Decode(s); err == nil {
+			t.Fatal(s)
+		}
+	}
+}
+
+func TestBech32_Address(t *testing.T) {
+	w := GetTestWallet(0)
+	addr := w.Bech32Address()
+	if !strings.HasPrefix(addr, MainNetParams.Bech32HRP+"1q") {
+		t.Fatal(addr)
+	}
+	key, err := AddressToRipemd160PubKey(addr)
+	if err != nil || !bytes.Equal(key, Sha160(Sha256(w.PublicKey()))) {
+		t.Fatal(err)
+	}
+	if _, err = AddressToRipemd160PubKey(strings.ToUpper(addr)); err != nil {
+		t.Fatal(err)
+	}
+	canonical, err := CanonicalAddress(addr)
+	if err != nil || canonical != w.Address() {
+		t.Fatal(canonical, err)
+	}
+	//两种写法的脚本相同
+	s1, _ := buildP2PKHOutputWithAddress(addr)
+	s2, _ := buildP2PKHOutputWithAddress(w.Address())
+	if !bytes.Equal(s1.CalHash(), s2.CalHash()) {
+		t.Fatal("script mismatch")
+	}
+	//版本 1 必须使用 bech32m
+	v1, _ := EncodeBech32Address(MainNetParams.Bech32HRP, 1, key)
+	if _, err = AddressToRipemd160PubKey(v1); err == nil {
+		t.Fatal("unsupported version accepted")
+	}
+	data, _ := convertBits(key, 8, 5, true)
+	wrong, _ := Bech32Encode(MainNetParams.Bech32HRP, append([]byte{0}, data...), Bech32m)
+	if _, err = AddressToRipemd160PubKey(wrong); err == nil {
+		t.Fatal("version 0 with bech32m accepted")
+	}
+
+	SetActiveNet(TestNetParams)
+	defer SetActiveNet(MainNetParams)
+	if _, err = AddressToRipemd160PubKey(addr); err == nil || !strings.Contains(err.Error(), "network main") {
+		t.Fatal(err)
+	}
+	if a := w.Bech32Address(); !strings.HasPrefix(a, TestNetParams.Bech32HRP+"1") {
+		t.Fatal(a)
+	}
+}
+
+func TestBech32_LocateErrors(t *testing.T) {
+	addr := GetTestWallet(1).Bech32Address()
+	typo := func(s string, ps ...int) string {
+		b := []byte(s)
+		for _, p := range ps {
+			i := strings.IndexByte(bech32Charset, b[p])
+			b[p] = bech32Charset[(i+7)%32]
+		}
+		return string(b)
+	}
+	cases := [][]int{{5}, {len(addr) - 1}, {10, 30}, {4, len(addr) - 2}}
+	for _, ps := range cases {
+		s := typo(addr, ps...)
+		_, _, _, err := Bech32Decode(s)
+		e, ok := err.(*Bech32Error)
+		if !ok {
+			t.Fatal(s, err)
+		}
+		if len(e.Positions) != len(ps) {
+			t.Fatal(ps, e.Positions)
+		}
+		for i := range ps {
+			if e.Positions[i] != ps[i] {
+				t.Fatal(ps, e.Positions)
+			}
+		}
+		if got := AddressErrorPositions(s); len(got) != len(ps) {
+			t.Fatal(got)
+		}
+	}
+	//base58 地址没有位置信息
+	if AddressErrorPositions(GetTestWallet(1).Address()) != nil {
+		t.Fatal("base58 address positions")
+	}
+}
@@ -1,7 +1,9 @@
 package core
 
 import (
+	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"time"
@@ -45,6 +47,8 @@ type Transaction struct {
 	Outputs []*Output
 	//额外字段，限制长度为 <= ExtraLen ,可以作为备注等
 	Extra []byte
+	//绝对时间锁，小于 LockTimeThreshold 时为区块高度，否则为 unix 时间，0 表示不锁定
+	LockTime int64 `json:",omitempty"`
 	//Hash 以下为推断字段，仅占位用
 	Hash      string
 	BlockHash string
@@ -57,6 +61,8 @@ type Input struct {
 	Script *Script
 	//之前某个 tx 的 Output
 	Output *Output
+	//相对时间锁，花费的输出确认后需要经过的区块数或时间
+	Sequence uint32 `json:",omitempty"`
 }
 
 type Output struct {
@@ -94,8 +100,9 @@ func genesisBlock() *Block {
 		panic(err)
 	}
 	b.Difficulty = GenesisDiff
-	b.Nonce = GenesisBlockNonce
-	b.Hash = GenesisBlockHash
+	net := ActiveNet()
+	b.Nonce = net.GenesisNonce
+	b.Hash = net.GenesisHash
 	return b
 }
 
@@ -154,6 +161,17 @@ func buildP2PKHOutputWithAddress(add string) (*Script, error) {
 	return _output(key), nil
 }
 
+//地址对应的输出脚本
+func AddressToScript(add string) (*Script, error) {
+	if s, ok, err := multiSigAddressScript(add); ok {
+		return s, err
+	}
+	if h, err := AddressToScriptHash(add); err == nil {
+		return buildP2SHOutput(h), nil
+	}
+	return buildP2PKHOutputWithAddress(add)
+}
+
 func _output(ripemd160 []byte) *Script {
 	return &Script{
 		OpDuplicateA,
@@ -165,9 +183,9 @@ func _output(ripemd160 []byte) *Script {
 	}
 }
 
-//OP_PUSH <sig> OP_PUSH <pubKey>
-func buildP2PKHInput(txHash []byte, w *Wallet) (*Script, error) {
-	sign, err := w.Sign(txHash)
+//OP_PUSH <sig> OP_PUSH <pubKey>，sigHash 为 Transaction.SigHash
+func buildP2PKHInput(sigHash []byte, w *Wallet) (*Script, error) {
+	sign, err := w.Sign(sigHash)
 	if err != nil {
 		return nil, ErrWrap("Failed build input", err)
 	}
@@ -179,6 +197,61 @@ func buildP2PKHInput(txHash []byte, w *Wallet) (*Script, error) {
 	}, nil
 }
 
+//m-of-n 多重签名
+//OP_PUSHNUM <m> OP_PUSH <pubKey_1> ... OP_PUSH <pubKey_n> OP_PUSHNUM <n> OP_CHECKMULTISIG
+func buildMultiSigOutput(m int, pubKeys [][]byte) (*Script, error) {
+	n := len(pubKeys)
+	if n < 1 || n > MaxMultiSigKeys || m < 1 || m > n {
+		return nil, ErrWrapf("Invalid %d-of-%d multisig", m, n)
+	}
+	s := &Script{OpPushNumA, ScriptNum(int64(m))}
+	for _, it := range pubKeys {
+		if _, err := ParsePublicKey(it); err != nil {
+			return nil, ErrWrap("Invalid multisig public key", err)
+		}
+		s.append(OpPushDataA)
+		s.append(CopyBytes(it))
+	}
+	s.append(OpPushNumA)
+	s.append(ScriptNum(int64(n)))
+	s.append(OpCheckMultiSigA)
+	return s, nil
+}
+
+//OP_PUSH <sign_1> ... OP_PUSH <sign_m>，签名的顺序与公钥相同
+func buildMultiSigInput(signs [][]byte) *Script {
+	s := new(Script)
+	for _, it := range signs {
+		s.append(OpPushDataA)
+		s.append(it)
+	}
+	return s
+}
+
+//交易手续费: 输入总额减去输出总额，coinbase 和创世交易为 0
+func (t *Transaction) TxFee() int64 {
+	if len(t.Inputs) == 0 {
+		return 0
+	}
+	var fee int64 = 0
+	for _, in := range t.Inputs {
+		fee += in.Output.Fee
+	}
+	for _, o := range t.Outputs {
+		fee -= o.Fee
+	}
+	return fee
+}
+
+//交易编码后的字节数，用于计算费率
+func (t *Transaction) Size() int {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
 //cal this transaction hash and update hexHash into Output
 func (t *Transaction) UpdateHash() error {
 	all := make([][]byte, 0)
@@ -195,6 +268,10 @@ func (t *Transaction) UpdateHash() error {
 		all = append(all, out.CalThisTxHash())
 	}
 	all = append(all, t.Extra)
+	//为 0 时不参与，之前的交易 hash 不变
+	if t.LockTime != 0 {
+		all = append(all, Int64ToBytes(t.LockTime))
+	}
 	allSha256 := ConcatBytes(all...)
 	txHash := Sha256(allSha256)
 	txHashHex := hex.EncodeToString(txHash)
@@ -205,6 +282,61 @@ func (t *Transaction) UpdateHash() error {
 	return nil
 }
 
+//签名的摘要: 交易中除输入脚本外的全部内容，加上正在签名的输入下标
+//输入脚本包含签名本身，不能参与；输出按位置计算，与 TxIndex 字段无关
+func (t *Transaction) SigHash(index int) ([]byte, error) {
+	if index < 0 || index >= len(t.Inputs) {
+		return nil, ErrWrapf("Sig hash input %d out of range", index)
+	}
+	all := make([][]byte, 0)
+	all = append(all, Int64ToBytes(t.Timestamp))
+	all = append(all, Int64ToBytes(int64(t.Type)))
+	for _, in := range t.Inputs {
+		outHash, err := in.Output.CalPreTxHash()
+		if err != nil {
+			return nil, ErrWrap("Sig hash", err)
+		}
+		all = append(all, outHash, Int64ToBytes(int64(in.Sequence)))
+	}
+	for i, o := range t.Outputs {
+		all = append(all, Int64ToBytes(o.Fee), o.Script.CalHash(), Int64ToBytes(int64(i)), Sha256([]byte(o.Address)))
+	}
+	all = append(all, Int64ToBytes(t.LockTime), Int64ToBytes(int64(index)), t.Extra)
+	return Sha256(ConcatBytes(all...)), nil
+}
+
+// ==================================== Raw Tx ====================================
+//签名好的交易的传输格式: 交易json的hex
+func EncodeRawTx(t *Transaction) (string, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return "", ErrWrap("encode raw tx", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func DecodeRawTx(raw string) (*Transaction, error) {
+	b, err := hex.DecodeString(raw)
+	if err != nil {
+		return nil, ErrWrap("decode raw tx", err)
+	}
+	t := new(Transaction)
+	if err = json.Unmarshal(b, t); err != nil {
+		return nil, ErrWrap("decode raw tx", err)
+	}
+	for _, in := range t.Inputs {
+		if in == nil || in.Script == nil || in.Output == nil || in.Output.Script == nil {
+			return nil, ErrWrapf("decode raw tx: incomplete input")
+		}
+	}
+	for _, o := range t.Outputs {
+		if o == nil || o.Script == nil {
+			return nil, ErrWrapf("decode raw tx: incomplete output")
+		}
+	}
+	return t, nil
+}
+
 //计算本tx时用的Hash
 func (o *Output) CalThisTxHash() []byte {
 	feeBytes := Int64ToBytes(o.Fee)
@@ -239,6 +371,9 @@ func (i *Input) CalHash() ([]byte, error) {
 		return nil, ErrWrap("Input Hash Cal Error", err)
 	}
 	all := ConcatBytes(scriptHash, outHash)
+	if i.Sequence != 0 {
+		all = ConcatBytes(all, Int64ToBytes(int64(i.Sequence)))
+	}
 	return Sha256(all), nil
 }
 
@@ -259,6 +394,35 @@ func (s *Script) CalHash() []byte {
 	return Sha256(ConcatBytes([][]byte(*s)...))
 }
 
+//脚本序列化: 每个元素为 uvarint 长度 + 内容
+func (s *Script) Bytes() []byte {
+	r := make([]byte, 0)
+	for _, it := range *s {
+		r = appendUvarint(r, uint64(len(it)))
+		r = append(r, it...)
+	}
+	return r
+}
+
+func ParseScript(b []byte) (*Script, error) {
+	s := new(Script)
+	for len(b) > 0 {
+		l, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < l {
+			return nil, ErrWrapf("Invalid script bytes")
+		}
+		s.append(CopyBytes(b[n : n+int(l)]))
+		b = b[n+int(l):]
+	}
+	return s, nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, v)
+	return append(b, buf[:n]...)
+}
+
 //添加script
 func (s *Script) append(b []byte) {
 	*s = append(*s, b)
@@ -241,3 +241,18 @@ func TestNonceGen(t *testing.T) {
 	}
 }
 
+
+func TestScript_Bytes(t *testing.T) {
+	s := buildP2PKHOutput(getTestWallet().PublicKey())
+	s.append(make([]byte, 300))
+	parsed, err := ParseScript(s.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(parsed.CalHash()) != hex.EncodeToString(s.CalHash()) || len(*parsed) != len(*s) {
+		t.Fatal("script mismatch")
+	}
+	if _, err = ParseScript([]byte{5, 1}); err == nil {
+		t.Fatal("should fail")
+	}
+}
@@ -2,7 +2,10 @@ package core
 
 import (
 	"fmt"
+	"github.com/woodyDM/simple-block-chain/internal/metrics"
 	"math/big"
+	"sync"
+	"time"
 	"unicode/utf8"
 )
 
@@ -25,6 +28,12 @@ type BlockChain struct {
 	BlockHeights map[uint64]*Block
 	//
 	Current *Block
+	//区块连接/断开事件
+	Events *EventBus
+	//区块连接耗时(秒)
+	ConnectLatency *metrics.Histogram
+	//Append 与其他协程的查询之间的锁
+	mu sync.RWMutex
 }
 
 type TxDatabase struct {
@@ -43,6 +52,7 @@ type UtxoDatabase interface {
 	AddUtxo(u *Utxo)
 	GetUtxo(address string) []*Utxo
 	RemoveUtxo(u *Utxo) error
+	Count() int
 }
 
 type InMemUtxoDatabase struct {
@@ -68,6 +78,14 @@ func (i *InMemUtxoDatabase) GetUtxo(address string) []*Utxo {
 	return i.db[address]
 }
 
+func (i *InMemUtxoDatabase) Count() int {
+	n := 0
+	for _, it := range i.db {
+		n += len(it)
+	}
+	return n
+}
+
 func (i *InMemUtxoDatabase) RemoveUtxo(u *Utxo) error {
 	add := u.Address
 	m := make([]*Utxo, 0)
@@ -112,6 +130,9 @@ func Genesis(env *GlobalEnv) *BlockChain {
 		BlockHeights: make(map[uint64]*Block),
 		Env:          env,
 		UtxoDatabase: NewInMemUtxoDatabase(),
+		Events:       NewEventBus(),
+		//1ms ~ 4s
+		ConnectLatency: metrics.NewHistogram(metrics.ExponentialBuckets(0.001, 2, 13)),
 	}
 	block := genesisBlock()
 	e := chain.Append(block)
@@ -123,10 +144,21 @@ func Genesis(env *GlobalEnv) *BlockChain {
 
 // 区块链添加一个新的区块，并做简单校验
 func (c *BlockChain) Append(b *Block) error {
+	start := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	ec := checkWhenAppend(b)
 	if ec != nil {
 		return ec
 	}
+	//区块中的交易必须 final 且相对时间锁已满足
+	if b.Height != 0 {
+		for _, t := range b.Tx {
+			if err := c.checkTxLocks(t, b.Height, BlockUnixTime(b)); err != nil {
+				return ErrWrap("Invalid tx in block", err)
+			}
+		}
+	}
 	_, e := c.Blocks[b.Hash]
 	if e {
 		Log.Errorf("Same Block Hash found! %s ", b.Hash)
@@ -163,16 +195,152 @@ func (c *BlockChain) Append(b *Block) error {
 	}
 	for _, t := range b.Tx {
 		for _, o := range t.Outputs {
-			c.AddUtxo(newUtxo(o))
+			//OP_RETURN 输出永远不能花费，不放入utxo
+			if !o.Script.IsUnspendable() {
+				c.AddUtxo(newUtxo(o))
+			}
 		}
 	}
 	//set tx block hash
 	for _, t := range b.Tx {
 		t.BlockHash = b.Hash
 	}
+	c.ConnectLatency.Observe(time.Since(start).Seconds())
+	c.Events.Publish(&Event{Type: EventBlockConnected, Block: b})
 	return nil
 }
 
+//断开当前最高的区块，撤销它对utxo的修改，用于分叉切换
+func (c *BlockChain) DisconnectTip() (*Block, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.Current
+	if b.Height == 0 {
+		return nil, ErrWrapf("Can't disconnect genesis block")
+	}
+	pre, ok := c.Blocks[b.PreHash]
+	if !ok {
+		return nil, ErrWrapf("Pre block %s not found", b.PreHash)
+	}
+	for i := len(b.Tx) - 1; i >= 0; i-- {
+		t := b.Tx[i]
+		for _, o := range t.Outputs {
+			if o.Script.IsUnspendable() {
+				continue
+			}
+			if e := c.RemoveUtxo(newUtxo(o)); e != nil {
+				return nil, ErrWrap("utxo not exist", e)
+			}
+		}
+		for _, in := range t.Inputs {
+			c.AddUtxo(newUtxo(in.Output))
+		}
+		delete(c.Tx, t.Hash)
+		t.BlockHash = ""
+	}
+	delete(c.Blocks, b.Hash)
+	delete(c.BlockHeights, b.Height)
+	c.Current = pre
+	Log.Info("Disconnect block [", b.Height, "] ", b.Hash)
+	c.Events.Publish(&Event{Type: EventBlockDisconnected, Block: b})
+	return b, nil
+}
+
+// ==================================== Query ====================================
+func (c *BlockChain) GetBlock(hash string) (*Block, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	b, ok := c.Blocks[hash]
+	return b, ok
+}
+
+func (c *BlockChain) GetBlockByHeight(height uint64) (*Block, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	b, ok := c.BlockHeights[height]
+	return b, ok
+}
+
+func (c *BlockChain) Tip() *Block {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Current
+}
+
+func (c *BlockChain) GetTx(hash string) (*Transaction, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, ok := c.Tx[hash]
+	return t, ok
+}
+
+func (c *BlockChain) GetUtxo(address string) []*Utxo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.UtxoDatabase.GetUtxo(address)
+}
+
+//交易所在区块的高度，交易不在主链上时返回 false
+func (c *BlockChain) TxHeight(hash string) (uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, ok := c.Tx[hash]
+	if !ok {
+		return 0, false
+	}
+	b, ok := c.Blocks[t.BlockHash]
+	if !ok {
+		return 0, false
+	}
+	return b.Height, true
+}
+
+//utxo集合的大小
+func (c *BlockChain) UtxoCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.UtxoDatabase.Count()
+}
+
+//地址相关的所有链上交易(输入或输出中包含该地址)，按区块从新到旧排列
+func (c *BlockChain) AddressHistory(address string) []*Transaction {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r := make([]*Transaction, 0)
+	for h := int64(c.Current.Height); h >= 0; h-- {
+		b := c.BlockHeights[uint64(h)]
+		for _, t := range b.Tx {
+			if txHasAddress(t, address) {
+				r = append(r, t)
+			}
+		}
+	}
+	return r
+}
+
+func txHasAddress(t *Transaction, address string) bool {
+	for _, in := range t.Inputs {
+		if in.Output.Address == address {
+			return true
+		}
+	}
+	for _, o := range t.Outputs {
+		if o.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+//地址余额，所有utxo之和
+func (c *BlockChain) Balance(address string) int64 {
+	var total int64 = 0
+	for _, u := range c.GetUtxo(address) {
+		total += u.Fee
+	}
+	return total
+}
+
 //todo utxo checks
 func checkWhenAppend(b *Block) error {
 	if b.Nonce == "" {
@@ -247,6 +415,41 @@ func (c *BlockChain) NextDifficulty() string {
 	return newDiff
 }
 
+//难度值: 创世难度目标 / 当前难度目标
+func Difficulty(target string) float64 {
+	genesis, _ := new(big.Float).SetString("0x" + GenesisDiff)
+	cur, ok := new(big.Float).SetString("0x" + target)
+	if !ok || cur.Sign() == 0 {
+		return 0
+	}
+	r, _ := new(big.Float).Quo(genesis, cur).Float64()
+	return r
+}
+
+//根据最近 n 个区块估算全网每秒hash次数, 每个区块期望 hash 次数为 2^256 / 难度目标
+func (c *BlockChain) NetworkHashPs(n int) float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	last := c.Current
+	first := last
+	work := new(big.Float)
+	max := new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 256))
+	//创世区块时间戳单位不同，不参与计算
+	for i := 0; i < n && first.Height > 1; i++ {
+		target, ok := new(big.Float).SetString("0x" + first.Difficulty)
+		if ok && target.Sign() > 0 {
+			work.Add(work, new(big.Float).Quo(max, target))
+		}
+		first = c.Blocks[first.PreHash]
+	}
+	span := last.Timestamp - first.Timestamp
+	if span <= 0 {
+		return 0
+	}
+	r, _ := work.Quo(work, new(big.Float).SetInt64(span)).Float64()
+	return r
+}
+
 func diff(curDiff string, actualSpan, targetSpan int64) string {
 	////新的难度值 = 旧难度值 * （nActualTimespan/nTargetTimespan）
 	oldDiff, ok := new(big.Int).SetString(curDiff, 16)
@@ -120,3 +120,12 @@ func TestF(t *testing.T) {
 		t.Fatal("")
 	}
 }
+
+func TestDifficulty(t *testing.T) {
+	if Difficulty(GenesisDiff) != 1 {
+		t.Fatal("genesis 1")
+	}
+	if Difficulty("0007ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff") < 1.99 {
+		t.Fatal("half target should be 2")
+	}
+}
@@ -0,0 +1,246 @@
+package core
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ==================================== Coin Selection ====================================
+// 从地址的 utxo 中选出交易的输入，目标金额为转账金额加手续费
+// 每个 TxRequest 可以指定策略，不指定时使用 DefaultCoinSelector
+
+const (
+	CoinSelectLargest  = "largest"
+	CoinSelectSmallest = "smallest"
+	CoinSelectBnB      = "bnb"
+	CoinSelectRandom   = "random"
+	CoinSelectDefault  = "default"
+
+	//分支定界搜索的最大次数，与 Bitcoin Core 相同
+	DefaultBnBTries = 100000
+)
+
+var (
+	ErrInsufficientFunds = ErrWrapf("insufficient funds")
+	ErrNoExactMatch      = ErrWrapf("no exact match")
+
+	//先找不需要找零的组合，找不到时从大到小选择
+	DefaultCoinSelector CoinSelector = &FallbackSelector{
+		Selectors: []CoinSelector{&BranchAndBound{}, LargestFirst{}},
+	}
+)
+
+type CoinSelector interface {
+	//选出总额不少于 target 的 utxo，不会修改 utxos
+	Select(utxos []*Utxo, target int64) ([]*Utxo, error)
+}
+
+//从大到小选择，输入最少
+type LargestFirst struct{}
+
+//从小到大选择，合并零钱，但输入较多
+type SmallestFirst struct{}
+
+//分支定界，寻找总额在 [target, target+Tolerance] 之间的组合，这样不需要找零，多出的部分作为手续费
+type BranchAndBound struct {
+	Tolerance int64
+	//为 0 时使用 DefaultBnBTries
+	MaxTries int
+}
+
+//随机选择后再改进，使找零接近转账金额，钱包中的 utxo 金额分布与支付金额相近
+type RandomImprove struct {
+	//为空时使用以当前时间为种子的随机数
+	Rand *rand.Rand
+	mu   sync.Mutex
+}
+
+//依次尝试，返回第一个成功的结果
+type FallbackSelector struct {
+	Selectors []CoinSelector
+}
+
+// ==================================== func below ====================================
+
+//按名称创建策略，用于命令行和接口参数
+func ParseCoinSelector(name string) (CoinSelector, error) {
+	switch name {
+	case "", CoinSelectDefault:
+		return DefaultCoinSelector, nil
+	case CoinSelectLargest:
+		return LargestFirst{}, nil
+	case CoinSelectSmallest:
+		return SmallestFirst{}, nil
+	case CoinSelectBnB:
+		return &BranchAndBound{}, nil
+	case CoinSelectRandom:
+		return &RandomImprove{}, nil
+	}
+	return nil, ErrWrapf("unknown coin selector %s", name)
+}
+
+func sortedUtxo(utxos []*Utxo, desc bool) []*Utxo {
+	r := make([]*Utxo, len(utxos))
+	copy(r, utxos)
+	sort.SliceStable(r, func(i, j int) bool {
+		if desc {
+			return r[i].Fee > r[j].Fee
+		}
+		return r[i].Fee < r[j].Fee
+	})
+	return r
+}
+
+func sumUtxo(utxos []*Utxo) int64 {
+	var total int64 = 0
+	for _, it := range utxos {
+		total += it.Fee
+	}
+	return total
+}
+
+func (LargestFirst) Select(utxos []*Utxo, target int64) ([]*Utxo, error) {
+	if r := pickUtxo(sortedUtxo(utxos, true), target); r != nil {
+		return r, nil
+	}
+	return nil, ErrInsufficientFunds
+}
+
+func (SmallestFirst) Select(utxos []*Utxo, target int64) ([]*Utxo, error) {
+	if r := pickUtxo(sortedUtxo(utxos, false), target); r != nil {
+		return r, nil
+	}
+	return nil, ErrInsufficientFunds
+}
+
+//按金额从大到小深度优先搜索，每个 utxo 选或不选
+//当前总额超出上限，或加上剩余全部也达不到目标时剪枝
+func (b *BranchAndBound) Select(utxos []*Utxo, target int64) ([]*Utxo, error) {
+	sorted := sortedUtxo(utxos, true)
+	if sumUtxo(sorted) < target {
+		return nil, ErrInsufficientFunds
+	}
+	tries := b.MaxTries
+	if tries <= 0 {
+		tries = DefaultBnBTries
+	}
+	upper := target + b.Tolerance
+	//remain[i] 为 sorted[i:] 的总额
+	remain := make([]int64, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remain[i] = remain[i+1] + sorted[i].Fee
+	}
+	selected := make([]bool, len(sorted))
+	var best []bool
+	var bestExcess int64 = -1
+	var search func(i int, total int64) bool
+	search = func(i int, total int64) bool {
+		if tries--; tries < 0 {
+			return true
+		}
+		if total > upper || total+remain[i] < target {
+			return false
+		}
+		if total >= target {
+			if excess := total - target; bestExcess < 0 || excess < bestExcess {
+				bestExcess = excess
+				best = append(best[:0], selected...)
+			}
+			//恰好相等时不可能更好
+			return bestExcess == 0
+		}
+		if i == len(sorted) {
+			return false
+		}
+		selected[i] = true
+		if search(i+1, total+sorted[i].Fee) {
+			return true
+		}
+		selected[i] = false
+		return search(i+1, total)
+	}
+	search(0, 0)
+	if best == nil {
+		return nil, ErrNoExactMatch
+	}
+	r := make([]*Utxo, 0)
+	for i, it := range best {
+		if it {
+			r = append(r, sorted[i])
+		}
+	}
+	return r, nil
+}
+
+//找零不超过这个金额时并入手续费，分支定界在容差内找到的组合因此不会产生找零
+func changeTolerance(s CoinSelector) int64 {
+	switch v := s.(type) {
+	case *BranchAndBound:
+		return v.Tolerance
+	case *FallbackSelector:
+		var r int64 = 0
+		for _, it := range v.Selectors {
+			if t := changeTolerance(it); t > r {
+				r = t
+			}
+		}
+		return r
+	}
+	return 0
+}
+
+func (r *RandomImprove) rand() *rand.Rand {
+	if r.Rand == nil {
+		r.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return r.Rand
+}
+
+//第一步随机选择直到达到目标；第二步继续随机加入 utxo，只要总额更接近 2*target 且不超过 3*target
+func (r *RandomImprove) Select(utxos []*Utxo, target int64) ([]*Utxo, error) {
+	if sumUtxo(utxos) < target {
+		return nil, ErrInsufficientFunds
+	}
+	r.mu.Lock()
+	order := r.rand().Perm(len(utxos))
+	r.mu.Unlock()
+	selected := make([]*Utxo, 0)
+	var total int64 = 0
+	i := 0
+	for ; total < target; i++ {
+		u := utxos[order[i]]
+		selected = append(selected, u)
+		total += u.Fee
+	}
+	ideal, limit := 2*target, 3*target
+	for ; i < len(order); i++ {
+		u := utxos[order[i]]
+		next := total + u.Fee
+		if next > limit || abs64(ideal-next) >= abs64(ideal-total) {
+			continue
+		}
+		selected = append(selected, u)
+		total = next
+	}
+	return selected, nil
+}
+
+func abs64(i int64) int64 {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+func (f *FallbackSelector) Select(utxos []*Utxo, target int64) ([]*Utxo, error) {
+	var err error = ErrInsufficientFunds
+	for _, it := range f.Selectors {
+		var r []*Utxo
+		if r, err = it.Select(utxos, target); err == nil {
+			return r, nil
+		}
+	}
+	return nil, err
+}
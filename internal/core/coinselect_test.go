@@ -0,0 +1,172 @@
+package core
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func testUtxos(fees ...int64) []*Utxo {
+	r := make([]*Utxo, 0, len(fees))
+	for i, it := range fees {
+		r = append(r, uxto("a", "h"+strconv.Itoa(i), 0, it))
+	}
+	return r
+}
+
+func feesOf(us []*Utxo) []int64 {
+	r := make([]int64, 0, len(us))
+	for _, it := range us {
+		r = append(r, it.Fee)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return r
+}
+
+func sameFees(a []int64, b ...int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCoinSelectors(t *testing.T) {
+	us := testUtxos(10, 40, 20, 30, 5)
+	r, err := LargestFirst{}.Select(us, 55)
+	if err != nil || !sameFees(feesOf(r), 30, 40) {
+		t.Fatal("largest", feesOf(r), err)
+	}
+	r, err = SmallestFirst{}.Select(us, 30)
+	if err != nil || !sameFees(feesOf(r), 5, 10, 20) {
+		t.Fatal("smallest", feesOf(r), err)
+	}
+	//55 = 40 + 10 + 5 或 30 + 20 + 5，不需要找零
+	r, err = (&BranchAndBound{}).Select(us, 55)
+	if err != nil || sumUtxo(r) != 55 {
+		t.Fatal("bnb", feesOf(r), err)
+	}
+	if _, err = (&BranchAndBound{}).Select(us, 56); err != ErrNoExactMatch {
+		t.Fatal("bnb no match", err)
+	}
+	r, err = (&BranchAndBound{Tolerance: 4}).Select(us, 56)
+	if err != nil || sumUtxo(r) > 60 || sumUtxo(r) < 56 {
+		t.Fatal("bnb tolerance", feesOf(r), err)
+	}
+	//默认策略找不到精确组合时从大到小选择
+	r, err = DefaultCoinSelector.Select(us, 56)
+	if err != nil || !sameFees(feesOf(r), 30, 40) {
+		t.Fatal("default", feesOf(r), err)
+	}
+	ri := &RandomImprove{Rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 20; i++ {
+		r, err = ri.Select(us, 25)
+		if err != nil || sumUtxo(r) < 25 || sumUtxo(r) > 75 {
+			t.Fatal("random improve", feesOf(r), err)
+		}
+	}
+	for _, name := range []string{CoinSelectLargest, CoinSelectSmallest, CoinSelectBnB, CoinSelectRandom, CoinSelectDefault} {
+		s, err := ParseCoinSelector(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = s.Select(us, 106); err != ErrInsufficientFunds {
+			t.Fatal(name, "should be insufficient", err)
+		}
+		if len(us) != 5 || us[0].Fee != 10 {
+			t.Fatal(name, "should not modify input")
+		}
+	}
+	if _, err = ParseCoinSelector("nope"); err == nil {
+		t.Fatal("unknown selector")
+	}
+}
+
+func TestTxPool_TxFee(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	w2 := getTestWallet2()
+	req := w1.Request(w2.Address(), 10, "")
+	req.TxFee = 3
+	req.Selector = LargestFirst{}
+	resp := pool.Transform(req)
+	if resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	if resp.tx.TxFee() != 3 || resp.tx.Outputs[0].Fee != GenesisCoinCount-13 {
+		t.Fatal("tx fee", resp.tx.TxFee())
+	}
+	m := &Miner{p: pool, w: getTestWallet_(9)}
+	coinbase := m.createNewBlockTx([]*Transaction{resp.tx})[0]
+	if coinbase.Outputs[0].Fee != CoinBaseCount+3 {
+		t.Fatal("miner should get tx fee")
+	}
+	//分支定界容差内多出的金额作为手续费，不找零
+	req = w2.Request(w1.Address(), GenesisCoinCount-5, "")
+	req.TxFee = 1
+	req.Selector = &BranchAndBound{Tolerance: 4}
+	if resp = pool.Transform(req); resp.err != nil || len(resp.tx.Outputs) != 1 || resp.tx.TxFee() != 5 {
+		t.Fatal("bnb tolerance to fee", resp.err)
+	}
+	//金额加手续费超过余额
+	req = w2.Request(w1.Address(), GenesisCoinCount, "")
+	req.TxFee = 1
+	if resp = pool.Transform(req); resp.err == nil {
+		t.Fatal("should be insufficient")
+	}
+}
+
+//模拟钱包长期收付款后 utxo 集合的碎片化程度
+func BenchmarkCoinSelection(b *testing.B) {
+	selectors := []string{CoinSelectLargest, CoinSelectSmallest, CoinSelectBnB, CoinSelectRandom, CoinSelectDefault}
+	for _, name := range selectors {
+		b.Run(name, func(b *testing.B) {
+			var utxoCount, changeCount, inputCount, rounds float64
+			for n := 0; n < b.N; n++ {
+				s, _ := ParseCoinSelector(name)
+				if ri, ok := s.(*RandomImprove); ok {
+					ri.Rand = rand.New(rand.NewSource(int64(n)))
+				}
+				rnd := rand.New(rand.NewSource(int64(n)))
+				us := testUtxos(1000)
+				for i := 0; i < 500; i++ {
+					//每三次付款收到一笔钱
+					if i%3 == 0 {
+						us = append(us, uxto("a", "in"+strconv.Itoa(i), 0, 50+rnd.Int63n(500)))
+					}
+					amount := 1 + rnd.Int63n(200)
+					r, err := s.Select(us, amount)
+					if err != nil {
+						continue
+					}
+					us = removeUtxos(us, r)
+					inputCount += float64(len(r))
+					if change := sumUtxo(r) - amount; change > 0 {
+						us = append(us, uxto("a", "change"+strconv.Itoa(i), 0, change))
+						changeCount++
+					}
+					rounds++
+				}
+				utxoCount += float64(len(us))
+			}
+			b.ReportMetric(utxoCount/float64(b.N), "utxos")
+			b.ReportMetric(inputCount/rounds, "inputs/tx")
+			b.ReportMetric(changeCount/rounds, "change/tx")
+		})
+	}
+}
+
+func removeUtxos(us []*Utxo, remove []*Utxo) []*Utxo {
+	r := make([]*Utxo, 0, len(us))
+	for _, it := range us {
+		if !containsUtxo(remove, it) {
+			r = append(r, it)
+		}
+	}
+	return r
+}
@@ -0,0 +1,280 @@
+package core
+
+import (
+	"encoding/hex"
+	"encoding/json"
+)
+
+// ==================================== Compact Block ====================================
+// 参考 BIP152 https://github.com/bitcoin/bips/blob/master/bip-0152.mediawiki
+// 节点之间转发区块时，对方交易池中通常已经有了区块中的大部分交易，
+// 所以只发送区块头、每个交易的短ID以及预先填充的coinbase交易。
+// 接收方用自己的交易池重建区块，只按下标请求缺少的交易。
+
+const (
+	ShortTxIdLen = 6 //短交易ID 6 byte
+)
+
+//区块头，即区块中除交易以外的字段
+type BlockHeader struct {
+	Timestamp      int64
+	Hash           string
+	Nonce          string
+	PreHash        string
+	Height         uint64
+	TxCount        int
+	PreTxSum       int64
+	PreOutputSum   int64
+	MerkleTreeRoot string
+	Difficulty     string
+}
+
+type CompactBlock struct {
+	Header *BlockHeader
+	//计算短ID用的盐，每次发送随机生成
+	Salt int64
+	//没有预填充的交易的短ID，按交易在区块中的顺序排列
+	ShortIds []string
+	//预填充的交易,至少包含coinbase
+	Prefilled []*PrefilledTx
+}
+
+type PrefilledTx struct {
+	//交易在区块中的下标
+	Index int
+	Tx    *Transaction
+}
+
+//请求区块中缺少的交易
+type GetBlockTxn struct {
+	BlockHash string
+	Indexes   []int
+}
+
+//GetBlockTxn 的响应，Tx 与请求的 Indexes 一一对应
+type BlockTxn struct {
+	BlockHash string
+	Tx        []*Transaction
+}
+
+//从 CompactBlock 重建中的区块
+type PartialBlock struct {
+	cb  *CompactBlock
+	txs []*Transaction
+}
+
+// ==================================== func below ====================================
+
+func (b *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		Timestamp:      b.Timestamp,
+		Hash:           b.Hash,
+		Nonce:          b.Nonce,
+		PreHash:        b.PreHash,
+		Height:         b.Height,
+		TxCount:        b.TxCount,
+		PreTxSum:       b.PreTxSum,
+		PreOutputSum:   b.PreOutputSum,
+		MerkleTreeRoot: b.MerkleTreeRoot,
+		Difficulty:     b.Difficulty,
+	}
+}
+
+func (h *BlockHeader) toBlock(tx []*Transaction) *Block {
+	return &Block{
+		Timestamp:      h.Timestamp,
+		Hash:           h.Hash,
+		Nonce:          h.Nonce,
+		PreHash:        h.PreHash,
+		Tx:             tx,
+		Height:         h.Height,
+		TxCount:        h.TxCount,
+		PreTxSum:       h.PreTxSum,
+		PreOutputSum:   h.PreOutputSum,
+		MerkleTreeRoot: h.MerkleTreeRoot,
+		Difficulty:     h.Difficulty,
+	}
+}
+
+//短ID = SHA256(key || txHash) 的前6个字节, key = SHA256(blockHash || salt)
+func shortIdKey(blockHash string, salt int64) []byte {
+	hashBytes, _ := hex.DecodeString(blockHash)
+	return Sha256(ConcatBytes(hashBytes, Int64ToBytes(salt)))
+}
+
+func shortTxId(key []byte, txHash string) string {
+	hashBytes, _ := hex.DecodeString(txHash)
+	return hex.EncodeToString(Sha256(ConcatBytes(key, hashBytes))[:ShortTxIdLen])
+}
+
+//coinbase 接收方的交易池中不可能存在，总是预填充
+func NewCompactBlock(b *Block, salt int64) *CompactBlock {
+	cb := &CompactBlock{
+		Header:    b.Header(),
+		Salt:      salt,
+		ShortIds:  make([]string, 0, len(b.Tx)),
+		Prefilled: make([]*PrefilledTx, 0),
+	}
+	key := shortIdKey(b.Hash, salt)
+	for i, tx := range b.Tx {
+		if i == 0 {
+			cb.Prefilled = append(cb.Prefilled, &PrefilledTx{Index: i, Tx: tx})
+			continue
+		}
+		cb.ShortIds = append(cb.ShortIds, shortTxId(key, tx.Hash))
+	}
+	return cb
+}
+
+//使用交易池中的交易重建区块
+func (cb *CompactBlock) Rebuild(pool []*Transaction) (*PartialBlock, error) {
+	h := cb.Header
+	if h == nil {
+		return nil, ErrWrapf("Compact block without header")
+	}
+	if len(cb.ShortIds)+len(cb.Prefilled) != h.TxCount {
+		return nil, ErrWrapf("Compact block %s tx count mismatch", h.Hash)
+	}
+	txs := make([]*Transaction, h.TxCount)
+	for _, it := range cb.Prefilled {
+		if it.Index < 0 || it.Index >= h.TxCount || txs[it.Index] != nil || it.Tx == nil {
+			return nil, ErrWrapf("Compact block %s invalid prefilled index %d", h.Hash, it.Index)
+		}
+		if err := checkTxHash(it.Tx); err != nil {
+			return nil, ErrWrap("Compact block "+h.Hash+" invalid prefilled tx", err)
+		}
+		txs[it.Index] = it.Tx
+	}
+	key := shortIdKey(h.Hash, cb.Salt)
+	poolIds := make(map[string]*Transaction)
+	for _, tx := range pool {
+		id := shortTxId(key, tx.Hash)
+		if exist, ok := poolIds[id]; ok && exist.Hash != tx.Hash {
+			//短ID碰撞, 无法确定是哪一个交易，留给调用方请求完整区块
+			return nil, ErrWrapf("Short id collision %s in compact block %s", id, h.Hash)
+		}
+		poolIds[id] = tx
+	}
+	next := 0
+	for i := range txs {
+		if txs[i] != nil {
+			continue
+		}
+		txs[i] = poolIds[cb.ShortIds[next]]
+		next++
+	}
+	return &PartialBlock{cb: cb, txs: txs}, nil
+}
+
+//还缺少的交易下标
+func (pb *PartialBlock) Missing() []int {
+	r := make([]int, 0)
+	for i, tx := range pb.txs {
+		if tx == nil {
+			r = append(r, i)
+		}
+	}
+	return r
+}
+
+func (pb *PartialBlock) MissingRequest() *GetBlockTxn {
+	return &GetBlockTxn{
+		BlockHash: pb.cb.Header.Hash,
+		Indexes:   pb.Missing(),
+	}
+}
+
+//填充对方返回的缺少的交易
+func (pb *PartialBlock) Fill(resp *BlockTxn) error {
+	if resp.BlockHash != pb.cb.Header.Hash {
+		return ErrWrapf("Block txn for %s, expect %s", resp.BlockHash, pb.cb.Header.Hash)
+	}
+	missing := pb.Missing()
+	if len(missing) != len(resp.Tx) {
+		return ErrWrapf("Block txn size %d, expect %d", len(resp.Tx), len(missing))
+	}
+	key := shortIdKey(pb.cb.Header.Hash, pb.cb.Salt)
+	for i, idx := range missing {
+		tx := resp.Tx[i]
+		if tx == nil {
+			return ErrWrapf("Block txn tx at index %d mismatch", idx)
+		}
+		if err := checkTxHash(tx); err != nil {
+			return ErrWrap("Block txn invalid tx", err)
+		}
+		if shortTxId(key, tx.Hash) != pb.shortIdAt(idx) {
+			return ErrWrapf("Block txn tx at index %d mismatch", idx)
+		}
+		pb.txs[idx] = tx
+	}
+	return nil
+}
+
+//对方发来的交易 hash 不可信，短ID 和 Merkle 根都要用重新计算的 hash
+func checkTxHash(tx *Transaction) error {
+	claimed := tx.Hash
+	if err := tx.UpdateHash(); err != nil {
+		return err
+	}
+	if tx.Hash != claimed {
+		return ErrWrapf("Tx hash %s mismatch, calculated %s", claimed, tx.Hash)
+	}
+	return nil
+}
+
+func (pb *PartialBlock) shortIdAt(idx int) string {
+	prefilled := 0
+	for _, it := range pb.cb.Prefilled {
+		if it.Index < idx {
+			prefilled++
+		}
+	}
+	return pb.cb.ShortIds[idx-prefilled]
+}
+
+//所有交易都已填充后得到完整区块, 并校验 Merkle 根
+func (pb *PartialBlock) Block() (*Block, error) {
+	if m := pb.Missing(); len(m) != 0 {
+		return nil, ErrWrapf("Block %s still missing %d tx", pb.cb.Header.Hash, len(m))
+	}
+	txs := make([]*Transaction, len(pb.txs))
+	copy(txs, pb.txs)
+	b := pb.cb.Header.toBlock(txs)
+	expect := b.MerkleTreeRoot
+	err := b.updateMerk()
+	if err != nil {
+		return nil, err
+	}
+	if b.MerkleTreeRoot != expect {
+		return nil, ErrWrapf("Merkle root mismatch in rebuilt block %s", b.Hash)
+	}
+	return b, nil
+}
+
+//响应对方缺少交易的请求
+func (c *BlockChain) BlockTxn(req *GetBlockTxn) (*BlockTxn, error) {
+	b, ok := c.GetBlock(req.BlockHash)
+	if !ok {
+		return nil, ErrWrapf("Block %s not found", req.BlockHash)
+	}
+	r := &BlockTxn{
+		BlockHash: b.Hash,
+		Tx:        make([]*Transaction, 0, len(req.Indexes)),
+	}
+	for _, idx := range req.Indexes {
+		if idx < 0 || idx >= len(b.Tx) {
+			return nil, ErrWrapf("Block %s out of index [%d] of total [%d]", b.Hash, idx, len(b.Tx))
+		}
+		r.Tx = append(r.Tx, b.Tx[idx])
+	}
+	return r, nil
+}
+
+//节点间消息的编码
+func EncodeMessage(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func DecodeMessage(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestBlock(t testing.TB, pool *TxPool) *Block {
+	for i := 0; i < 9; i++ {
+		w := getTestWallet_(i)
+		resp := w.Transform(pool, getTestWallet_(i+1).Address(), int64(i+1), "compact")
+		if resp.err != nil {
+			t.Fatal(resp.err)
+		}
+	}
+	m := &Miner{p: pool, w: getTestWallet_(9)}
+	txs := make([]*Transaction, 0)
+	for i := 0; i < 9; i++ {
+		txs = append(txs, <-pool.txCh)
+	}
+	b, err := pool.Chain.NewBlock(m.createNewBlockTx(txs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		r := b.TryHash()
+		if r.Ok {
+			b.UpdateHash(r)
+			break
+		}
+	}
+	return b
+}
+
+func TestCompactBlock_Rebuild(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	b := newTestBlock(t, pool)
+	msg, err := EncodeMessage(NewCompactBlock(b, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb := new(CompactBlock)
+	if err = DecodeMessage(msg, cb); err != nil {
+		t.Fatal(err)
+	}
+	if len(cb.Prefilled) != 1 || cb.Prefilled[0].Index != 0 {
+		t.Fatal("coinbase should be prefilled")
+	}
+	if len(cb.ShortIds) != len(b.Tx)-1 {
+		t.Fatal("short id len")
+	}
+	//接收方交易池中少了下标 3 和 5 的交易
+	known := make([]*Transaction, 0)
+	for i, tx := range b.Tx[1:] {
+		if i+1 != 3 && i+1 != 5 {
+			known = append(known, tx)
+		}
+	}
+	pb, err := cb.Rebuild(known)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := pb.Missing()
+	if len(missing) != 2 || missing[0] != 3 || missing[1] != 5 {
+		t.Fatal("missing should be 3,5", missing)
+	}
+	if _, err = pb.Block(); err == nil {
+		t.Fatal("should not build with missing tx")
+	}
+	resp, err := pool.Chain.BlockTxn(&GetBlockTxn{BlockHash: b.Hash, Indexes: missing})
+	if err == nil {
+		t.Fatal("block not appended yet")
+	}
+	if err = pool.Chain.Append(b); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = pool.Chain.BlockTxn(pb.MissingRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pb.Fill(resp); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := pb.Block()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Hash != b.Hash || rebuilt.MerkleTreeRoot != b.MerkleTreeRoot || len(rebuilt.Tx) != len(b.Tx) {
+		t.Fatal("rebuilt block mismatch")
+	}
+	if checkWhenAppend(rebuilt) != nil {
+		t.Fatal("rebuilt block should be valid")
+	}
+}
+
+func TestCompactBlock_FillMismatch(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	b := newTestBlock(t, pool)
+	pb, err := NewCompactBlock(b, 1).Rebuild(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pb.Missing()) != len(b.Tx)-1 {
+		t.Fatal("all except coinbase missing")
+	}
+	wrong := &BlockTxn{BlockHash: b.Hash, Tx: b.Tx[:len(b.Tx)-1]}
+	if err = pb.Fill(wrong); err == nil {
+		t.Fatal("should reject wrong tx")
+	}
+}
+
+//交易内容被替换但保留原来的 hash
+func TestCompactBlock_TamperedTx(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	b := newTestBlock(t, pool)
+	tamper := func(tx *Transaction) *Transaction {
+		raw, _ := EncodeRawTx(tx)
+		c, _ := DecodeRawTx(raw)
+		c.Outputs[0].Fee += 1
+		c.Hash = tx.Hash
+		return c
+	}
+	cb := NewCompactBlock(b, 3)
+	cb.Prefilled[0].Tx = tamper(b.Tx[0])
+	if _, err := cb.Rebuild(nil); err == nil || !strings.Contains(err.Error(), "calculated") {
+		t.Fatal(err)
+	}
+	pb, err := NewCompactBlock(b, 3).Rebuild(b.Tx[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pb.Fill(&BlockTxn{BlockHash: b.Hash, Tx: []*Transaction{tamper(b.Tx[1])}}); err == nil || !strings.Contains(err.Error(), "calculated") {
+		t.Fatal(err)
+	}
+	if _, err = pb.Block(); err == nil {
+		t.Fatal("block with tampered tx")
+	}
+}
+
+func TestTxPool_PendingTx(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	b := newTestBlock(t, pool)
+	if len(pool.PendingTx()) != 9 {
+		t.Fatal("pending 9")
+	}
+	if err := pool.Chain.Append(b); err != nil {
+		t.Fatal(err)
+	}
+	pool.receiveBlock(b)
+	if len(pool.PendingTx()) != 0 {
+		t.Fatal("pending should be cleared")
+	}
+}
+
+func BenchmarkCompactBlockRelay(b *testing.B) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	block := newTestBlock(b, pool)
+	pending := pool.PendingTx()
+	var full, compact int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fb, _ := EncodeMessage(block)
+		cb := NewCompactBlock(block, int64(i))
+		cbBytes, _ := EncodeMessage(cb)
+		pb, err := cb.Rebuild(pending)
+		if err != nil || len(pb.Missing()) != 0 {
+			b.Fatal("rebuild fail", err)
+		}
+		full, compact = len(fb), len(cbBytes)
+	}
+	b.ReportMetric(float64(full), "full-bytes")
+	b.ReportMetric(float64(compact), "compact-bytes")
+}
@@ -0,0 +1,226 @@
+package core
+
+import "sync"
+
+// ==================================== Event ====================================
+// 区块链和交易池内部的事件总线，订阅方可以按事件类型和地址过滤
+// 发布不会阻塞，订阅方处理不过来时丢弃事件
+// 不能丢失事件的订阅方(钱包、手续费估算)使用 SubscribeUnbounded，事件在无界队列中等待
+
+type EventType string
+
+const (
+	EventBlockConnected    EventType = "block_connected"
+	EventBlockDisconnected EventType = "block_disconnected"
+	EventTxAccepted        EventType = "tx_accepted"
+	EventTxEvicted         EventType = "tx_evicted"
+
+	DefaultEventBuffer = 64
+)
+
+type Event struct {
+	Type EventType
+	//区块事件
+	Block *Block
+	//交易事件
+	Tx *Transaction
+	//交易被移出交易池的原因
+	Reason string
+}
+
+//为空的条件表示不过滤
+type EventFilter struct {
+	Types     map[EventType]bool
+	Addresses map[string]bool
+}
+
+type EventBus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]bool
+}
+
+type Subscription struct {
+	C      <-chan *Event
+	ch     chan *Event
+	filter *EventFilter
+	bus    *EventBus
+	once   sync.Once
+	//无界订阅: 发布时放入 queue，由 forward 协程转发到 ch
+	unbounded bool
+	qmu       sync.Mutex
+	queue     []*Event
+	notify    chan bool
+	quit      chan bool
+}
+
+// ==================================== func below ====================================
+
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[*Subscription]bool)}
+}
+
+func NewEventFilter(types []EventType, addresses []string) *EventFilter {
+	f := &EventFilter{
+		Types:     make(map[EventType]bool),
+		Addresses: make(map[string]bool),
+	}
+	for _, it := range types {
+		f.Types[it] = true
+	}
+	for _, it := range addresses {
+		f.Addresses[it] = true
+	}
+	return f
+}
+
+//事件涉及的所有地址: 交易的输入和输出地址
+func (e *Event) Addresses() []string {
+	r := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(t *Transaction) {
+		for _, in := range t.Inputs {
+			if in.Output != nil && !seen[in.Output.Address] {
+				seen[in.Output.Address] = true
+				r = append(r, in.Output.Address)
+			}
+		}
+		for _, o := range t.Outputs {
+			if !seen[o.Address] {
+				seen[o.Address] = true
+				r = append(r, o.Address)
+			}
+		}
+	}
+	if e.Tx != nil {
+		add(e.Tx)
+	}
+	if e.Block != nil {
+		for _, t := range e.Block.Tx {
+			add(t)
+		}
+	}
+	return r
+}
+
+func (f *EventFilter) Match(e *Event) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Types) != 0 && !f.Types[e.Type] {
+		return false
+	}
+	if len(f.Addresses) == 0 {
+		return true
+	}
+	for _, it := range e.Addresses() {
+		if f.Addresses[it] {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *EventBus) Subscribe(f *EventFilter, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+	ch := make(chan *Event, buffer)
+	s := &Subscription{
+		C:      ch,
+		ch:     ch,
+		filter: f,
+		bus:    b,
+	}
+	b.mu.Lock()
+	b.subs[s] = true
+	b.mu.Unlock()
+	return s
+}
+
+//不丢弃事件的订阅，处理慢时事件在队列中等待
+func (b *EventBus) SubscribeUnbounded(f *EventFilter) *Subscription {
+	ch := make(chan *Event)
+	s := &Subscription{
+		C:         ch,
+		ch:        ch,
+		filter:    f,
+		bus:       b,
+		unbounded: true,
+		notify:    make(chan bool, 1),
+		quit:      make(chan bool),
+	}
+	go s.forward()
+	b.mu.Lock()
+	b.subs[s] = true
+	b.mu.Unlock()
+	return s
+}
+
+func (s *Subscription) push(e *Event) {
+	s.qmu.Lock()
+	s.queue = append(s.queue, e)
+	s.qmu.Unlock()
+	select {
+	case s.notify <- true:
+	default:
+	}
+}
+
+//按发布顺序把队列中的事件转发到 C，取消订阅后关闭 C
+func (s *Subscription) forward() {
+	defer close(s.ch)
+	for {
+		s.qmu.Lock()
+		q := s.queue
+		s.queue = nil
+		s.qmu.Unlock()
+		for _, e := range q {
+			select {
+			case s.ch <- e:
+			case <-s.quit:
+				return
+			}
+		}
+		select {
+		case <-s.notify:
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+//取消订阅并关闭 C
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		if s.unbounded {
+			close(s.quit)
+		} else {
+			close(s.ch)
+		}
+		s.bus.mu.Unlock()
+	})
+}
+
+func (b *EventBus) Publish(e *Event) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subs {
+		if !s.filter.Match(e) {
+			continue
+		}
+		if s.unbounded {
+			s.push(e)
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			Log.Debug("Event subscriber too slow, drop event ", e.Type)
+		}
+	}
+}
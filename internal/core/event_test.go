@@ -0,0 +1,135 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestEventBus_Filter(t *testing.T) {
+	bus := NewEventBus()
+	w1 := getTestWallet()
+	w2 := getTestWallet2()
+	all := bus.Subscribe(nil, 10)
+	onlyTx := bus.Subscribe(NewEventFilter([]EventType{EventTxAccepted}, nil), 10)
+	onlyW2 := bus.Subscribe(NewEventFilter(nil, []string{w2.Address()}), 10)
+	tx := &Transaction{Outputs: []*Output{{Address: w1.Address()}}}
+	bus.Publish(&Event{Type: EventTxAccepted, Tx: tx})
+	bus.Publish(&Event{Type: EventBlockConnected, Block: &Block{Tx: []*Transaction{tx}}})
+	if len(all.C) != 2 || len(onlyTx.C) != 1 || len(onlyW2.C) != 0 {
+		t.Fatal("filter fail")
+	}
+	tx2 := &Transaction{Inputs: []*Input{{Output: &Output{Address: w2.Address()}}}}
+	bus.Publish(&Event{Type: EventTxEvicted, Tx: tx2})
+	e := <-onlyW2.C
+	if e.Type != EventTxEvicted {
+		t.Fatal("address from input should match")
+	}
+	all.Unsubscribe()
+	all.Unsubscribe()
+	bus.Publish(&Event{Type: EventTxAccepted, Tx: tx})
+	if len(bus.subs) != 2 {
+		t.Fatal("should unsubscribe")
+	}
+	//订阅方处理不过来时丢弃，不阻塞
+	for i := 0; i < 20; i++ {
+		bus.Publish(&Event{Type: EventTxAccepted, Tx: tx})
+	}
+	if len(onlyTx.C) != 10 {
+		t.Fatal("buffer full")
+	}
+}
+
+func TestEventBus_SubscribeUnbounded(t *testing.T) {
+	bus := NewEventBus()
+	sub := bus.SubscribeUnbounded(NewEventFilter([]EventType{EventTxAccepted}, nil))
+	bus.Publish(&Event{Type: EventBlockConnected, Block: &Block{}})
+	//没有接收方时发布也不阻塞，事件不丢弃
+	txs := make([]*Transaction, 1000)
+	for i := range txs {
+		txs[i] = &Transaction{}
+		bus.Publish(&Event{Type: EventTxAccepted, Tx: txs[i]})
+	}
+	for i := range txs {
+		if e := <-sub.C; e.Tx != txs[i] {
+			t.Fatal("event order", i)
+		}
+	}
+	bus.Publish(&Event{Type: EventTxAccepted, Tx: txs[0]})
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	for range sub.C {
+	}
+	if len(bus.subs) != 0 {
+		t.Fatal("should unsubscribe")
+	}
+}
+
+func TestBlockChain_Events(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	sub := pool.Chain.Events.Subscribe(nil, 100)
+	b := newTestBlock(t, pool)
+	for i := 0; i < 9; i++ {
+		e := <-sub.C
+		if e.Type != EventTxAccepted || e.Tx == nil {
+			t.Fatal("tx accepted")
+		}
+	}
+	if err := pool.Chain.Append(b); err != nil {
+		t.Fatal(err)
+	}
+	e := <-sub.C
+	if e.Type != EventBlockConnected || e.Block != b {
+		t.Fatal("block connected")
+	}
+	w := getTestWallet()
+	if pool.Chain.Balance(w.Address()) != 99 {
+		t.Fatal("balance after block", pool.Chain.Balance(w.Address()))
+	}
+	d, err := pool.Chain.DisconnectTip()
+	if err != nil || d != b {
+		t.Fatal("disconnect", err)
+	}
+	e = <-sub.C
+	if e.Type != EventBlockDisconnected || e.Block != b {
+		t.Fatal("block disconnected")
+	}
+	if pool.Chain.Tip().Height != 0 || pool.Chain.Balance(w.Address()) != GenesisCoinCount {
+		t.Fatal("utxo should be restored")
+	}
+	if _, ok := pool.Chain.GetTx(b.Tx[1].Hash); ok {
+		t.Fatal("tx should be removed")
+	}
+	if _, err = pool.Chain.DisconnectTip(); err == nil {
+		t.Fatal("can't disconnect genesis")
+	}
+	//可以重新连接
+	if err = pool.Chain.Append(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxPool_EvictConflicts(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	sub := pool.Chain.Events.Subscribe(NewEventFilter([]EventType{EventTxEvicted}, nil), 10)
+	w1 := getTestWallet()
+	w2 := getTestWallet2()
+	resp := w1.Transform(pool, w2.Address(), 10, "pending")
+	if resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	<-pool.txCh
+	//其他节点打包了花费同一utxo的交易
+	prev, _ := pool.Chain.GetTx(pool.Chain.GetUtxo(w1.Address())[0].TxHash)
+	conflict, err := BuildTx(prev.Outputs, w1.Request(w2.Address(), 20, "other"), MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &Block{Hash: "b", Tx: []*Transaction{conflict}}
+	pool.receiveBlock(block)
+	e := <-sub.C
+	if e.Tx.Hash != resp.tx.Hash || e.Reason == "" {
+		t.Fatal("should evict")
+	}
+	if len(pool.PendingTx()) != 0 || len(pool.usedUtxo.GetUtxo(w1.Address())) != 0 {
+		t.Fatal("pending cleared")
+	}
+}
@@ -0,0 +1,401 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ==================================== Fee Estimator ====================================
+// 按费率分桶，统计交易池中的交易从进入交易池到被打包经过的区块数
+// 估算时从高费率向低费率累加桶，直到在目标区块数内确认的比例低于要求，返回最后一组满足要求的桶的平均费率
+// 因冲突被移出交易池的交易，以及在交易池中等待超过目标区块数的交易，都算作未能在目标内确认
+// 历史数据每个区块按比例衰减：短周期反应快，用于 economical；长周期更稳定，用于 conservative
+// 统计数据保存为 json 文件，重启后继续使用
+
+type FeeEstimateMode string
+
+const (
+	FeeConservative FeeEstimateMode = "conservative"
+	FeeEconomical   FeeEstimateMode = "economical"
+
+	//费率为每 FeeRateUnit 字节交易的手续费
+	FeeRateUnit = 1000
+	//支持的最大目标区块数
+	MaxFeeTarget = 48
+	//钱包不指定手续费时的目标区块数
+	DefaultFeeTarget = 6
+
+	feeEstimatorVersion = 1
+	//第一个桶为 [0, feeBucketMin)，之后每个桶的上限按 feeBucketSpacing 增长
+	feeBucketMin     = 10
+	feeBucketMax     = 1e7
+	feeBucketSpacing = 1.5
+	feeShortDecay    = 0.962
+	feeLongDecay     = 0.998
+	//确认比例的要求
+	feeConservativeRate = 0.95
+	feeEconomicalRate   = 0.85
+	//一组桶中至少要有的交易数 (衰减后)
+	feeSufficientTxs = 4
+	//每隔多少个区块保存一次
+	feeSaveInterval    = 6
+	maxFeeBuildRetries = 5
+)
+
+var (
+	ErrInsufficientFeeData = ErrWrapf("insufficient data for fee estimation")
+
+	//每个桶的费率上限，最后一个桶没有上限
+	feeBuckets = newFeeBuckets()
+)
+
+type FeeEstimator struct {
+	pool *TxPool
+	//保存统计数据的文件，为空时不保存
+	path string
+	mu   sync.RWMutex
+	//economical 和 conservative 使用的统计
+	short, long *feeStats
+	//交易池中正在跟踪的交易 key tx hash
+	tracked map[string]*feeTracked
+	//收到的区块数，用于定期保存
+	blocks int
+	sub    *Subscription
+	done   chan bool
+}
+
+//一个衰减周期的统计，所有值都随区块衰减
+type feeStats struct {
+	Decay float64
+	//每个桶中已有结果的交易数和费率总和
+	TxCount []float64
+	FeeSum  []float64
+	//Confirmed[t][b] 为桶 b 中在 t+1 个区块内确认的交易数
+	Confirmed [][]float64
+}
+
+type feeTracked struct {
+	height uint64
+	rate   int64
+	bucket int
+}
+
+type feeEstimatorFile struct {
+	Version int
+	Buckets []float64
+	Short   *feeStats
+	Long    *feeStats
+}
+
+// ==================================== func below ====================================
+
+func newFeeBuckets() []float64 {
+	r := make([]float64, 0)
+	for b := float64(feeBucketMin); b < feeBucketMax; b *= feeBucketSpacing {
+		r = append(r, b)
+	}
+	return append(r, math.Inf(1))
+}
+
+func feeBucket(rate int64) int {
+	return sort.Search(len(feeBuckets), func(i int) bool {
+		return float64(rate) < feeBuckets[i]
+	})
+}
+
+func ParseFeeEstimateMode(s string) (FeeEstimateMode, error) {
+	switch m := FeeEstimateMode(s); m {
+	case FeeConservative, FeeEconomical:
+		return m, nil
+	case "":
+		return FeeConservative, nil
+	}
+	return "", ErrWrapf("unknown fee estimate mode %s", s)
+}
+
+//size 字节的交易按 rate 需要的手续费，向上取整
+func FeeForSize(rate int64, size int) int64 {
+	return (rate*int64(size) + FeeRateUnit - 1) / FeeRateUnit
+}
+
+//交易的费率
+func FeeRate(t *Transaction) int64 {
+	size := t.Size()
+	if size == 0 {
+		return 0
+	}
+	return t.TxFee() * FeeRateUnit / int64(size)
+}
+
+func newFeeStats(decay float64) *feeStats {
+	s := &feeStats{
+		Decay:     decay,
+		TxCount:   make([]float64, len(feeBuckets)),
+		FeeSum:    make([]float64, len(feeBuckets)),
+		Confirmed: make([][]float64, MaxFeeTarget),
+	}
+	for i := range s.Confirmed {
+		s.Confirmed[i] = make([]float64, len(feeBuckets))
+	}
+	return s
+}
+
+func (s *feeStats) valid() bool {
+	if s == nil || len(s.TxCount) != len(feeBuckets) || len(s.FeeSum) != len(feeBuckets) || len(s.Confirmed) != MaxFeeTarget {
+		return false
+	}
+	for _, it := range s.Confirmed {
+		if len(it) != len(feeBuckets) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *feeStats) decay() {
+	for b := range s.TxCount {
+		s.TxCount[b] *= s.Decay
+		s.FeeSum[b] *= s.Decay
+		for t := range s.Confirmed {
+			s.Confirmed[t][b] *= s.Decay
+		}
+	}
+}
+
+//blocks 为 0 表示没有确认
+func (s *feeStats) record(bucket int, rate int64, blocks uint64) {
+	s.TxCount[bucket]++
+	s.FeeSum[bucket] += float64(rate)
+	if blocks == 0 {
+		return
+	}
+	for t := int(blocks) - 1; t < MaxFeeTarget; t++ {
+		s.Confirmed[t][bucket]++
+	}
+}
+
+//pending[b] 为桶 b 中已等待超过目标区块数的交易数
+func (s *feeStats) estimate(target int, success float64, pending []float64) (int64, bool) {
+	var txs, waiting, confirmed, fee float64
+	var best int64 = -1
+	for b := len(feeBuckets) - 1; b >= 0; b-- {
+		txs += s.TxCount[b]
+		waiting += pending[b]
+		confirmed += s.Confirmed[target-1][b]
+		fee += s.FeeSum[b]
+		if txs == 0 || txs+waiting < feeSufficientTxs {
+			continue
+		}
+		if confirmed/(txs+waiting) < success {
+			break
+		}
+		best = int64(math.Ceil(fee / txs))
+		txs, waiting, confirmed, fee = 0, 0, 0, 0
+	}
+	return best, best >= 0
+}
+
+//文件中不保存最后一个无上限的桶
+func sameFeeBuckets(bs []float64) bool {
+	if len(bs) != len(feeBuckets)-1 {
+		return false
+	}
+	for i, it := range bs {
+		if math.Abs(it-feeBuckets[i]) > 1e-6*feeBuckets[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//创建估算器，path 不为空时从文件读取之前的统计，文件不存在或格式不符时重新开始
+func NewFeeEstimator(pool *TxPool, path string) (*FeeEstimator, error) {
+	e := &FeeEstimator{
+		pool:    pool,
+		path:    path,
+		short:   newFeeStats(feeShortDecay),
+		long:    newFeeStats(feeLongDecay),
+		tracked: make(map[string]*feeTracked),
+	}
+	if path == "" {
+		return e, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return e, nil
+	}
+	if err != nil {
+		return nil, ErrWrap("read fee estimates", err)
+	}
+	f := new(feeEstimatorFile)
+	if err = json.Unmarshal(b, f); err != nil {
+		return nil, ErrWrap("decode fee estimates", err)
+	}
+	if f.Version != feeEstimatorVersion || !sameFeeBuckets(f.Buckets) || !f.Short.valid() || !f.Long.valid() {
+		Log.Info("Ignore incompatible fee estimates ", path)
+		return e, nil
+	}
+	e.short, e.long = f.Short, f.Long
+	return e, nil
+}
+
+//开始处理事件
+func (e *FeeEstimator) Start() {
+	e.sub = e.pool.Chain.Events.SubscribeUnbounded(nil)
+	e.done = make(chan bool)
+	go func() {
+		defer close(e.done)
+		for it := range e.sub.C {
+			e.handle(it)
+		}
+	}()
+}
+
+//停止并保存
+func (e *FeeEstimator) Stop() error {
+	if e.sub != nil {
+		e.sub.Unsubscribe()
+		<-e.done
+	}
+	return e.Save()
+}
+
+func (e *FeeEstimator) handle(ev *Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch ev.Type {
+	case EventTxAccepted:
+		rate := FeeRate(ev.Tx)
+		e.tracked[ev.Tx.Hash] = &feeTracked{
+			height: e.pool.Chain.Tip().Height,
+			rate:   rate,
+			bucket: feeBucket(rate),
+		}
+	case EventTxEvicted:
+		if it, ok := e.tracked[ev.Tx.Hash]; ok {
+			delete(e.tracked, ev.Tx.Hash)
+			e.short.record(it.bucket, it.rate, 0)
+			e.long.record(it.bucket, it.rate, 0)
+		}
+	case EventBlockConnected:
+		e.short.decay()
+		e.long.decay()
+		for _, t := range ev.Block.Tx {
+			it, ok := e.tracked[t.Hash]
+			if !ok {
+				continue
+			}
+			delete(e.tracked, t.Hash)
+			var blocks uint64 = 1
+			if ev.Block.Height > it.height {
+				blocks = ev.Block.Height - it.height
+			}
+			e.short.record(it.bucket, it.rate, blocks)
+			e.long.record(it.bucket, it.rate, blocks)
+		}
+		if e.blocks++; e.blocks%feeSaveInterval == 0 {
+			if err := e.save(); err != nil {
+				Log.Info("Save fee estimates failed: ", err)
+			}
+		}
+	}
+}
+
+//交易池中已等待 target 个区块以上的交易，按桶统计
+func (e *FeeEstimator) pending(target int) []float64 {
+	r := make([]float64, len(feeBuckets))
+	tip := e.pool.Chain.Tip().Height
+	for _, it := range e.tracked {
+		if tip >= it.height+uint64(target) {
+			r[it.bucket]++
+		}
+	}
+	return r
+}
+
+//估算 target 个区块内确认需要的费率，见 FeeRateUnit
+//conservative 同时要求长短两个周期的统计都有 95% 的交易在目标内确认，取较高的费率
+//economical 只使用短周期，要求 85%
+func (e *FeeEstimator) EstimateFee(target int, mode FeeEstimateMode) (int64, error) {
+	if target < 1 || target > MaxFeeTarget {
+		return 0, ErrWrapf("invalid fee target %d, should in [1, %d]", target, MaxFeeTarget)
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	pending := e.pending(target)
+	if mode == FeeEconomical {
+		if r, ok := e.short.estimate(target, feeEconomicalRate, pending); ok {
+			return r, nil
+		}
+		return 0, ErrInsufficientFeeData
+	}
+	short, okShort := e.short.estimate(target, feeConservativeRate, pending)
+	long, okLong := e.long.estimate(target, feeConservativeRate, pending)
+	switch {
+	case okShort && okLong:
+		if short > long {
+			return short, nil
+		}
+		return long, nil
+	case okLong:
+		return long, nil
+	case okShort:
+		return short, nil
+	}
+	return 0, ErrInsufficientFeeData
+}
+
+func (e *FeeEstimator) Save() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.save()
+}
+
+func (e *FeeEstimator) save() error {
+	if e.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(&feeEstimatorFile{
+		Version: feeEstimatorVersion,
+		Buckets: feeBuckets[:len(feeBuckets)-1],
+		Short:   e.short,
+		Long:    e.long,
+	})
+	if err != nil {
+		return err
+	}
+	if err = WriteFileAtomic(e.path, b, 0600); err != nil {
+		return ErrWrap("save fee estimates", err)
+	}
+	return nil
+}
+
+//按费率计算手续费后构建交易，手续费变化后输入可能不同，重新选择直到手续费足够
+//selectInputs 返回总额不少于 target 的之前交易的输出
+func BuildTxWithFeeRate(req *TxRequest, rate int64, selectInputs func(target int64) ([]*Output, error), timestamp int64) (*Transaction, error) {
+	r := *req
+	for i := 0; i < maxFeeBuildRetries; i++ {
+		target, err := r.Target()
+		if err != nil {
+			return nil, err
+		}
+		prevOuts, err := selectInputs(target)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := BuildTx(prevOuts, &r, timestamp)
+		if err != nil {
+			return nil, err
+		}
+		need := FeeForSize(rate, tx.Size())
+		if tx.TxFee() >= need {
+			return tx, nil
+		}
+		r.TxFee = need
+	}
+	return nil, ErrWrapf("can't build tx with fee rate %d", rate)
+}
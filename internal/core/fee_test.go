@@ -0,0 +1,192 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+//只有手续费有意义的交易，费率约为 fee * FeeRateUnit / Size
+func feeTestTx(hash string, fee int64) *Transaction {
+	return &Transaction{
+		Hash:    hash,
+		Inputs:  []*Input{{Output: &Output{Fee: fee + 1}}},
+		Outputs: []*Output{{Fee: 1}},
+	}
+}
+
+//每个区块进入一笔高费率和一笔低费率的交易，高费率的下一个区块确认，低费率的等待 6 个区块
+func feedFeeEstimator(e *FeeEstimator, blocks int) (high, low int64) {
+	for h := 1; h <= blocks; h++ {
+		hi := feeTestTx("h"+strconv.Itoa(h), 1000)
+		lo := feeTestTx("l"+strconv.Itoa(h), 5)
+		high, low = FeeRate(hi), FeeRate(lo)
+		for _, it := range []*Transaction{hi, lo} {
+			e.handle(&Event{Type: EventTxAccepted, Tx: it})
+			//模拟交易进入交易池时的高度
+			e.tracked[it.Hash].height = uint64(h - 1)
+		}
+		b := &Block{Height: uint64(h), Tx: []*Transaction{hi}}
+		if h > 5 {
+			b.Tx = append(b.Tx, &Transaction{Hash: "l" + strconv.Itoa(h-5)})
+		}
+		e.handle(&Event{Type: EventBlockConnected, Block: b})
+	}
+	return
+}
+
+func TestFeeEstimator_Estimate(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	e, _ := NewFeeEstimator(pool, "")
+	if _, err := e.EstimateFee(1, FeeConservative); err != ErrInsufficientFeeData {
+		t.Fatal(err)
+	}
+	if _, err := e.EstimateFee(MaxFeeTarget+1, FeeConservative); err == nil {
+		t.Fatal("invalid target")
+	}
+	high, low := feedFeeEstimator(e, 30)
+	for _, mode := range []FeeEstimateMode{FeeConservative, FeeEconomical} {
+		fast, err := e.EstimateFee(1, mode)
+		if err != nil || feeBucket(fast) != feeBucket(high) {
+			t.Fatal(mode, fast, high, err)
+		}
+		//目标为 6 个区块时低费率也足够
+		slow, err := e.EstimateFee(6, mode)
+		if err != nil || feeBucket(slow) != feeBucket(low) {
+			t.Fatal(mode, slow, low, err)
+		}
+	}
+	//因冲突移出交易池的交易算作未确认，不满足 conservative 的 95%，economical 只要求 85%
+	for i := 0; i < 3; i++ {
+		tx := feeTestTx("e"+strconv.Itoa(i), 1000)
+		e.handle(&Event{Type: EventTxAccepted, Tx: tx})
+		e.handle(&Event{Type: EventTxEvicted, Tx: tx, Reason: "conflict"})
+	}
+	if r, err := e.EstimateFee(1, FeeEconomical); err != nil || feeBucket(r) != feeBucket(high) {
+		t.Fatal(r, err)
+	}
+	if _, err := e.EstimateFee(1, FeeConservative); err != ErrInsufficientFeeData {
+		t.Fatal(err)
+	}
+}
+
+//处理慢时事件在队列中等待，不会少统计交易
+func TestFeeEstimator_NoLostEvents(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	e, _ := NewFeeEstimator(pool, "")
+	e.Start()
+	e.mu.Lock()
+	for i := 0; i < 2000; i++ {
+		pool.Chain.Events.Publish(&Event{Type: EventTxAccepted, Tx: feeTestTx(strconv.Itoa(i), 10)})
+	}
+	e.mu.Unlock()
+	defer e.Stop()
+	waitTracker(t, func() bool {
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		return len(e.tracked) == 2000
+	})
+}
+
+func TestFeeEstimator_Save(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fee_estimates.json")
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	e, err := NewFeeEstimator(pool, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feedFeeEstimator(e, 20)
+	want, _ := e.EstimateFee(3, FeeEconomical)
+	//固定名字的临时文件不会被覆盖
+	fixed := path + ".tmp"
+	_ = ioutil.WriteFile(fixed, []byte("keep"), 0644)
+	if err = e.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(fixed); string(b) != "keep" {
+		t.Fatal("tmp file overwritten")
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatal(fi, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Fatal("tmp file left", len(files))
+	}
+	//重启后统计数据不变
+	e2, err := NewFeeEstimator(pool, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := e2.EstimateFee(3, FeeEconomical); err != nil || got != want {
+		t.Fatal(got, want, err)
+	}
+	//格式不符时重新开始
+	_ = ioutil.WriteFile(path, []byte(`{"Version":1,"Buckets":[1,2]}`), 0644)
+	e3, err := NewFeeEstimator(pool, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e3.EstimateFee(3, FeeEconomical); err != ErrInsufficientFeeData {
+		t.Fatal(err)
+	}
+	_ = ioutil.WriteFile(path, []byte("x"), 0644)
+	if _, err = NewFeeEstimator(pool, path); err == nil {
+		t.Fatal("corrupted file")
+	}
+}
+
+func TestBuildTxWithFeeRate(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w := getTestWallet()
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w.Address())[0].TxHash].Outputs[0]
+	selectInputs := func(target int64) ([]*Output, error) {
+		if target > prev.Fee {
+			return nil, ErrWrapf("not enough")
+		}
+		return []*Output{prev}, nil
+	}
+	const rate = 20
+	tx, err := BuildTxWithFeeRate(w.Request(getTestWallet2().Address(), 30, ""), rate, selectInputs, MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.TxFee() < FeeForSize(rate, tx.Size()) || FeeRate(tx) < rate {
+		t.Fatal("fee", tx.TxFee(), tx.Size())
+	}
+	//余额不够支付手续费
+	if _, err = BuildTxWithFeeRate(w.Request(getTestWallet2().Address(), prev.Fee, ""), rate, selectInputs, MockGlobalEvn.UnixTime()); err == nil {
+		t.Fatal("fee exceeds balance")
+	}
+}
+
+func TestTxPool_EstimatedFee(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	pool.FeeEstimator, _ = NewFeeEstimator(pool, "")
+	w := getTestWallet()
+	//没有估算数据时不付手续费
+	if r := w.Transform(pool, getTestWallet2().Address(), 10, ""); r.err != nil {
+		t.Fatal(r.err)
+	}
+	if tx := <-pool.txCh; tx.TxFee() != 0 {
+		t.Fatal("fee without estimates", tx.TxFee())
+	}
+	feedFeeEstimator(pool.FeeEstimator, 20)
+	rate, err := pool.FeeEstimator.EstimateFee(DefaultFeeTarget, FeeConservative)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2 := getTestWallet2()
+	if r := w2.Transform(pool, w.Address(), 10, ""); r.err != nil {
+		t.Fatal(r.err)
+	}
+	if tx := <-pool.txCh; tx.TxFee() == 0 || FeeRate(tx) < rate {
+		t.Fatal("estimated fee", tx.TxFee(), rate)
+	}
+}
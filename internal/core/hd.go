@@ -0,0 +1,278 @@
+package core
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ==================================== HD Wallet ====================================
+// BIP32 风格的分层确定性钱包，曲线为 Wallet 使用的 P-256
+// 主密钥和子密钥推导遵循 SLIP-0010 (nist256p1)，推导出无效私钥时按 SLIP-0010 重试
+// 扩展密钥按 BIP32 的 78 字节格式序列化后做 Base58Check
+
+const (
+	HardenedKeyStart uint32 = 0x80000000
+	//默认的账户路径，第 i 个地址为 DefaultHDPath/i
+	DefaultHDPath = "m/44'/0'/0'/0"
+
+	hdSeedKey    = "Nist256p1 seed"
+	hdKeyLen     = 78
+	hdMinSeedLen = 16
+	hdMaxSeedLen = 64
+	hdMaxDepth   = 255
+)
+
+var (
+	//扩展私钥/公钥的版本前缀，与比特币的 xprv/xpub 区分，避免用在 secp256k1 的钱包中
+	HDPrivateVersion = []byte{0x04, 0x35, 0x83, 0x94}
+	HDPublicVersion  = []byte{0x04, 0x35, 0x87, 0xcf}
+)
+
+type ExtendedKey struct {
+	Depth             byte
+	ParentFingerprint uint32
+	ChildNumber       uint32
+	ChainCode         []byte
+	//私钥，扩展公钥时为空
+	d    *big.Int
+	x, y *big.Int
+}
+
+// ==================================== func below ====================================
+
+//从种子生成主密钥
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < hdMinSeedLen || len(seed) > hdMaxSeedLen {
+		return nil, ErrWrapf("invalid seed length %d", len(seed))
+	}
+	n := elliptic.P256().Params().N
+	i := hmacSha512([]byte(hdSeedKey), seed)
+	for {
+		d := new(big.Int).SetBytes(i[:32])
+		if d.Sign() > 0 && d.Cmp(n) < 0 {
+			return newPrivateExtendedKey(d, i[32:], 0, 0, 0), nil
+		}
+		i = hmacSha512([]byte(hdSeedKey), i)
+	}
+}
+
+func newPrivateExtendedKey(d *big.Int, chainCode []byte, depth byte, parent, child uint32) *ExtendedKey {
+	x, y := elliptic.P256().ScalarBaseMult(padBytes(d.Bytes(), 32))
+	return &ExtendedKey{
+		Depth:             depth,
+		ParentFingerprint: parent,
+		ChildNumber:       child,
+		ChainCode:         CopyBytes(chainCode),
+		d:                 d,
+		x:                 x,
+		y:                 y,
+	}
+}
+
+func hmacSha512(key, data []byte) []byte {
+	h := hmac.New(sha512.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.d != nil
+}
+
+//33 字节压缩公钥
+func (k *ExtendedKey) PublicKey() []byte {
+	return compressPubKey(k.x, k.y)
+}
+
+//公钥 hash160 的前 4 字节
+func (k *ExtendedKey) Fingerprint() uint32 {
+	return binary.BigEndian.Uint32(Sha160(Sha256(k.PublicKey()))[:4])
+}
+
+//推导第 i 个子密钥，i >= HardenedKeyStart 为强化推导，只能由扩展私钥进行
+func (k *ExtendedKey) Child(i uint32) (*ExtendedKey, error) {
+	if k.Depth == hdMaxDepth {
+		return nil, ErrWrapf("max hd depth reached")
+	}
+	hardened := i >= HardenedKeyStart
+	if hardened && !k.IsPrivate() {
+		return nil, ErrWrapf("can't derive hardened child from public key")
+	}
+	index := make([]byte, 4)
+	binary.BigEndian.PutUint32(index, i)
+	var data []byte
+	if hardened {
+		data = ConcatBytes([]byte{0}, padBytes(k.d.Bytes(), 32), index)
+	} else {
+		data = ConcatBytes(k.PublicKey(), index)
+	}
+	curve := elliptic.P256()
+	n := curve.Params().N
+	for {
+		h := hmacSha512(k.ChainCode, data)
+		il := new(big.Int).SetBytes(h[:32])
+		if il.Cmp(n) < 0 {
+			if k.IsPrivate() {
+				d := new(big.Int).Add(il, k.d)
+				d.Mod(d, n)
+				if d.Sign() != 0 {
+					return newPrivateExtendedKey(d, h[32:], k.Depth+1, k.Fingerprint(), i), nil
+				}
+			} else {
+				ix, iy := curve.ScalarBaseMult(h[:32])
+				x, y := curve.Add(ix, iy, k.x, k.y)
+				if x.Sign() != 0 || y.Sign() != 0 {
+					return &ExtendedKey{
+						Depth:             k.Depth + 1,
+						ParentFingerprint: k.Fingerprint(),
+						ChildNumber:       i,
+						ChainCode:         CopyBytes(h[32:]),
+						x:                 x,
+						y:                 y,
+					}, nil
+				}
+			}
+		}
+		//SLIP-0010: 结果无效时用 0x01 || IR || i 重新计算
+		data = ConcatBytes([]byte{1}, h[32:], index)
+	}
+}
+
+//按路径推导，例如 m/44'/0'/0'/0/1，强化推导用 ' 或 h 标记
+//扩展公钥的路径可以以 M 开头
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if parts[0] != "m" && parts[0] != "M" {
+		return nil, ErrWrapf("invalid hd path %q", path)
+	}
+	if k.Depth != 0 {
+		return nil, ErrWrapf("hd path should be derived from master key")
+	}
+	r := k
+	for _, it := range parts[1:] {
+		i, err := parsePathIndex(it)
+		if err != nil {
+			return nil, ErrWrap("invalid hd path "+path, err)
+		}
+		if r, err = r.Child(i); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func parsePathIndex(s string) (uint32, error) {
+	var offset uint32 = 0
+	if strings.HasSuffix(s, "'") || strings.HasSuffix(s, "h") || strings.HasSuffix(s, "H") {
+		offset = HardenedKeyStart
+		s = s[:len(s)-1]
+	}
+	i, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || uint32(i) >= HardenedKeyStart {
+		return 0, ErrWrapf("invalid index %q", s)
+	}
+	return uint32(i) + offset, nil
+}
+
+//去掉私钥，得到对应的扩展公钥
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	return &ExtendedKey{
+		Depth:             k.Depth,
+		ParentFingerprint: k.ParentFingerprint,
+		ChildNumber:       k.ChildNumber,
+		ChainCode:         CopyBytes(k.ChainCode),
+		x:                 k.x,
+		y:                 k.y,
+	}
+}
+
+//扩展私钥对应的钱包
+func (k *ExtendedKey) Wallet() (*Wallet, error) {
+	if !k.IsPrivate() {
+		return nil, ErrWrapf("public extended key has no wallet")
+	}
+	return RestoreWallet(k.d.Bytes()), nil
+}
+
+//扩展公钥也可以得到地址，用于只读钱包
+func (k *ExtendedKey) Address() string {
+	return pubKeyAddress(pubKeyBytes(k.x, k.y))
+}
+
+//BIP32 序列化: version(4) depth(1) fingerprint(4) child(4) chaincode(32) key(33)，再做 Base58Check
+func (k *ExtendedKey) String() string {
+	b := make([]byte, 0, hdKeyLen+LenCheckSum)
+	var key []byte
+	if k.IsPrivate() {
+		b = append(b, HDPrivateVersion...)
+		key = ConcatBytes([]byte{0}, padBytes(k.d.Bytes(), 32))
+	} else {
+		b = append(b, HDPublicVersion...)
+		key = k.PublicKey()
+	}
+	b = append(b, k.Depth)
+	b = append(b, uint32Bytes(k.ParentFingerprint)...)
+	b = append(b, uint32Bytes(k.ChildNumber)...)
+	b = append(b, k.ChainCode...)
+	b = append(b, key...)
+	b = append(b, Sha256(Sha256(b))[:LenCheckSum]...)
+	return Base58(b)
+}
+
+func uint32Bytes(i uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, i)
+	return b
+}
+
+func ParseExtendedKey(s string) (*ExtendedKey, error) {
+	b, err := Base58Decode(s)
+	if err != nil {
+		return nil, ErrWrap("invalid extended key", err)
+	}
+	if len(b) != hdKeyLen+LenCheckSum {
+		return nil, ErrWrapf("invalid extended key length %d", len(b))
+	}
+	payload := b[:hdKeyLen]
+	if !bytes.Equal(Sha256(Sha256(payload))[:LenCheckSum], b[hdKeyLen:]) {
+		return nil, ErrWrapf("invalid extended key checksum")
+	}
+	k := &ExtendedKey{
+		Depth:             payload[4],
+		ParentFingerprint: binary.BigEndian.Uint32(payload[5:9]),
+		ChildNumber:       binary.BigEndian.Uint32(payload[9:13]),
+		ChainCode:         CopyBytes(payload[13:45]),
+	}
+	if k.Depth == 0 && (k.ParentFingerprint != 0 || k.ChildNumber != 0) {
+		return nil, ErrWrapf("invalid master extended key")
+	}
+	key := payload[45:]
+	curve := elliptic.P256()
+	switch {
+	case bytes.Equal(payload[:4], HDPrivateVersion):
+		if key[0] != 0 {
+			return nil, ErrWrapf("invalid extended private key")
+		}
+		d := new(big.Int).SetBytes(key[1:])
+		if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+			return nil, ErrWrapf("invalid extended private key")
+		}
+		k.d = d
+		k.x, k.y = curve.ScalarBaseMult(key[1:])
+	case bytes.Equal(payload[:4], HDPublicVersion):
+		x, y, err := decompressPubKey(key)
+		if err != nil {
+			return nil, err
+		}
+		k.x, k.y = x, y
+	default:
+		return nil, ErrWrapf("unknown extended key version %x", payload[:4])
+	}
+	return k, nil
+}
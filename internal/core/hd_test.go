@@ -0,0 +1,116 @@
+package core
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+//SLIP-0010 nist256p1 test vector 1
+func TestNewMasterKey(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	m, err := NewMasterKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(m.ChainCode) != "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea" {
+		t.Fatal("chain code", hex.EncodeToString(m.ChainCode))
+	}
+	if hex.EncodeToString(padBytes(m.d.Bytes(), 32)) != "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2" {
+		t.Fatal("private key", m.d.Text(16))
+	}
+	if hex.EncodeToString(m.PublicKey()) != "0266874dc6ade47b3ecd096745ca09bcd29638dd52c2c12117b11ed3e458cfa9e8" {
+		t.Fatal("public key", hex.EncodeToString(m.PublicKey()))
+	}
+	if _, err = NewMasterKey(seed[:8]); err == nil {
+		t.Fatal("short seed should fail")
+	}
+}
+
+//m/0' 与 m/0'/1 同样来自 SLIP-0010 nist256p1 test vector 1
+func TestExtendedKey_Derive(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	m, _ := NewMasterKey(seed)
+	k, err := m.Derive("m/0'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(k.ChainCode) != "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11" {
+		t.Fatal("chain code", hex.EncodeToString(k.ChainCode))
+	}
+	if hex.EncodeToString(padBytes(k.d.Bytes(), 32)) != "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c" {
+		t.Fatal("private key", k.d.Text(16))
+	}
+	if k.Depth != 1 || k.ChildNumber != HardenedKeyStart || k.ParentFingerprint != m.Fingerprint() {
+		t.Fatal("metadata")
+	}
+	k2, err := m.Derive("m/0h/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(k2.PublicKey()) != "03526c63f8d0b4bbbf9c80df553fe66742df4676b241dabefdef67733e070f6844" {
+		t.Fatal("public key", hex.EncodeToString(k2.PublicKey()))
+	}
+	for _, p := range []string{"", "x/0", "m/a", "m/0''", "m/2147483648"} {
+		if _, err := m.Derive(p); err == nil {
+			t.Fatal("path should fail", p)
+		}
+	}
+}
+
+func TestExtendedKey_PublicDerivation(t *testing.T) {
+	seed, _ := hex.DecodeString("fffcf9f6f3f0edeae7e4e1dedbd8d5d2cfccc9c6c3c0bdbab7b4b1aeaba8a5a29f9c999693908d8a8784817e7b7875726f6c696663605d5a5754514e4b484542")
+	m, _ := NewMasterKey(seed)
+	account, err := m.Derive(DefaultHDPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := account.Neuter()
+	if pub.IsPrivate() {
+		t.Fatal("neutered key is private")
+	}
+	for i := uint32(0); i < 3; i++ {
+		priv, _ := account.Child(i)
+		c, err := pub.Child(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.String() != priv.Neuter().String() {
+			t.Fatal("public derivation mismatch", i)
+		}
+		w, _ := priv.Wallet()
+		if c.Address() != w.Address() || priv.Address() != w.Address() {
+			t.Fatal("address mismatch", i)
+		}
+	}
+	if _, err = pub.Child(HardenedKeyStart); err == nil {
+		t.Fatal("hardened derivation from public key should fail")
+	}
+	if _, err = pub.Wallet(); err == nil {
+		t.Fatal("public key has no wallet")
+	}
+}
+
+func TestParseExtendedKey(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	m, _ := NewMasterKey(seed)
+	k, _ := m.Derive("m/44'/0'/0'/0/7")
+	for _, it := range []*ExtendedKey{m, k, k.Neuter()} {
+		s := it.String()
+		p, err := ParseExtendedKey(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != s || p.IsPrivate() != it.IsPrivate() || p.Address() != it.Address() {
+			t.Fatal("round trip failed", s)
+		}
+	}
+	s := []byte(k.String())
+	if s[10] == 'a' {
+		s[10] = 'b'
+	} else {
+		s[10] = 'a'
+	}
+	if _, err := ParseExtendedKey(string(s)); err == nil {
+		t.Fatal("bad checksum should fail")
+	}
+}
@@ -0,0 +1,492 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// ==================================== Keystore ====================================
+// 用口令加密保存私钥的文件
+// 口令经 scrypt 派生出密钥，每个私钥用 XChaCha20-Poly1305 单独加密，地址作为附加数据
+// 解锁后私钥保存在内存中，超时或调用 Lock 后清除
+// 只读 (watch-only) 地址只保存地址和可选的公钥，可以查询余额，但不能签名
+
+const (
+	KeystoreVersion = 1
+	keystoreKeyLen  = 32
+	keystoreSaltLen = 32
+	//加密固定内容，用于校验口令
+	keystoreCheck = "simple-block-chain keystore"
+)
+
+var (
+	//scrypt 参数, N=2^15 r=8 约需 32MB 内存; 参数写入文件，修改后旧文件仍可读取
+	KeystoreScryptN = 1 << 15
+	KeystoreScryptR = 8
+	KeystoreScryptP = 1
+
+	ErrKeystoreLocked   = ErrWrapf("keystore is locked")
+	ErrWrongPassphrase  = ErrWrapf("wrong passphrase")
+	ErrKeystoreNotFound = ErrWrapf("address not in keystore")
+	ErrWatchOnly        = ErrWrapf("address is watch-only")
+)
+
+type keystoreFile struct {
+	Version int             `json:"version"`
+	Kdf     *kdfParams      `json:"kdf"`
+	Check   *sealedData     `json:"check"`
+	Keys    []*keystoreItem `json:"keys"`
+}
+
+type kdfParams struct {
+	Name string `json:"name"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt string `json:"salt"`
+}
+
+type sealedData struct {
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+type keystoreItem struct {
+	Address string `json:"address"`
+	//只读地址为空
+	Key *sealedData `json:"key,omitempty"`
+	//私钥对应压缩公钥的地址
+	Compressed bool `json:"compressed,omitempty"`
+	//只读地址导入时给出的公钥 hex
+	PubKey string `json:"pubkey,omitempty"`
+}
+
+type Keystore struct {
+	path string
+	mu   sync.Mutex
+	file *keystoreFile
+	//解锁后的派生密钥和钱包，锁定时为空
+	key     []byte
+	wallets map[string]*Wallet
+	timer   *time.Timer
+}
+
+// ==================================== func below ====================================
+
+//新建空的 keystore 文件，文件已存在时报错
+func CreateKeystore(path, passphrase string) (*Keystore, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, ErrWrapf("keystore %s already exists", path)
+	}
+	kdf, key, err := newKdf(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	check, err := seal(key, []byte(keystoreCheck), nil)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keystore{
+		path: path,
+		file: &keystoreFile{
+			Version: KeystoreVersion,
+			Kdf:     kdf,
+			Check:   check,
+			Keys:    make([]*keystoreItem, 0),
+		},
+	}
+	if err = k.save(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+//打开已有的 keystore，初始为锁定状态
+func OpenKeystore(path string) (*Keystore, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, ErrWrap("read keystore", err)
+	}
+	f := new(keystoreFile)
+	if err = json.Unmarshal(b, f); err != nil {
+		return nil, ErrWrap("decode keystore", err)
+	}
+	if f.Version != KeystoreVersion || f.Kdf == nil || f.Check == nil {
+		return nil, ErrWrapf("unsupported keystore %s", path)
+	}
+	return &Keystore{path: path, file: f}, nil
+}
+
+func newKdf(passphrase string) (*kdfParams, []byte, error) {
+	salt := make([]byte, keystoreSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, ErrWrap("generate salt", err)
+	}
+	kdf := &kdfParams{
+		Name: "scrypt",
+		N:    KeystoreScryptN,
+		R:    KeystoreScryptR,
+		P:    KeystoreScryptP,
+		Salt: hex.EncodeToString(salt),
+	}
+	key, err := kdf.derive(passphrase)
+	return kdf, key, err
+}
+
+func (p *kdfParams) derive(passphrase string) ([]byte, error) {
+	if p.Name != "scrypt" {
+		return nil, ErrWrapf("unsupported kdf %s", p.Name)
+	}
+	salt, err := hex.DecodeString(p.Salt)
+	if err != nil {
+		return nil, ErrWrap("invalid salt", err)
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, p.N, p.R, p.P, keystoreKeyLen)
+	if err != nil {
+		return nil, ErrWrap("derive key", err)
+	}
+	return key, nil
+}
+
+func seal(key, plain, ad []byte) (*sealedData, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, ErrWrap("generate nonce", err)
+	}
+	return &sealedData{
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(aead.Seal(nil, nonce, plain, ad)),
+	}, nil
+}
+
+func unseal(key []byte, d *sealedData, ad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(d.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, ErrWrapf("invalid nonce")
+	}
+	c, err := hex.DecodeString(d.Ciphertext)
+	if err != nil {
+		return nil, ErrWrapf("invalid ciphertext")
+	}
+	return aead.Open(nil, nonce, c, ad)
+}
+
+//用口令派生密钥并校验
+func (k *Keystore) checkPassphrase(passphrase string) ([]byte, error) {
+	key, err := k.file.Kdf.derive(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	check, err := unseal(key, k.file.Check, nil)
+	if err != nil || subtle.ConstantTimeCompare(check, []byte(keystoreCheck)) != 1 {
+		return nil, ErrWrongPassphrase
+	}
+	return key, nil
+}
+
+func (k *Keystore) decryptAll(key []byte) (map[string]*Wallet, error) {
+	r := make(map[string]*Wallet)
+	for _, it := range k.file.Keys {
+		if it.Key == nil {
+			continue
+		}
+		priv, err := unseal(key, it.Key, []byte(it.Address))
+		if err != nil {
+			return nil, ErrWrapf("decrypt key of %s failed", it.Address)
+		}
+		w := RestoreWallet(priv)
+		w.compressed = it.Compressed
+		if w.Address() != it.Address {
+			return nil, ErrWrapf("key mismatch address %s", it.Address)
+		}
+		r[it.Address] = w
+	}
+	return r, nil
+}
+
+//解锁 timeout 时间，timeout 为 0 时一直解锁到 Lock
+func (k *Keystore) Unlock(passphrase string, timeout time.Duration) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, err := k.checkPassphrase(passphrase)
+	if err != nil {
+		return err
+	}
+	wallets, err := k.decryptAll(key)
+	if err != nil {
+		return err
+	}
+	k.lock()
+	k.key = key
+	k.wallets = wallets
+	if timeout > 0 {
+		var t *time.Timer
+		t = time.AfterFunc(timeout, func() {
+			k.mu.Lock()
+			defer k.mu.Unlock()
+			k.expire(t)
+		})
+		k.timer = t
+	}
+	return nil
+}
+
+//定时器到期，调用者持有 k.mu
+//Stop 不能取消已经触发、正在等待 k.mu 的回调，定时器已被替换时不锁定新的解锁
+func (k *Keystore) expire(t *time.Timer) {
+	if k.timer == t {
+		k.lock()
+	}
+}
+
+func (k *Keystore) Lock() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.lock()
+}
+
+func (k *Keystore) lock() {
+	if k.timer != nil {
+		k.timer.Stop()
+		k.timer = nil
+	}
+	for i := range k.key {
+		k.key[i] = 0
+	}
+	k.key = nil
+	k.wallets = nil
+}
+
+func (k *Keystore) IsLocked() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.key == nil
+}
+
+//锁定时也可以查询地址，包括只读地址
+func (k *Keystore) Addresses() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	r := make([]string, 0, len(k.file.Keys))
+	for _, it := range k.file.Keys {
+		r = append(r, it.Address)
+	}
+	return r
+}
+
+func (k *Keystore) Contains(address string) bool {
+	for _, it := range k.Addresses() {
+		if it == address {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *Keystore) find(address string) *keystoreItem {
+	for _, it := range k.file.Keys {
+		if it.Address == address {
+			return it
+		}
+	}
+	return nil
+}
+
+func (k *Keystore) IsWatchOnly(address string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	it := k.find(address)
+	return it != nil && it.Key == nil
+}
+
+//取出解锁后的钱包，只读地址返回 ErrWatchOnly
+func (k *Keystore) Wallet(address string) (*Wallet, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if it := k.find(address); it != nil && it.Key == nil {
+		return nil, ErrWatchOnly
+	}
+	if k.key == nil {
+		return nil, ErrKeystoreLocked
+	}
+	w, ok := k.wallets[address]
+	if !ok {
+		return nil, ErrKeystoreNotFound
+	}
+	return w, nil
+}
+
+//按加入顺序的全部可签名的钱包，需要先解锁
+func (k *Keystore) Wallets() ([]*Wallet, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.key == nil {
+		return nil, ErrKeystoreLocked
+	}
+	r := make([]*Wallet, 0, len(k.file.Keys))
+	for _, it := range k.file.Keys {
+		if it.Key != nil {
+			r = append(r, k.wallets[it.Address])
+		}
+	}
+	return r, nil
+}
+
+//加入私钥并保存，需要先解锁
+func (k *Keystore) Add(w *Wallet) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.key == nil {
+		return ErrKeystoreLocked
+	}
+	address := w.Address()
+	if _, ok := k.wallets[address]; ok {
+		return nil
+	}
+	sealed, err := seal(k.key, padBytes(w.PrivateKey(), keystoreKeyLen), []byte(address))
+	if err != nil {
+		return err
+	}
+	item := &keystoreItem{Address: address, Key: sealed, Compressed: w.compressed}
+	//导入私钥后只读地址变为可签名
+	prev := k.file.Keys
+	keys := make([]*keystoreItem, 0, len(prev)+1)
+	for _, it := range prev {
+		if it.Address != address {
+			keys = append(keys, it)
+		}
+	}
+	k.file.Keys = append(keys, item)
+	if err = k.save(); err != nil {
+		k.file.Keys = prev
+		return err
+	}
+	k.wallets[address] = w
+	return nil
+}
+
+//加入只读地址，s 为地址或公钥 hex，返回加入的地址，不需要解锁
+func (k *Keystore) AddWatchOnly(s string) (string, error) {
+	item := new(keystoreItem)
+	if pub, err := hex.DecodeString(s); err == nil && (len(pub) == PubKeyLen || len(pub) == CompressedPubKeyLen) {
+		if _, err = ParsePublicKey(pub); err != nil {
+			return "", err
+		}
+		item.Address = pubKeyAddress(pub)
+		item.PubKey = hex.EncodeToString(pub)
+	} else {
+		address, err := CanonicalAddress(s)
+		if err != nil {
+			return "", err
+		}
+		item.Address = address
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.find(item.Address) != nil {
+		return item.Address, nil
+	}
+	k.file.Keys = append(k.file.Keys, item)
+	if err := k.save(); err != nil {
+		k.file.Keys = k.file.Keys[:len(k.file.Keys)-1]
+		return "", err
+	}
+	return item.Address, nil
+}
+
+//生成新的私钥并保存
+func (k *Keystore) NewWallet() (*Wallet, error) {
+	w, err := NewWallet()
+	if err != nil {
+		return nil, err
+	}
+	if err = k.Add(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+//使用新的口令和 salt 重新加密所有私钥，保持当前的锁定状态
+func (k *Keystore) ChangePassphrase(old, passphrase string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, err := k.checkPassphrase(old)
+	if err != nil {
+		return err
+	}
+	wallets, err := k.decryptAll(key)
+	if err != nil {
+		return err
+	}
+	kdf, newKey, err := newKdf(passphrase)
+	if err != nil {
+		return err
+	}
+	check, err := seal(newKey, []byte(keystoreCheck), nil)
+	if err != nil {
+		return err
+	}
+	f := &keystoreFile{
+		Version: KeystoreVersion,
+		Kdf:     kdf,
+		Check:   check,
+		Keys:    make([]*keystoreItem, 0, len(k.file.Keys)),
+	}
+	for _, it := range k.file.Keys {
+		item := *it
+		if it.Key != nil {
+			if item.Key, err = seal(newKey, padBytes(wallets[it.Address].PrivateKey(), keystoreKeyLen), []byte(it.Address)); err != nil {
+				return err
+			}
+		}
+		f.Keys = append(f.Keys, &item)
+	}
+	prev := k.file
+	k.file = f
+	if err = k.save(); err != nil {
+		k.file = prev
+		return err
+	}
+	if k.key != nil {
+		k.key = newKey
+	}
+	return nil
+}
+
+//先写临时文件再替换，避免写到一半时损坏
+func (k *Keystore) save() error {
+	b, err := json.MarshalIndent(k.file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = WriteFileAtomic(k.path, b, 0600); err != nil {
+		return ErrWrap("save keystore", err)
+	}
+	return nil
+}
+
+//左侧补0到固定长度
+func padBytes(b []byte, n int) []byte {
+	if len(b) >= n {
+		return b
+	}
+	r := make([]byte, n)
+	copy(r[n-len(b):], b)
+	return r
+}
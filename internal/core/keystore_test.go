@@ -0,0 +1,212 @@
+package core
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestKeystore(t *testing.T) (*Keystore, string, func()) {
+	KeystoreScryptN = 1 << 10
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "keystore.json")
+	k, err := CreateKeystore(path, "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, path, func() { os.RemoveAll(dir) }
+}
+
+func TestKeystore(t *testing.T) {
+	k, path, clean := newTestKeystore(t)
+	defer clean()
+	if _, err := CreateKeystore(path, "pass"); err == nil {
+		t.Fatal("should not overwrite")
+	}
+	if !k.IsLocked() || k.Add(GetTestWallet(0)) != ErrKeystoreLocked {
+		t.Fatal("new keystore should be locked")
+	}
+	if k.Unlock("bad", 0) != ErrWrongPassphrase {
+		t.Fatal("wrong passphrase")
+	}
+	if err := k.Unlock("pass", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Add(GetTestWallet(0)); err != nil {
+		t.Fatal(err)
+	}
+	w, err := k.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0600 {
+		t.Fatal("file mode", fi.Mode())
+	}
+	//重新打开
+	k2, err := OpenKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addrs := k2.Addresses(); len(addrs) != 2 || addrs[0] != GetTestWallet(0).Address() || addrs[1] != w.Address() {
+		t.Fatal("addresses", addrs)
+	}
+	if _, err = k2.Wallet(w.Address()); err != ErrKeystoreLocked {
+		t.Fatal("locked")
+	}
+	if err = k2.Unlock("pass", 0); err != nil {
+		t.Fatal(err)
+	}
+	w2, err := k2.Wallet(w.Address())
+	if err != nil || w2.Address() != w.Address() {
+		t.Fatal("restore wallet")
+	}
+	if _, err = k2.Wallet(GetTestWallet(1).Address()); err != ErrKeystoreNotFound {
+		t.Fatal("not found")
+	}
+	ws, _ := k2.Wallets()
+	if len(ws) != 2 || ws[0].Address() != GetTestWallet(0).Address() {
+		t.Fatal("wallets")
+	}
+	k2.Lock()
+	if !k2.IsLocked() {
+		t.Fatal("lock")
+	}
+}
+
+func TestKeystore_Timeout(t *testing.T) {
+	k, _, clean := newTestKeystore(t)
+	defer clean()
+	if err := k.Unlock("pass", 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if k.IsLocked() {
+		t.Fatal("should be unlocked")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !k.IsLocked() {
+		t.Fatal("should lock after timeout")
+	}
+}
+
+//重新解锁后，之前已经触发的定时器不会提前锁定
+func TestKeystore_StaleTimer(t *testing.T) {
+	k, _, clean := newTestKeystore(t)
+	defer clean()
+	if err := k.Unlock("pass", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	stale := k.timer
+	if err := k.Unlock("pass", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	k.mu.Lock()
+	k.expire(stale)
+	k.mu.Unlock()
+	if k.IsLocked() {
+		t.Fatal("stale timer locked new session")
+	}
+	k.mu.Lock()
+	k.expire(k.timer)
+	k.mu.Unlock()
+	if !k.IsLocked() {
+		t.Fatal("current timer should lock")
+	}
+}
+
+func TestKeystore_ChangePassphrase(t *testing.T) {
+	k, path, clean := newTestKeystore(t)
+	defer clean()
+	_ = k.Unlock("pass", 0)
+	if err := k.Add(GetTestWallet(3)); err != nil {
+		t.Fatal(err)
+	}
+	if k.ChangePassphrase("bad", "new") != ErrWrongPassphrase {
+		t.Fatal("old passphrase should be checked")
+	}
+	if err := k.ChangePassphrase("pass", "new"); err != nil {
+		t.Fatal(err)
+	}
+	//解锁状态保持，新加的私钥使用新口令
+	if err := k.Add(GetTestWallet(4)); err != nil {
+		t.Fatal(err)
+	}
+	k2, _ := OpenKeystore(path)
+	if k2.Unlock("pass", 0) != ErrWrongPassphrase {
+		t.Fatal("old passphrase should not work")
+	}
+	if err := k2.Unlock("new", 0); err != nil {
+		t.Fatal(err)
+	}
+	if ws, _ := k2.Wallets(); len(ws) != 2 || ws[1].Address() != GetTestWallet(4).Address() {
+		t.Fatal("keys after change")
+	}
+}
+
+func TestKeystore_Tampered(t *testing.T) {
+	k, path, clean := newTestKeystore(t)
+	defer clean()
+	_ = k.Unlock("pass", 0)
+	_ = k.Add(GetTestWallet(0))
+	//替换地址使附加数据不匹配
+	k.file.Keys[0].Address = GetTestWallet(1).Address()
+	if err := k.save(); err != nil {
+		t.Fatal(err)
+	}
+	k2, _ := OpenKeystore(path)
+	if err := k2.Unlock("pass", 0); err == nil {
+		t.Fatal("tampered key should fail")
+	}
+}
+
+func TestKeystore_WatchOnly(t *testing.T) {
+	k, path, clean := newTestKeystore(t)
+	defer clean()
+	//锁定时也可以加入只读地址
+	w1, w2 := GetTestWallet(1), GetTestWallet(2)
+	if a, err := k.AddWatchOnly(w1.Bech32Address()); err != nil || a != w1.Address() {
+		t.Fatal(a, err)
+	}
+	if a, err := k.AddWatchOnly(hex.EncodeToString(w2.PublicKey())); err != nil || a != w2.Address() {
+		t.Fatal(a, err)
+	}
+	if _, err := k.AddWatchOnly("abc"); err == nil {
+		t.Fatal("invalid watch-only")
+	}
+	_ = k.Unlock("pass", 0)
+	c := RestoreWallet(GetTestWallet(3).PrivateKey())
+	c.compressed = true
+	if err := k.Add(c); err != nil {
+		t.Fatal(err)
+	}
+	if !k.IsWatchOnly(w1.Address()) || k.IsWatchOnly(c.Address()) {
+		t.Fatal("watch-only")
+	}
+	if _, err := k.Wallet(w1.Address()); err != ErrWatchOnly {
+		t.Fatal(err)
+	}
+	if len(k.Addresses()) != 3 {
+		t.Fatal("addresses", k.Addresses())
+	}
+	if err := k.ChangePassphrase("pass", "new"); err != nil {
+		t.Fatal(err)
+	}
+	k2, _ := OpenKeystore(path)
+	_ = k2.Unlock("new", 0)
+	ws, _ := k2.Wallets()
+	if len(ws) != 1 || ws[0].Address() != c.Address() || !ws[0].IsCompressed() || !k2.IsWatchOnly(w2.Address()) {
+		t.Fatal("reopen")
+	}
+	//导入私钥后不再是只读地址
+	if err := k2.Add(w1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k2.Wallet(w1.Address()); err != nil || k2.IsWatchOnly(w1.Address()) || len(k2.Addresses()) != 3 {
+		t.Fatal(err)
+	}
+}
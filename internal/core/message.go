@@ -0,0 +1,129 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"math/big"
+)
+
+// ==================================== Signed Message ====================================
+// 用地址的私钥签名任意消息，证明拥有该地址
+// 消息加上前缀后做两次 sha256，避免签名被当作交易签名使用
+// 签名为 1 字节头 + r||s，头部记录恢复公钥需要的信息，验证时只需要地址，传输格式为 base64
+
+const (
+	MessageMagic = "Simple Block Chain Signed Message:\n"
+	//头部 = messageHeaderBase + recid，使用压缩公钥的地址再加 messageCompressedFlag
+	messageHeaderBase     = 27
+	messageCompressedFlag = 4
+	messageSignatureLen   = 1 + SignatureLen
+)
+
+// ==================================== func below ====================================
+
+//带前缀和长度的消息 hash
+func MessageHash(msg string) []byte {
+	b := appendUvarint(nil, uint64(len(MessageMagic)))
+	b = append(b, MessageMagic...)
+	b = appendUvarint(b, uint64(len(msg)))
+	b = append(b, msg...)
+	return Sha256(Sha256(b))
+}
+
+//用钱包地址对应的私钥签名消息
+func SignMessage(w *Wallet, msg string) (string, error) {
+	hash := MessageHash(msg)
+	sign, err := w.Sign(hash)
+	if err != nil {
+		return "", err
+	}
+	var header byte = messageHeaderBase
+	if w.compressed {
+		header += messageCompressedFlag
+	}
+	//恢复出与钱包相同的公钥即为正确的 recid
+	for recId := byte(0); recId < 4; recId++ {
+		pub, err := recoverPubKey(hash, sign, recId)
+		if err == nil && pub.X.Cmp(w.priv.X) == 0 && pub.Y.Cmp(w.priv.Y) == 0 {
+			b := ConcatBytes([]byte{header + recId}, sign)
+			return base64.StdEncoding.EncodeToString(b), nil
+		}
+	}
+	return "", ErrWrapf("can't find recovery id of signature")
+}
+
+//从签名恢复公钥，检查它的地址是否为 address
+func VerifyMessage(address, signature, msg string) error {
+	key, err := AddressToRipemd160PubKey(address)
+	if err != nil {
+		return err
+	}
+	b, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrWrap("invalid message signature", err)
+	}
+	if len(b) != messageSignatureLen || b[0] < messageHeaderBase || b[0] >= messageHeaderBase+2*messageCompressedFlag {
+		return ErrWrapf("invalid message signature")
+	}
+	header := b[0] - messageHeaderBase
+	hash := MessageHash(msg)
+	pub, err := recoverPubKey(hash, b[1:], header%messageCompressedFlag)
+	if err != nil {
+		return err
+	}
+	//压缩和未压缩公钥对应不同的地址
+	var pubKey []byte
+	if header >= messageCompressedFlag {
+		pubKey = compressPubKey(pub.X, pub.Y)
+	} else {
+		pubKey = pubKeyBytes(pub.X, pub.Y)
+	}
+	if !bytes.Equal(Sha160(Sha256(pubKey)), key) || !Verify(hash, b[1:], pubKey) {
+		return ErrWrapf("message signature mismatch address %s", address)
+	}
+	return nil
+}
+
+//ECDSA 公钥恢复 Q = r^-1 (sR - eG)
+//recId 的第 0 位为 R.y 的奇偶，第 1 位表示 R.x = r + n
+func recoverPubKey(hash, sign []byte, recId byte) (*ecdsa.PublicKey, error) {
+	r, s, err := ParseSignature(sign)
+	if err != nil {
+		return nil, err
+	}
+	curve := elliptic.P256()
+	params := curve.Params()
+	x := new(big.Int).Set(r)
+	if recId&2 != 0 {
+		x.Add(x, params.N)
+	}
+	if x.Cmp(params.P) >= 0 {
+		return nil, ErrWrapf("invalid recovery id %d", recId)
+	}
+	rx, ry, err := decompressPubKey(ConcatBytes([]byte{0x02 + recId&1}, padBytes(x.Bytes(), coordLen)))
+	if err != nil {
+		return nil, err
+	}
+	//P-256 的阶为 256 位，hash 不需要截断
+	e := new(big.Int).SetBytes(hash)
+	e.Mod(e, params.N)
+	sx, sy := curve.ScalarMult(rx, ry, padBytes(s.Bytes(), coordLen))
+	ex, ey := curve.ScalarBaseMult(padBytes(e.Bytes(), coordLen))
+	//取负，e = 0 时为无穷远点
+	if ey.Sign() != 0 {
+		ey.Sub(params.P, ey)
+	}
+	qx, qy := curve.Add(sx, sy, ex, ey)
+	rInv := new(big.Int).ModInverse(r, params.N)
+	qx, qy = curve.ScalarMult(qx, qy, padBytes(rInv.Bytes(), coordLen))
+	if (qx.Sign() == 0 && qy.Sign() == 0) || !curve.IsOnCurve(qx, qy) {
+		return nil, ErrWrapf("can't recover public key")
+	}
+	pub := &ecdsa.PublicKey{Curve: curve, X: qx, Y: qy}
+	if !ecdsa.Verify(pub, hash, r, s) {
+		return nil, ErrWrapf("can't recover public key")
+	}
+	return pub, nil
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestSignMessage(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		w := GetTestWallet(i)
+		sign, err := SignMessage(w, "I own this address")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = VerifyMessage(w.Address(), sign, "I own this address"); err != nil {
+			t.Fatal(i, err)
+		}
+		if err = VerifyMessage(w.Bech32Address(), sign, "I own this address"); err != nil {
+			t.Fatal(i, err)
+		}
+		if VerifyMessage(w.Address(), sign, "I own this address!") == nil {
+			t.Fatal("wrong message verified")
+		}
+		if VerifyMessage(GetTestWallet(i+1).Address(), sign, "I own this address") == nil {
+			t.Fatal("wrong address verified")
+		}
+	}
+}
+
+func TestVerifyMessage_Invalid(t *testing.T) {
+	w := GetTestWallet(0)
+	sign, _ := SignMessage(w, "")
+	if err := VerifyMessage(w.Address(), sign, ""); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := base64.StdEncoding.DecodeString(sign)
+	header := b[0]
+	//修改 recid 恢复出其他公钥
+	b[0] = messageHeaderBase + (header - messageHeaderBase) ^ 1
+	if VerifyMessage(w.Address(), base64.StdEncoding.EncodeToString(b), "") == nil {
+		t.Fatal("wrong recovery id verified")
+	}
+	//标记为压缩公钥时对应另一个地址
+	b[0] = header + messageCompressedFlag
+	compressed := base64.StdEncoding.EncodeToString(b)
+	if VerifyMessage(w.Address(), compressed, "") == nil {
+		t.Fatal("compressed flag verified")
+	}
+	if err := VerifyMessage(pubKeyAddress(w.CompressedPublicKey()), compressed, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range []string{"", "not base64", base64.StdEncoding.EncodeToString(b[1:])} {
+		if VerifyMessage(w.Address(), it, "") == nil {
+			t.Fatal("invalid signature verified", it)
+		}
+	}
+	//交易签名使用原始 hash，不能当作消息签名
+	raw, _ := w.Sign([]byte("msg"))
+	fake := base64.StdEncoding.EncodeToString(append([]byte{messageHeaderBase}, raw...))
+	if VerifyMessage(w.Address(), fake, "msg") == nil {
+		t.Fatal("raw signature verified")
+	}
+}
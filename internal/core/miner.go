@@ -1,17 +1,43 @@
 package core
 
+import (
+	"github.com/woodyDM/simple-block-chain/internal/metrics"
+	"strconv"
+	"time"
+)
+
+type generateReq struct {
+	n    int
+	resp chan *generateResp
+}
+
+type generateResp struct {
+	blocks []*Block
+	err    error
+}
+
 type Miner struct {
 	p  *TxPool
 	tx []*Transaction
 	w  *Wallet
+	//Generate 的请求，由 Start 所在的协程处理，m.tx 只在该协程中访问
+	genCh chan *generateReq
+	//挖出的区块数
+	Mined *metrics.Counter
+	//尝试过的hash次数
+	Hashes *metrics.Counter
+	//最近一个区块的hash速度(次/秒)
+	HashRate *metrics.Gauge
 }
 
 func NewMiner(p *TxPool, w *Wallet) *Miner {
 	m := &Miner{
-		p:  p,
-		tx: make([]*Transaction, 0),
-		w:  w,
+		p:     p,
+		tx:    make([]*Transaction, 0),
+		w:     w,
+		genCh: make(chan *generateReq),
 	}
+	m.initMetrics()
 	go m.Start()
 	return m
 }
@@ -22,6 +48,9 @@ func (m *Miner) Start() {
 		select {
 		case tx := <-m.p.txCh:
 			m.handleNewTransaction(tx)
+		case req := <-m.genCh:
+			blocks, err := m.generate(req.n)
+			req.resp <- &generateResp{blocks, err}
 		case <-EndCh:
 			Log.Info("Miner stop when ch end")
 			return
@@ -39,45 +68,134 @@ func (m *Miner) handleNewTransaction(tx *Transaction) {
 	//create new Block
 	toTx := m.tx
 	m.tx = make([]*Transaction, 0)
+	if _, err := m.mineBlock(toTx); err != nil {
+		Log.Error("Error when mine block ", err)
+	}
+}
+
+//立即挖出 n 个区块，第一个区块包含所有等待中的交易，用于 regtest
+func (m *Miner) Generate(n int) ([]*Block, error) {
+	req := &generateReq{n: n, resp: make(chan *generateResp, 1)}
+	select {
+	case m.genCh <- req:
+	case <-EndCh:
+		return nil, ErrWrapf("miner stopped")
+	}
+	r := <-req.resp
+	return r.blocks, r.err
+}
+
+func (m *Miner) generate(n int) ([]*Block, error) {
+	//交易池已发出但还没被取走的交易
+	for drained := false; !drained; {
+		select {
+		case tx := <-m.p.txCh:
+			m.tx = append(m.tx, tx)
+		default:
+			drained = true
+		}
+	}
+	r := make([]*Block, 0, n)
+	for i := 0; i < n; i++ {
+		toTx := m.tx
+		m.tx = make([]*Transaction, 0)
+		b, err := m.mineBlock(toTx)
+		if err != nil {
+			return r, err
+		}
+		r = append(r, b)
+	}
+	return r, nil
+}
+
+func (m *Miner) mineBlock(toTx []*Transaction) (*Block, error) {
+	toTx = m.holdLocked(toTx)
 	//to create coinbase tx and bonus
 	txAll := m.createNewBlockTx(toTx)
 	newBlock, err := m.p.Chain.NewBlock(txAll)
 	if err != nil {
-		Log.Info("Error when create new block!", err)
-		return
+		return nil, ErrWrap("create new block", err)
 	}
+	hash := m.mine(newBlock)
+	newBlock.UpdateHash(hash)
+	Log.Info("============ >>  New  block [", newBlock.Height, "] with hash "+newBlock.Hash+" << ==========")
+	err = m.p.Chain.Append(newBlock)
+	if err != nil {
+		return nil, ErrWrap("append to chain", err)
+	}
+	m.Mined.Inc()
+	//todo sinal tx to clear
+	//交易池可能正阻塞在发送新交易上，等待时继续接收，避免互相等待
+	for {
+		select {
+		case m.p.txBlockCh <- newBlock:
+			return newBlock, nil
+		case tx := <-m.p.txCh:
+			m.tx = append(m.tx, tx)
+		}
+	}
+}
+
+//还不能进入下一个区块的交易留在 m.tx 中，之后的区块再打包，避免整个区块被拒绝
+func (m *Miner) holdLocked(tx []*Transaction) []*Transaction {
+	height, now := m.p.Chain.Tip().Height+1, m.p.Chain.Env.UnixTime()
+	r := make([]*Transaction, 0, len(tx))
+	for _, it := range tx {
+		if err := m.p.Chain.CheckTxLocks(it, height, now); err != nil {
+			Log.Debug("Hold tx ", it.Hash, ": ", err)
+			m.tx = append(m.tx, it)
+			continue
+		}
+		r = append(r, it)
+	}
+	return r
+}
+
+func (m *Miner) initMetrics() {
+	m.Mined = metrics.NewCounter()
+	m.Hashes = metrics.NewCounter()
+	m.HashRate = metrics.NewGauge()
+}
+
+//尝试nonce直到满足难度，同时统计hash速度
+func (m *Miner) mine(b *Block) *HashResult {
+	start := time.Now()
+	var n int64 = 0
 	var hash *HashResult
 	for {
-		hash = newBlock.TryHash()
+		hash = b.TryHash()
+		n++
 		if hash.Ok {
 			break
 		}
 	}
-	newBlock.UpdateHash(hash)
-	Log.Info("============ >>  New  block [", newBlock.Height, "] with hash "+newBlock.Hash+" << ==========")
-	err = m.p.Chain.Append(newBlock)
-	if err != nil {
-		Log.Error("Error when append to Chain ", err)
-		return
+	m.Hashes.Add(float64(n))
+	if d := time.Since(start).Seconds(); d > 0 {
+		m.HashRate.Set(float64(n) / d)
 	}
-	m.p.txBlockCh <- newBlock
-	//todo sinal tx to clear
+	return hash
 }
 
 func (m *Miner) createNewBlockTx(tx []*Transaction) []*Transaction {
+	//矿工获得出块奖励和所有交易的手续费
+	var fees int64 = 0
+	for _, it := range tx {
+		fees += it.TxFee()
+	}
 	coinbase := &Transaction{
 		Timestamp: m.p.Chain.Env.UnixTime(),
 		Type:      NormalTx,
 		Inputs:    make([]*Input, 0),
 		Outputs: []*Output{
 			{
-				Fee:     CoinBaseCount,
+				Fee:     CoinBaseCount + fees,
 				Script:  buildP2PKHOutput(m.w.PublicKey()),
 				TxIndex: 0,
 				Address: m.w.Address(),
 			},
 		},
-		Extra: []byte("coinbase"),
+		//写入区块高度，同一秒内挖出的区块 coinbase 也不会相同
+		Extra: []byte("coinbase " + strconv.FormatUint(m.p.Chain.Tip().Height+1, 10)),
 	}
 	err := coinbase.UpdateHash()
 	if err != nil {
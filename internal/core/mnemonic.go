@@ -0,0 +1,114 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"golang.org/x/crypto/pbkdf2"
+	"math/big"
+	"strings"
+)
+
+// ==================================== Mnemonic ====================================
+// BIP39 助记词: 熵 + sha256 校验位，每 11 位对应单词表中的一个单词
+// 助记词经 PBKDF2-HMAC-SHA512 得到 64 字节种子，作为 HD 钱包的根
+// 注意: 没有做 NFKD 规范化，只使用 ASCII 的口令时与 BIP39 完全一致
+
+const (
+	mnemonicPbkdf2Rounds = 2048
+	mnemonicSeedLen      = 64
+)
+
+var (
+	bip39Words     []string
+	bip39WordIndex map[string]int
+)
+
+func init() {
+	bip39Words = strings.Split(bip39English, "\n")
+	bip39WordIndex = make(map[string]int, len(bip39Words))
+	for i, it := range bip39Words {
+		bip39WordIndex[it] = i
+	}
+}
+
+//生成 bits 位的随机熵，bits 为 128 ~ 256 之间 32 的倍数
+func NewEntropy(bits int) ([]byte, error) {
+	if err := checkEntropyBits(bits); err != nil {
+		return nil, err
+	}
+	b := make([]byte, bits/8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, ErrWrap("generate entropy", err)
+	}
+	return b, nil
+}
+
+func checkEntropyBits(bits int) error {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return ErrWrapf("invalid entropy size %d bits", bits)
+	}
+	return nil
+}
+
+//熵转换为助记词，128 位熵对应 12 个单词，256 位对应 24 个
+func NewMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if err := checkEntropyBits(bits); err != nil {
+		return "", err
+	}
+	checksumBits := uint(bits / 32)
+	//熵后面接上 sha256 的前 checksumBits 位
+	n := new(big.Int).SetBytes(entropy)
+	n.Lsh(n, checksumBits)
+	n.Or(n, big.NewInt(int64(Sha256(entropy)[0]>>(8-checksumBits))))
+	count := (bits + int(checksumBits)) / 11
+	words := make([]string, count)
+	mask := big.NewInt(2047)
+	idx := new(big.Int)
+	for i := count - 1; i >= 0; i-- {
+		idx.And(n, mask)
+		words[i] = bip39Words[idx.Int64()]
+		n.Rsh(n, 11)
+	}
+	return strings.Join(words, " "), nil
+}
+
+//校验助记词并还原熵
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	count := len(words)
+	if count < 12 || count > 24 || count%3 != 0 {
+		return nil, ErrWrapf("invalid mnemonic word count %d", count)
+	}
+	n := new(big.Int)
+	for _, w := range words {
+		i, ok := bip39WordIndex[strings.ToLower(w)]
+		if !ok {
+			return nil, ErrWrapf("unknown mnemonic word %q", w)
+		}
+		n.Lsh(n, 11)
+		n.Or(n, big.NewInt(int64(i)))
+	}
+	checksumBits := uint(count / 3)
+	checksum := new(big.Int).And(n, big.NewInt(int64(1)<<checksumBits-1))
+	n.Rsh(n, checksumBits)
+	entropy := padBytes(n.Bytes(), int(checksumBits)*4)
+	if int64(Sha256(entropy)[0]>>(8-checksumBits)) != checksum.Int64() {
+		return nil, ErrWrapf("invalid mnemonic checksum")
+	}
+	return entropy, nil
+}
+
+func IsMnemonicValid(mnemonic string) bool {
+	_, err := MnemonicToEntropy(mnemonic)
+	return err == nil
+}
+
+//助记词和可选口令生成种子，会先校验助记词
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	if _, err := MnemonicToEntropy(mnemonic); err != nil {
+		return nil, err
+	}
+	normalized := strings.ToLower(strings.Join(strings.Fields(mnemonic), " "))
+	return pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), mnemonicPbkdf2Rounds, mnemonicSeedLen, sha512.New), nil
+}
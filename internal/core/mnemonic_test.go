@@ -0,0 +1,67 @@
+package core
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestNewMnemonic(t *testing.T) {
+	cases := []struct {
+		entropy  string
+		mnemonic string
+	}{
+		{"00000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"},
+		{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank yellow"},
+		{"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote"},
+	}
+	for _, c := range cases {
+		e, _ := hex.DecodeString(c.entropy)
+		m, err := NewMnemonic(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m != c.mnemonic {
+			t.Fatal("mnemonic", m)
+		}
+		back, err := MnemonicToEntropy(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(back) != c.entropy {
+			t.Fatal("entropy", hex.EncodeToString(back))
+		}
+	}
+	if _, err := NewMnemonic(make([]byte, 15)); err == nil {
+		t.Fatal("invalid entropy size should fail")
+	}
+}
+
+func TestMnemonicToSeed(t *testing.T) {
+	m := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	seed, err := MnemonicToSeed(m, "TREZOR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(seed) != "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04" {
+		t.Fatal("seed", hex.EncodeToString(seed))
+	}
+}
+
+func TestMnemonicToEntropy_Invalid(t *testing.T) {
+	bad := []string{
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abou",
+		"abandon abandon abandon",
+	}
+	for _, it := range bad {
+		if IsMnemonicValid(it) {
+			t.Fatal("should be invalid", it)
+		}
+	}
+	e, _ := NewEntropy(160)
+	m, _ := NewMnemonic(e)
+	if len(strings.Fields(m)) != 15 || !IsMnemonicValid(strings.ToUpper(m)) {
+		t.Fatal("generated mnemonic", m)
+	}
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"bytes"
+)
+
+// ==================================== MultiSig ====================================
+// m-of-n 多重签名输出，需要 n 个公钥中任意 m 个的签名才能花费
+// 多重签名地址为 Base58Check(版本 + 输出脚本序列化)，付款方从地址还原完整的脚本，utxo 也按该地址索引
+// 花费时用 PartialTx 收集各方的签名，签名的顺序必须与脚本中公钥的顺序相同
+
+const (
+	MaxMultiSigKeys = 16
+	//P2PKH 地址的长度，多重签名地址总是更长
+	p2pkhAddressLen = LenVersion + LenRipemd160 + LenCheckSum
+)
+
+// ==================================== func below ====================================
+
+//m-of-n 多重签名地址
+func MultiSigAddress(m int, pubKeys [][]byte) (string, error) {
+	s, err := buildMultiSigOutput(m, pubKeys)
+	if err != nil {
+		return "", err
+	}
+	return multiSigScriptAddress(s), nil
+}
+
+func multiSigScriptAddress(s *Script) string {
+	b := ConcatBytes([]byte{ActiveNet().MultiSigVersion}, s.Bytes())
+	return Base58(ConcatBytes(b, Sha256(Sha256(b))[:LenCheckSum]))
+}
+
+//解析多重签名地址，不是多重签名地址时 ok 为 false
+func multiSigAddressScript(add string) (s *Script, ok bool, err error) {
+	b, err := Base58Decode(add)
+	if err != nil || len(b) <= p2pkhAddressLen {
+		return nil, false, nil
+	}
+	n, ok := netByMultiSigVersion(b[0])
+	if !ok {
+		return nil, false, nil
+	}
+	payload := b[:len(b)-LenCheckSum]
+	if !bytes.Equal(b[len(b)-LenCheckSum:], Sha256(Sha256(payload))[:LenCheckSum]) {
+		return nil, true, ErrWrapf("invalid multisig address,checksum failed")
+	}
+	if active := ActiveNet(); n != active {
+		return nil, true, ErrWrapf("address %s is for network %s, active network is %s", add, n.Name, active.Name)
+	}
+	s, err = ParseScript(payload[LenVersion:])
+	if err != nil {
+		return nil, true, err
+	}
+	if _, _, isMulti := parseMultiSigScript(s); !isMulti {
+		return nil, true, ErrWrapf("invalid multisig address script %s", s.Asm())
+	}
+	return s, true, nil
+}
+
+//多重签名输出脚本中的 m 和公钥
+func parseMultiSigScript(s *Script) (int, [][]byte, bool) {
+	if s == nil || len(*s) < 7 || len(*s)%2 == 0 || !bytes.Equal((*s)[0], OpPushNumA) {
+		return 0, nil, false
+	}
+	m, err := parseScriptNum((*s)[1])
+	if err != nil {
+		return 0, nil, false
+	}
+	keys := make([][]byte, 0)
+	for i := 3; i < len(*s)-3; i += 2 {
+		keys = append(keys, (*s)[i])
+	}
+	//按相同的参数重新构建，结构完全一致才是多重签名脚本
+	built, err := buildMultiSigOutput(int(m), keys)
+	if err != nil || !bytes.Equal(built.Bytes(), s.Bytes()) {
+		return 0, nil, false
+	}
+	return int(m), keys, true
+}
+
+//多重签名输出中是否有该公钥
+func multiSigHasKey(s *Script, pubKey []byte) bool {
+	_, keys, ok := parseMultiSigScript(s)
+	if !ok {
+		return false
+	}
+	for _, it := range keys {
+		if bytes.Equal(it, pubKey) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func testMultiSigKeys(ids ...int) [][]byte {
+	r := make([][]byte, 0, len(ids))
+	for _, i := range ids {
+		r = append(r, getTestWallet_(i).PublicKey())
+	}
+	return r
+}
+
+func TestMultiSigAddress(t *testing.T) {
+	keys := testMultiSigKeys(1, 2, 3)
+	addr, err := MultiSigAddress(2, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := AddressToScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, parsed, ok := parseMultiSigScript(s)
+	if !ok || m != 2 || len(parsed) != 3 || !strings.HasSuffix(s.Asm(), "OP_PUSHNUM 3 OP_CHECKMULTISIG") {
+		t.Fatal(s.Asm())
+	}
+	if c, err := CanonicalAddress(addr); err != nil || c != addr {
+		t.Fatal(c, err)
+	}
+	//多重签名地址不是公钥 hash
+	if _, err = AddressToRipemd160PubKey(addr); err == nil {
+		t.Fatal("multisig address as pubkey hash")
+	}
+	for _, it := range []struct {
+		m    int
+		keys [][]byte
+	}{
+		{0, keys},
+		{4, keys},
+		{1, nil},
+		{1, [][]byte{{1, 2, 3}}},
+	} {
+		if _, err = MultiSigAddress(it.m, it.keys); err == nil {
+			t.Fatal(it.m, len(it.keys))
+		}
+	}
+	b, _ := Base58Decode(addr)
+	b[len(b)-1] ^= 1
+	if _, err = CanonicalAddress(Base58(b)); err == nil {
+		t.Fatal("checksum")
+	}
+	SetActiveNet(RegTestParams)
+	defer SetActiveNet(MainNetParams)
+	if _, err = AddressToScript(addr); err == nil || !strings.Contains(err.Error(), "network main") {
+		t.Fatal(err)
+	}
+}
+
+func TestPartialTx_MultiSig(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	addr, _ := MultiSigAddress(2, testMultiSigKeys(2, 3, 4))
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w1.Address())[0].TxHash].Outputs[0]
+	fund, err := BuildTx([]*Output{prev}, w1.Request(addr, 30, "multisig"), MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := pool.Submit(fund); r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	<-pool.txCh
+	appendTestBlock(t, pool, fund)
+	if pool.Chain.Balance(addr) != 30 {
+		t.Fatal("multisig balance", pool.Chain.Balance(addr))
+	}
+	//花费多重签名输出，找零回到多重签名地址
+	out := fund.Outputs[1]
+	p, err := CreatePartialTx([]*Output{out}, &TxRequest{From: addr, To: w1.Address(), Fee: 10}, MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := p.Sign(getTestWallet_(5)); n != 0 {
+		t.Fatal("signed by outsider")
+	}
+	if n, err := p.Sign(getTestWallet_(4)); n != 1 || err != nil {
+		t.Fatal(n, err)
+	}
+	if p.IsComplete() {
+		t.Fatal("1 of 2 signatures")
+	}
+	if _, err = p.Finalize(); err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Fatal(err)
+	}
+	_, _ = p.Sign(getTestWallet_(2))
+	if !p.IsComplete() {
+		t.Fatal("2 of 2 signatures")
+	}
+	tx, err := p.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//签名按公钥的顺序排列
+	hash, _ := tx.SigHash(0)
+	if len(*tx.Inputs[0].Script) != 4 || !Verify(hash, (*tx.Inputs[0].Script)[1], getTestWallet_(2).PublicKey()) {
+		t.Fatal(tx.Inputs[0].Script.Asm())
+	}
+	//同一个输出的另一笔花费不能重用这些签名
+	w5 := getTestWallet_(5)
+	other, _ := CreatePartialTx([]*Output{out}, &TxRequest{From: addr, To: w5.Address(), Fee: 10}, MockGlobalEvn.UnixTime())
+	other.Inputs[0].Signatures = p.Inputs[0].Signatures
+	if other.IsComplete() {
+		t.Fatal("signatures reused by another spend")
+	}
+	if _, err = other.Finalize(); err == nil {
+		t.Fatal("finalize with reused signatures")
+	}
+	raw, _ := EncodeRawTx(tx)
+	replay, _ := DecodeRawTx(raw)
+	replay.Outputs[1].Address, replay.Outputs[1].Script = w5.Address(), buildP2PKHOutput(w5.PublicKey())
+	_ = replay.UpdateHash()
+	if r := pool.Submit(replay); r.Err() == nil || !strings.Contains(r.Err().Error(), "script verify fail") {
+		t.Fatal("replayed signatures", r.Err())
+	}
+	if r := pool.Submit(tx); r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	if tx.Outputs[0].Address != addr || tx.Outputs[0].Fee != 20 {
+		t.Fatal("change to multisig")
+	}
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"strings"
+	"sync"
+)
+
+// ==================================== Network Params ====================================
+// 每个网络有自己的地址前缀和创世区块，避免测试币被发送到正式网络格式的地址
+// 进程启动时用 SetActiveNet 选择网络，之后地址的编码和解析都使用该网络的参数
+
+type NetParams struct {
+	Name string
+	//地址的版本字节
+	AddressVersion byte
+	//bech32 地址的前缀
+	Bech32HRP string
+	//WIF 私钥的版本字节，为地址版本 + 0x80
+	PrivateKeyVersion byte
+	//多重签名地址的版本字节
+	MultiSigVersion byte
+	//P2SH 地址的版本字节
+	ScriptAddressVersion byte
+	//创世区块的 nonce 和 hash，创世交易的输出地址随网络变化
+	GenesisNonce string
+	GenesisHash  string
+}
+
+var (
+	MainNetParams = &NetParams{
+		Name:                 "main",
+		AddressVersion:       Version,
+		Bech32HRP:            "sbc",
+		PrivateKeyVersion:    0x80,
+		MultiSigVersion:      0x32,
+		ScriptAddressVersion: 0x05,
+		GenesisNonce:         GenesisBlockNonce,
+		GenesisHash:          GenesisBlockHash,
+	}
+	TestNetParams = &NetParams{
+		Name:                 "test",
+		AddressVersion:       0x6f,
+		Bech32HRP:            "tsbc",
+		PrivateKeyVersion:    0xef,
+		MultiSigVersion:      0x70,
+		ScriptAddressVersion: 0xc4,
+		GenesisNonce:         "16876914bde76596",
+		GenesisHash:          "000e414d651271788415f51342528e41fbf3269aa689ab8005ff0cbe86c04cc8",
+	}
+	RegTestParams = &NetParams{
+		Name:                 "regtest",
+		AddressVersion:       0x7a,
+		Bech32HRP:            "sbcrt",
+		PrivateKeyVersion:    0xfa,
+		MultiSigVersion:      0x7b,
+		ScriptAddressVersion: 0x7c,
+		GenesisNonce:         "4ed3b6b3ee630830",
+		GenesisHash:          "000a3e554f38365ec7bbc0a3cb15b5a92556151875d405d38abbd2a50cab7076",
+	}
+
+	netParams = []*NetParams{MainNetParams, TestNetParams, RegTestParams}
+	activeNet = MainNetParams
+	netMu     sync.RWMutex
+)
+
+// ==================================== func below ====================================
+
+func ParseNet(name string) (*NetParams, error) {
+	for _, it := range netParams {
+		if it.Name == name {
+			return it, nil
+		}
+	}
+	return nil, ErrWrapf("unknown network %s", name)
+}
+
+//当前网络，默认为 main
+func ActiveNet() *NetParams {
+	netMu.RLock()
+	defer netMu.RUnlock()
+	return activeNet
+}
+
+//切换网络，需要在创建区块链和钱包地址之前调用
+func SetActiveNet(p *NetParams) {
+	netMu.Lock()
+	defer netMu.Unlock()
+	activeNet = p
+}
+
+//按版本字节查找网络
+func netByAddressVersion(v byte) (*NetParams, bool) {
+	for _, it := range netParams {
+		if it.AddressVersion == v {
+			return it, true
+		}
+	}
+	return nil, false
+}
+
+//按 WIF 版本字节查找网络
+func netByPrivateKeyVersion(v byte) (*NetParams, bool) {
+	for _, it := range netParams {
+		if it.PrivateKeyVersion == v {
+			return it, true
+		}
+	}
+	return nil, false
+}
+
+//按多重签名地址的版本字节查找网络
+func netByMultiSigVersion(v byte) (*NetParams, bool) {
+	for _, it := range netParams {
+		if it.MultiSigVersion == v {
+			return it, true
+		}
+	}
+	return nil, false
+}
+
+//按 P2SH 地址的版本字节查找网络
+func netByScriptAddressVersion(v byte) (*NetParams, bool) {
+	for _, it := range netParams {
+		if it.ScriptAddressVersion == v {
+			return it, true
+		}
+	}
+	return nil, false
+}
+
+//按 bech32 前缀查找网络，不是 bech32 地址时返回 false
+func netByBech32Address(add string) (*NetParams, bool) {
+	hrp := strings.ToLower(add)
+	if i := strings.LastIndexByte(hrp, bech32Separator); i > 0 {
+		hrp = hrp[:i]
+	}
+	for _, it := range netParams {
+		if it.Bech32HRP == hrp {
+			return it, true
+		}
+	}
+	return nil, false
+}
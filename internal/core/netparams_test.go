@@ -0,0 +1,51 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNetParams_Genesis(t *testing.T) {
+	defer SetActiveNet(MainNetParams)
+	for _, p := range []*NetParams{MainNetParams, TestNetParams, RegTestParams} {
+		SetActiveNet(p)
+		b := genesisBlock()
+		r := b.HashWith(p.GenesisNonce)
+		if !r.Ok || r.Hash != p.GenesisHash {
+			t.Fatal(p.Name, "genesis hash", r.Hash)
+		}
+		c := Genesis(MockGlobalEvn)
+		w := getTestWallet()
+		if c.Balance(w.Address()) != GenesisCoinCount {
+			t.Fatal(p.Name, "genesis coins should use network address")
+		}
+	}
+}
+
+func TestNetParams_Address(t *testing.T) {
+	defer SetActiveNet(MainNetParams)
+	w := getTestWallet()
+	main := w.Address()
+	SetActiveNet(RegTestParams)
+	reg := w.Address()
+	if reg == main {
+		t.Fatal("address should differ by network")
+	}
+	if _, err := AddressToRipemd160PubKey(reg); err != nil {
+		t.Fatal(err)
+	}
+	_, err := AddressToRipemd160PubKey(main)
+	if err == nil || !strings.Contains(err.Error(), "is for network main, active network is regtest") {
+		t.Fatal("wrong network", err)
+	}
+	SetActiveNet(MainNetParams)
+	if _, err = AddressToRipemd160PubKey(reg); err == nil || !strings.Contains(err.Error(), "network regtest") {
+		t.Fatal("wrong network", err)
+	}
+	if p, err := ParseNet("test"); err != nil || p != TestNetParams {
+		t.Fatal("parse net")
+	}
+	if _, err = ParseNet("nope"); err == nil {
+		t.Fatal("unknown net")
+	}
+}
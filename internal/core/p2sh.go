@@ -0,0 +1,115 @@
+package core
+
+import (
+	"bytes"
+)
+
+// ==================================== P2SH ====================================
+// 输出只包含赎回脚本的 hash，付款方不需要知道花费的条件
+// 花费时输入在参数之后给出赎回脚本，先校验赎回脚本的 hash，再用剩余的参数执行赎回脚本
+// P2SH 地址为 Base58Check(ScriptAddressVersion + Sha160(Sha256(赎回脚本序列化)))，与 P2PKH 地址长度相同
+
+const (
+	//赎回脚本序列化后的最大长度
+	MaxRedeemScriptLen = 520
+)
+
+// ==================================== func below ====================================
+
+//赎回脚本的 hash
+func ScriptHash(redeem *Script) []byte {
+	return Sha160(Sha256(redeem.Bytes()))
+}
+
+//赎回脚本对应的 P2SH 地址
+func P2SHAddress(redeem *Script) string {
+	return ScriptHashToAddress(ScriptHash(redeem))
+}
+
+//脚本 hash 编码为当前网络的 P2SH 地址
+func ScriptHashToAddress(h []byte) string {
+	version := ActiveNet().ScriptAddressVersion
+	checkSum := Sha256(Sha256(ConcatBytes([]byte{version}, h)))[:LenCheckSum]
+	return Base58(ConcatBytes([]byte{version}, h, checkSum))
+}
+
+//解析 P2SH 地址，返回赎回脚本的 hash
+func AddressToScriptHash(add string) ([]byte, error) {
+	version, result, err := decodeBase58Address(add)
+	if err != nil {
+		return nil, err
+	}
+	active := ActiveNet()
+	if version == active.AddressVersion {
+		return nil, ErrWrapf("address %s is a public key hash address", add)
+	}
+	if version != active.ScriptAddressVersion {
+		return nil, addressVersionError(add, version)
+	}
+	return result, nil
+}
+
+//OP_SHA160 OP_PUSH <script hash> OP_EQUAL
+func buildP2SHOutput(scriptHash []byte) *Script {
+	return &Script{
+		OpSha160A,
+		OpPushDataA,
+		CopyBytes(scriptHash),
+		OpEqualA,
+	}
+}
+
+//<args> OP_PUSH <redeem script>
+func buildP2SHInput(args, redeem *Script) *Script {
+	s := ConcatScript(args, &Script{})
+	s.append(OpPushDataA)
+	s.append(redeem.Bytes())
+	return s
+}
+
+//P2SH 输出中赎回脚本的 hash
+func p2shScriptHash(s *Script) ([]byte, bool) {
+	if s == nil || len(*s) != 4 || !bytes.Equal((*s)[0], OpSha160A) || !bytes.Equal((*s)[1], OpPushDataA) ||
+		len((*s)[2]) != LenRipemd160 || !bytes.Equal((*s)[3], OpEqualA) {
+		return nil, false
+	}
+	return (*s)[2], true
+}
+
+//输入只包含 OP_PUSHDATA 和 OP_PUSHNUM
+func isPushOnly(s *Script) bool {
+	for i := 0; i < len(*s); i += 2 {
+		op := (*s)[i]
+		if !bytes.Equal(op, OpPushDataA) && !bytes.Equal(op, OpPushNumA) {
+			return false
+		}
+		if i+1 >= len(*s) {
+			return false
+		}
+	}
+	return true
+}
+
+//第一步用赎回脚本执行输出脚本校验 hash，第二步用剩余的参数执行赎回脚本
+func verifyP2SH(in, out *Script, ctx *TxContext) error {
+	n := len(*in)
+	if !isPushOnly(in) || n < 2 || !bytes.Equal((*in)[n-2], OpPushDataA) {
+		return ErrWrapf("P2SH input must be push only and end with redeem script")
+	}
+	b := (*in)[n-1]
+	if len(b) > MaxRedeemScriptLen {
+		return ErrWrapf("redeem script size %d exceeds %d", len(b), MaxRedeemScriptLen)
+	}
+	if err := execScript(ConcatScript(&Script{OpPushDataA, b}, out), ctx); err != nil {
+		return ErrWrap("redeem script hash mismatch", err)
+	}
+	redeem, err := ParseScript(b)
+	if err != nil {
+		return ErrWrap("invalid redeem script", err)
+	}
+	if _, ok := p2shScriptHash(redeem); ok {
+		return ErrWrapf("nested P2SH redeem script")
+	}
+	args := (*in)[:n-2]
+	return execScript(ConcatScript(&args, redeem), ctx)
+}
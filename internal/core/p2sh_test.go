@@ -0,0 +1,143 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestP2SHAddress(t *testing.T) {
+	redeem, _ := buildMultiSigOutput(1, testMultiSigKeys(1, 2))
+	addr := P2SHAddress(redeem)
+	h, err := AddressToScriptHash(addr)
+	if err != nil || !bytes.Equal(h, ScriptHash(redeem)) {
+		t.Fatal(err)
+	}
+	s, err := AddressToScript(addr)
+	if err != nil || s.Asm() != "OP_SHA160 OP_PUSHDATA "+hex.EncodeToString(h)+" OP_EQUAL" {
+		t.Fatal(s, err)
+	}
+	if c, err := CanonicalAddress(addr); err != nil || c != addr {
+		t.Fatal(c, err)
+	}
+	//P2SH 地址没有公钥 hash，P2PKH 地址也不是脚本 hash
+	if _, err = AddressToRipemd160PubKey(addr); err == nil || !strings.Contains(err.Error(), "script hash") {
+		t.Fatal(err)
+	}
+	if _, err = AddressToScriptHash(getTestWallet().Address()); err == nil {
+		t.Fatal("P2PKH address as script hash")
+	}
+	if _, err = AddressToScriptHash(getTestWallet().Bech32Address()); err == nil {
+		t.Fatal("bech32 address as script hash")
+	}
+	SetActiveNet(TestNetParams)
+	defer SetActiveNet(MainNetParams)
+	if _, err = AddressToScript(addr); err == nil || !strings.Contains(err.Error(), "network main") {
+		t.Fatal(err)
+	}
+	if P2SHAddress(redeem) == addr {
+		t.Fatal("same address on test network")
+	}
+}
+
+func TestVerifyScript_P2SH(t *testing.T) {
+	w := getTestWallet()
+	redeem := buildP2PKHOutput(w.PublicKey())
+	out := buildP2SHOutput(ScriptHash(redeem))
+	tx := &Transaction{Type: NormalTx, Inputs: []*Input{{Output: &Output{TxHash: hex.EncodeToString(Sha256([]byte("p2sh"))), Script: out}}}}
+	verify := func(in, o *Script) error {
+		tx.Inputs[0].Script, tx.Inputs[0].Output.Script = in, o
+		return VerifyScript(tx, 0)
+	}
+	hash, _ := tx.SigHash(0)
+	args, _ := buildP2PKHInput(hash, w)
+	if err := verify(buildP2SHInput(args, redeem), out); err != nil {
+		t.Fatal(err)
+	}
+	other := buildP2PKHOutput(getTestWallet_(2).PublicKey())
+	nested := buildP2SHOutput(ScriptHash(redeem))
+	for name, in := range map[string]*Script{
+		"wrong redeem script": buildP2SHInput(args, other),
+		"wrong signature":     buildP2SHInput(&Script{OpPushDataA, (*args)[1], OpPushDataA, getTestWallet_(2).PublicKey()}, redeem),
+		"not push only":       ConcatScript(&Script{OpDuplicateA}, buildP2SHInput(args, redeem)),
+		"extra argument":      buildP2SHInput(ConcatScript(&Script{OpPushDataA, CodeTrue}, args), redeem),
+		"no redeem script":    args,
+		"nested P2SH":         buildP2SHInput(&Script{}, nested),
+	} {
+		o := out
+		if name == "nested P2SH" {
+			o = buildP2SHOutput(ScriptHash(nested))
+		}
+		if err := verify(in, o); err == nil {
+			t.Fatal(name)
+		}
+	}
+}
+
+func TestPartialTx_P2SH(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	redeem, _ := buildMultiSigOutput(2, testMultiSigKeys(2, 3, 4))
+	addr := P2SHAddress(redeem)
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w1.Address())[0].TxHash].Outputs[0]
+	fund, err := BuildTx([]*Output{prev}, w1.Request(addr, 30, "p2sh"), MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//输出只有脚本 hash，地址为 P2SH 地址
+	out := fund.Outputs[1]
+	if out.Address != addr || len(*out.Script) != 4 {
+		t.Fatal(out.Address, out.Script.Asm())
+	}
+	if r := pool.Submit(fund); r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	<-pool.txCh
+	appendTestBlock(t, pool, fund)
+	if pool.Chain.Balance(addr) != 30 {
+		t.Fatal("P2SH balance", pool.Chain.Balance(addr))
+	}
+	p, err := CreatePartialTx([]*Output{out}, &TxRequest{From: addr, To: w1.Address(), Fee: 10}, MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//没有赎回脚本时不知道该由谁签名
+	if n, _ := p.Sign(getTestWallet_(2)); n != 0 {
+		t.Fatal("signed without redeem script")
+	}
+	other, _ := buildMultiSigOutput(1, testMultiSigKeys(2))
+	if p.AddRedeemScript(other) != 0 || p.AddRedeemScript(redeem) != 1 {
+		t.Fatal("add redeem script")
+	}
+	if n, err := p.Sign(getTestWallet_(4)); n != 1 || err != nil {
+		t.Fatal(n, err)
+	}
+	//赎回脚本随 PartialTx 传输
+	p2, err := ParsePartialTx(p.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = p2.Sign(getTestWallet_(3))
+	if !p2.IsComplete() {
+		t.Fatal("2 of 3 signatures")
+	}
+	tx, err := p2.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in := *tx.Inputs[0].Script; len(in) != 6 || !bytes.Equal(in[5], redeem.Bytes()) {
+		t.Fatal(tx.Inputs[0].Script.Asm())
+	}
+	if r := pool.Submit(tx); r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	if tx.Outputs[0].Address != addr || tx.Outputs[0].Fee != 20 {
+		t.Fatal("change to P2SH")
+	}
+	//赎回脚本与输出不符时不能解析
+	p2.Inputs[0].RedeemScript = other
+	if _, err = ParsePartialTx(p2.String()); err == nil {
+		t.Fatal("redeem script mismatch")
+	}
+}
@@ -0,0 +1,311 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// ==================================== Partially Signed Tx ====================================
+// 部分签名的交易，用于离线签名和多方签名
+// 在线的只读节点用 CreatePartialTx 构建交易，离线机器用 Sign 签名，Combine 合并多方签名，Finalize 得到可提交的交易
+// 传输格式为 json 的 base64
+
+const (
+	PartialTxVersion = 1
+)
+
+type PartialTx struct {
+	Version int
+	//输入脚本为空的交易，Input.Output 为花费的之前的输出
+	Tx *Transaction
+	//与 Tx.Inputs 一一对应
+	Inputs []*PartialInput
+}
+
+type PartialInput struct {
+	//key 为公钥 hex，value 为该公钥的签名
+	Signatures map[string][]byte
+	//花费 P2SH 输出时的赎回脚本
+	RedeemScript *Script
+}
+
+// ==================================== func below ====================================
+
+//使用 prevOuts 构建未签名的交易，找零付给 req.From，不需要钱包
+func CreatePartialTx(prevOuts []*Output, req *TxRequest, timestamp int64) (*PartialTx, error) {
+	if _, err := CanonicalAddress(req.From); err != nil {
+		return nil, ErrWrap("invalid change address", err)
+	}
+	tx, err := buildUnsignedTx(prevOuts, req.recipients(), req.TxFee, changeTolerance(req.selector()), req.From, req.Extra, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	req.setLocks(tx)
+	if err = tx.UpdateHash(); err != nil {
+		return nil, err
+	}
+	p := &PartialTx{
+		Version: PartialTxVersion,
+		Tx:      tx,
+		Inputs:  make([]*PartialInput, len(tx.Inputs)),
+	}
+	for i := range p.Inputs {
+		p.Inputs[i] = &PartialInput{Signatures: make(map[string][]byte)}
+	}
+	return p, nil
+}
+
+func ParsePartialTx(s string) (*PartialTx, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrWrap("decode partial tx", err)
+	}
+	p := new(PartialTx)
+	if err = json.Unmarshal(b, p); err != nil {
+		return nil, ErrWrap("decode partial tx", err)
+	}
+	if err = p.check(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *PartialTx) String() string {
+	b, _ := json.Marshal(p)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func (p *PartialTx) check() error {
+	if p.Version != PartialTxVersion {
+		return ErrWrapf("unsupported partial tx version %d", p.Version)
+	}
+	if p.Tx == nil || len(p.Tx.Inputs) == 0 || len(p.Tx.Inputs) != len(p.Inputs) {
+		return ErrWrapf("invalid partial tx")
+	}
+	for i, in := range p.Tx.Inputs {
+		if in == nil || in.Output == nil || in.Output.Script == nil {
+			return ErrWrapf("partial tx input %d without previous output", i)
+		}
+		if in.Script == nil {
+			in.Script = &Script{}
+		}
+		if len(*in.Script) != 0 {
+			return ErrWrapf("partial tx input %d already signed", i)
+		}
+		if p.Inputs[i] == nil {
+			p.Inputs[i] = &PartialInput{}
+		}
+		if p.Inputs[i].Signatures == nil {
+			p.Inputs[i].Signatures = make(map[string][]byte)
+		}
+		if redeem := p.Inputs[i].RedeemScript; redeem != nil && !matchRedeemScript(in.Output.Script, redeem) {
+			return ErrWrapf("partial tx input %d redeem script mismatch", i)
+		}
+	}
+	for _, o := range p.Tx.Outputs {
+		if o == nil || o.Script == nil {
+			return ErrWrapf("partial tx with incomplete output")
+		}
+	}
+	return p.Tx.UpdateHash()
+}
+
+//未签名交易的 hash，用于判断两个 PartialTx 是否为同一笔交易
+func (p *PartialTx) Hash() string {
+	return p.Tx.Hash
+}
+
+//为输入的 P2SH 输出填入赎回脚本，返回匹配的输入个数
+func (p *PartialTx) AddRedeemScript(redeem *Script) int {
+	n := 0
+	for i, in := range p.Tx.Inputs {
+		if matchRedeemScript(in.Output.Script, redeem) {
+			p.Inputs[i].RedeemScript = redeem
+			n++
+		}
+	}
+	return n
+}
+
+func matchRedeemScript(out, redeem *Script) bool {
+	h, ok := p2shScriptHash(out)
+	return ok && bytes.Equal(h, ScriptHash(redeem))
+}
+
+//签名时要满足的脚本，P2SH 输出为赎回脚本，还没有赎回脚本时为 nil
+func (p *PartialTx) policyScript(i int) *Script {
+	out := p.Tx.Inputs[i].Output.Script
+	if _, ok := p2shScriptHash(out); ok {
+		return p.Inputs[i].RedeemScript
+	}
+	return out
+}
+
+//为脚本是 w 的 P2PKH，或者多重签名中有 w 的公钥的输入签名，返回签名的输入个数
+//P2SH 输入按赎回脚本判断，时间锁的前缀不影响签名
+func (p *PartialTx) Sign(w *Wallet) (int, error) {
+	p2pkh := buildP2PKHOutput(w.PublicKey())
+	pub := hex.EncodeToString(w.PublicKey())
+	n := 0
+	for i, in := range p.Tx.Inputs {
+		policy := stripTimeLock(p.policyScript(i))
+		if policy == nil || !bytes.Equal(policy.Bytes(), p2pkh.Bytes()) && !multiSigHasKey(policy, w.PublicKey()) {
+			continue
+		}
+		sc, err := AddressToScript(in.Output.Address)
+		if err != nil {
+			return n, err
+		}
+		//不签与地址不符的脚本，避免被构造的 PartialTx 骗取签名
+		if !bytes.Equal(sc.CalHash(), in.Output.Script.CalHash()) {
+			return n, ErrWrapf("input %d script mismatch address %s", i, in.Output.Address)
+		}
+		hash, err := p.Tx.SigHash(i)
+		if err != nil {
+			return n, err
+		}
+		sign, err := w.Sign(hash)
+		if err != nil {
+			return n, err
+		}
+		p.Inputs[i].Signatures[pub] = sign
+		n++
+	}
+	return n, nil
+}
+
+//合并同一笔交易的多份签名
+func CombinePartialTx(ps ...*PartialTx) (*PartialTx, error) {
+	if len(ps) == 0 {
+		return nil, ErrWrapf("nothing to combine")
+	}
+	b, err := json.Marshal(ps[0])
+	if err != nil {
+		return nil, err
+	}
+	r := new(PartialTx)
+	if err = json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	if err = r.check(); err != nil {
+		return nil, err
+	}
+	for _, it := range ps[1:] {
+		if it.Hash() != r.Hash() {
+			return nil, ErrWrapf("partial tx %s and %s are different transactions", r.Hash(), it.Hash())
+		}
+		for i, in := range it.Inputs {
+			for pub, sign := range in.Signatures {
+				r.Inputs[i].Signatures[pub] = CopyBytes(sign)
+			}
+			if r.Inputs[i].RedeemScript == nil && in.RedeemScript != nil {
+				if !matchRedeemScript(r.Tx.Inputs[i].Output.Script, in.RedeemScript) {
+					return nil, ErrWrapf("partial tx input %d redeem script mismatch", i)
+				}
+				r.Inputs[i].RedeemScript = in.RedeemScript
+			}
+		}
+	}
+	return r, nil
+}
+
+//每个输入都有与地址匹配且校验通过的签名
+func (p *PartialTx) IsComplete() bool {
+	for i := range p.Tx.Inputs {
+		if _, err := p.inputScript(i); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+//找到输入 i 可用的签名，构建输入脚本并校验
+func (p *PartialTx) inputScript(i int) (*Script, error) {
+	out := p.Tx.Inputs[i].Output
+	policy := p.policyScript(i)
+	if policy == nil {
+		return nil, ErrWrapf("input %d of partial tx %s has no redeem script", i, p.Hash())
+	}
+	script, err := p.signatureScript(i, stripTimeLock(policy))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p2shScriptHash(out.Script); ok {
+		script = buildP2SHInput(script, policy)
+	}
+	if err = verifyScript(script, out.Script, p.context(i)); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+//没有区块上下文，只校验脚本中的时间锁与交易一致
+func (p *PartialTx) context(i int) *TxContext {
+	return &TxContext{Tx: p.Tx, Index: i}
+}
+
+//满足 policy 的签名部分
+func (p *PartialTx) signatureScript(i int, policy *Script) (*Script, error) {
+	if m, keys, ok := parseMultiSigScript(policy); ok {
+		return p.multiSigInputScript(i, m, keys)
+	}
+	for pub, sign := range p.Inputs[i].Signatures {
+		key, err := hex.DecodeString(pub)
+		if err != nil {
+			continue
+		}
+		script := &Script{OpPushDataA, sign, OpPushDataA, key}
+		if execScript(ConcatScript(script, policy), p.context(i)) == nil {
+			return script, nil
+		}
+	}
+	return nil, ErrWrapf("input %d of partial tx %s is not signed", i, p.Hash())
+}
+
+//按公钥的顺序取前 m 个有效的签名
+func (p *PartialTx) multiSigInputScript(i, m int, keys [][]byte) (*Script, error) {
+	hash, err := p.Tx.SigHash(i)
+	if err != nil {
+		return nil, err
+	}
+	signs := make([][]byte, 0, m)
+	for _, key := range keys {
+		sign, ok := p.Inputs[i].Signatures[hex.EncodeToString(key)]
+		if ok && len(signs) < m && Verify(hash, sign, key) {
+			signs = append(signs, sign)
+		}
+	}
+	if len(signs) < m {
+		return nil, ErrWrapf("input %d of partial tx %s has %d of %d signatures", i, p.Hash(), len(signs), m)
+	}
+	return buildMultiSigInput(signs), nil
+}
+
+//填入输入脚本，得到可以提交的交易
+func (p *PartialTx) Finalize() (*Transaction, error) {
+	scripts := make([]*Script, len(p.Tx.Inputs))
+	for i := range p.Tx.Inputs {
+		s, err := p.inputScript(i)
+		if err != nil {
+			return nil, err
+		}
+		scripts[i] = s
+	}
+	b, err := json.Marshal(p.Tx)
+	if err != nil {
+		return nil, err
+	}
+	tx := new(Transaction)
+	if err = json.Unmarshal(b, tx); err != nil {
+		return nil, err
+	}
+	for i, in := range tx.Inputs {
+		in.Script = scripts[i]
+	}
+	if err = tx.UpdateHash(); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"testing"
+)
+
+func genesisOutput(t *testing.T, c *BlockChain, w *Wallet) *Output {
+	us := c.GetUtxo(w.Address())
+	if len(us) != 1 {
+		t.Fatal("genesis utxo")
+	}
+	tx, _ := c.GetTx(us[0].TxHash)
+	return tx.Outputs[us[0].TxOutputIndex]
+}
+
+func TestPartialTx(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1, w2, w3 := getTestWallet_(1), getTestWallet_(2), getTestWallet_(3)
+	//两个地址各出一个输入，找零给 w1
+	prevOuts := []*Output{genesisOutput(t, pool.Chain, w1), genesisOutput(t, pool.Chain, w2)}
+	req := &TxRequest{From: w1.Address(), To: w3.Address(), Fee: 150, TxFee: 2}
+	p, err := CreatePartialTx(prevOuts, req, MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.IsComplete() {
+		t.Fatal("should not be complete")
+	}
+	//传输到离线机器各自签名
+	p1, err := ParsePartialTx(p.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, _ := ParsePartialTx(p.String())
+	if n, err := p1.Sign(w1); n != 1 || err != nil {
+		t.Fatal("sign w1", n, err)
+	}
+	if n, _ := p1.Sign(w3); n != 0 {
+		t.Fatal("w3 owns no input")
+	}
+	if n, err := p2.Sign(w2); n != 1 || err != nil {
+		t.Fatal("sign w2", n, err)
+	}
+	if _, err = p1.Finalize(); err == nil {
+		t.Fatal("input 2 not signed")
+	}
+	back, _ := ParsePartialTx(p1.String())
+	c, err := CombinePartialTx(back, p2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsComplete() || len(p1.Inputs[1].Signatures) != 0 {
+		t.Fatal("combine")
+	}
+	tx, err := c.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.TxFee() != 2 || tx.Outputs[0].Address != w1.Address() || tx.Outputs[0].Fee != 2*GenesisCoinCount-152 {
+		t.Fatal("outputs")
+	}
+	//签名覆盖整个交易，改动输出后签名失效
+	tampered, _ := ParsePartialTx(c.String())
+	tampered.Tx.Outputs[0].Fee -= 50
+	tampered.Tx.Outputs[1].Fee += 50
+	if tampered.IsComplete() {
+		t.Fatal("signatures valid after output changed")
+	}
+	if _, err = tampered.Finalize(); err == nil {
+		t.Fatal("finalize after output changed")
+	}
+	raw, _ := c.Finalize()
+	raw.Outputs[1].Address, raw.Outputs[1].Script = w2.Address(), buildP2PKHOutput(w2.PublicKey())
+	_ = raw.UpdateHash()
+	if resp := pool.Submit(raw); resp.err == nil {
+		t.Fatal("redirected output accepted")
+	}
+	if resp := pool.Submit(tx); resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	//不同的交易不能合并
+	other, _ := CreatePartialTx(prevOuts[:1], req2(w1, w3), MockGlobalEvn.UnixTime())
+	if _, err = CombinePartialTx(c, other); err == nil {
+		t.Fatal("different tx")
+	}
+	if _, err = ParsePartialTx("!!"); err == nil {
+		t.Fatal("invalid encoding")
+	}
+}
+
+func req2(from, to *Wallet) *TxRequest {
+	return &TxRequest{From: from.Address(), To: to.Address(), Fee: 1}
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"bytes"
+)
+
+// ==================================== Time Lock ====================================
+// 绝对时间锁: 交易的 LockTime 小于 LockTimeThreshold 时为区块高度，否则为 unix 时间，0 表示不锁定
+// 只有区块的高度(或时间)大于 LockTime 时交易才是 final，才能进入交易池和区块
+// 相对时间锁: 输入 Sequence 的低 16 位为花费的输出确认后需要经过的区块数，设置 SequenceLockTimeTypeFlag 时单位为 512 秒
+// OP_CHECKLOCKTIMEVERIFY 和 OP_CHECKSEQUENCEVERIFY 把时间锁写进输出脚本，花费时交易必须设置足够的 LockTime 或 Sequence
+
+const (
+	LockTimeThreshold = 500000000
+	//最高位为 1 时没有相对时间锁
+	SequenceLockTimeDisabled = 1 << 31
+	//为 1 时单位为 512 秒，否则为区块数
+	SequenceLockTimeTypeFlag = 1 << 22
+	SequenceLockTimeMask     = 0x0000ffff
+	//时间单位为 2^9 秒
+	SequenceLockTimeGranularity = 9
+)
+
+//脚本执行时的上下文: 花费输出的交易，和将要包含该交易的区块
+type TxContext struct {
+	Tx *Transaction
+	//正在校验的输入下标
+	Index int
+	//区块的高度和时间(unix 秒)
+	Height uint64
+	Time   int64
+}
+
+// ==================================== func below ====================================
+
+//<lockTime> OP_CHECKLOCKTIMEVERIFY OP_DROP <s>，交易的 LockTime 不小于 lockTime 时才能花费
+func LockTimeScript(lockTime int64, s *Script) *Script {
+	return timeLockScript(OpCheckLockTimeVerifyA, lockTime, s)
+}
+
+//<sequence> OP_CHECKSEQUENCEVERIFY OP_DROP <s>，输出确认后经过 sequence 表示的相对时间才能花费
+func SequenceLockScript(sequence uint32, s *Script) *Script {
+	return timeLockScript(OpCheckSequenceVerifyA, int64(sequence), s)
+}
+
+//操作数可能超过 OP_PUSHNUM 的 4 字节，使用 OP_PUSHDATA
+func timeLockScript(op []byte, n int64, s *Script) *Script {
+	return ConcatScript(&Script{OpPushDataA, ScriptNum(n), op, OpDropA}, s)
+}
+
+//去掉时间锁的前缀，得到需要签名满足的脚本
+func stripTimeLock(s *Script) *Script {
+	if s == nil || len(*s) <= 4 || !bytes.Equal((*s)[0], OpPushDataA) && !bytes.Equal((*s)[0], OpPushNumA) ||
+		!bytes.Equal((*s)[2], OpCheckLockTimeVerifyA) && !bytes.Equal((*s)[2], OpCheckSequenceVerifyA) ||
+		!bytes.Equal((*s)[3], OpDropA) {
+		return s
+	}
+	r := (*s)[4:]
+	return &r
+}
+
+//交易在高度为 height、时间为 time 的区块中是否 final
+func (t *Transaction) IsFinal(height uint64, time int64) bool {
+	if t.LockTime == 0 {
+		return true
+	}
+	if t.LockTime < LockTimeThreshold {
+		return t.LockTime < int64(height)
+	}
+	return t.LockTime < time
+}
+
+//Sequence 中的相对时间锁，没有时 ok 为 false
+func sequenceLock(sequence uint32) (value int64, isTime bool, ok bool) {
+	if sequence&SequenceLockTimeDisabled != 0 {
+		return 0, false, false
+	}
+	value = int64(sequence & SequenceLockTimeMask)
+	isTime = sequence&SequenceLockTimeTypeFlag != 0
+	if isTime {
+		value <<= SequenceLockTimeGranularity
+	}
+	return value, isTime, value != 0
+}
+
+//区块的 unix 时间(秒)，创世区块的时间戳是毫秒
+func BlockUnixTime(b *Block) int64 {
+	if b.Height == 0 {
+		return b.Timestamp / 1000
+	}
+	return b.Timestamp
+}
+
+//交易放入高度为 height、时间为 time 的区块时，是否 final 且每个输入的相对时间锁都已满足
+func (c *BlockChain) CheckTxLocks(t *Transaction, height uint64, time int64) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.checkTxLocks(t, height, time)
+}
+
+//调用者持有 c.mu
+func (c *BlockChain) checkTxLocks(t *Transaction, height uint64, time int64) error {
+	if !t.IsFinal(height, time) {
+		return ErrWrapf("Tx %s is not final, lock time %d", t.Hash, t.LockTime)
+	}
+	for i, in := range t.Inputs {
+		value, isTime, ok := sequenceLock(in.Sequence)
+		if !ok {
+			continue
+		}
+		//花费的输出在同一个区块中时，与交易同时确认
+		prevHeight, prevTime := height, time
+		if prev, exist := c.Tx[in.Output.TxHash]; exist {
+			if b, exist := c.Blocks[prev.BlockHash]; exist {
+				prevHeight, prevTime = b.Height, BlockUnixTime(b)
+			}
+		}
+		if isTime && time < prevTime+value || !isTime && height < prevHeight+uint64(value) {
+			return ErrWrapf("Tx %s input %d sequence lock %d not reached", t.Hash, i, in.Sequence)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransaction_IsFinal(t *testing.T) {
+	for _, it := range []struct {
+		lockTime int64
+		height   uint64
+		time     int64
+		final    bool
+	}{
+		{0, 1, 0, true},
+		{5, 5, 0, false},
+		{5, 6, 0, true},
+		//按时间锁定时只看区块时间
+		{LockTimeThreshold + 10, 1000, LockTimeThreshold + 10, false},
+		{LockTimeThreshold + 10, 1, LockTimeThreshold + 11, true},
+	} {
+		tx := &Transaction{LockTime: it.lockTime}
+		if tx.IsFinal(it.height, it.time) != it.final {
+			t.Fatal(it)
+		}
+	}
+}
+
+func TestTransaction_LockTimeHash(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w1.Address())[0].TxHash].Outputs[0]
+	tx, err := BuildTx([]*Output{prev}, w1.Request(getTestWallet_(2).Address(), 10, "lock"), MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := tx.Hash
+	//为 0 时 hash 与没有时间锁的交易相同
+	tx.LockTime = 0
+	tx.Inputs[0].Sequence = 0
+	if _ = tx.UpdateHash(); tx.Hash != hash {
+		t.Fatal("hash changed")
+	}
+	tx.LockTime = 1
+	if _ = tx.UpdateHash(); tx.Hash == hash {
+		t.Fatal("lock time not in hash")
+	}
+	tx.LockTime = 0
+	tx.Inputs[0].Sequence = 1
+	if _ = tx.UpdateHash(); tx.Hash == hash {
+		t.Fatal("sequence not in hash")
+	}
+}
+
+//签名覆盖 LockTime 和 Sequence，去掉时间锁后签名失效
+func TestTransaction_LockTimeSigned(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w1.Address())[0].TxHash].Outputs[0]
+	req := w1.Request(getTestWallet_(2).Address(), 10, "lock")
+	req.LockTime, req.Sequence = 5, 1
+	tx, err := BuildTx([]*Output{prev}, req, MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tamper := range map[string]func(c *Transaction){
+		"lock time": func(c *Transaction) { c.LockTime = 0 },
+		"sequence":  func(c *Transaction) { c.Inputs[0].Sequence = SequenceLockTimeDisabled },
+	} {
+		raw, _ := EncodeRawTx(tx)
+		c, _ := DecodeRawTx(raw)
+		tamper(c)
+		_ = c.UpdateHash()
+		if r := pool.Submit(c); r.Err() == nil || !strings.Contains(r.Err().Error(), "script verify fail") {
+			t.Fatal(name, r.Err())
+		}
+	}
+}
+
+func TestTxPool_Transform_NonFinal(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	req := w1.Request(getTestWallet_(2).Address(), 10, "lock")
+	req.LockTime = 1000
+	if resp := pool.Transform(req); resp.Err() == nil || !strings.Contains(resp.Err().Error(), "not final") {
+		t.Fatal(resp.Err())
+	}
+	if len(pool.usedUtxo.GetUtxo(w1.Address())) != 0 {
+		t.Fatal("utxo used by non final tx")
+	}
+}
+
+//还不是 final 的交易留到之后的区块，其它交易正常打包
+func TestMiner_HoldNonFinal(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	m := &Miner{p: pool, w: w1}
+	m.initMetrics()
+	utxos := pool.Chain.GetUtxo(w1.Address())
+	req := w1.Request(getTestWallet_(2).Address(), 10, "lock")
+	req.LockTime = 2
+	locked, err := BuildTx([]*Output{pool.Chain.Tx[utxos[0].TxHash].Outputs[0]}, req, MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2 := getTestWallet2()
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w2.Address())[0].TxHash].Outputs[0]
+	other, err := BuildTx([]*Output{prev}, w2.Request(getTestWallet_(3).Address(), 10, "other"), MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := pool.Submit(other); r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	<-pool.txCh
+	//交易池不接受不是 final 的交易，直接占用它的输入，模拟在交易池中重新变得不是 final 的交易
+	pool.usedUtxo.AddUtxo(newUtxo(locked.Inputs[0].Output))
+	b, err := m.mineBlock([]*Transaction{locked, other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Tx) != 2 || b.Tx[1] != other || len(m.tx) != 1 || m.tx[0] != locked {
+		t.Fatal("non final tx should be held")
+	}
+	//高度 3 时 LockTime 2 才是 final
+	for _, n := range []int{1, 2} {
+		toTx := m.tx
+		m.tx = nil
+		if b, err = m.mineBlock(toTx); err != nil || len(b.Tx) != n {
+			t.Fatal(b.Height, err)
+		}
+	}
+	if len(m.tx) != 0 {
+		t.Fatal("held tx not mined")
+	}
+}
+
+func TestVmExec_OpCheckLockTimeVerify(t *testing.T) {
+	tx := &Transaction{Inputs: []*Input{{}}, LockTime: 100}
+	run := func(n int64, ctx *TxContext) error {
+		vm := NewVm(*LockTimeScript(n, &Script{}))
+		if ctx != nil {
+			vm.SetEnv(VMEnvTxContext, ctx)
+		}
+		return vm.Exec()
+	}
+	ctx := &TxContext{Tx: tx}
+	for _, n := range []int64{0, 99, 100} {
+		if err := run(n, ctx); err != nil {
+			t.Fatal(n, err)
+		}
+	}
+	for _, n := range []int64{101, -1, LockTimeThreshold} {
+		if err := run(n, ctx); err == nil {
+			t.Fatal(n)
+		}
+	}
+	if err := run(1, nil); err == nil || !strings.Contains(err.Error(), "No tx context") {
+		t.Fatal(err)
+	}
+	//5 字节的时间
+	tx.LockTime = 1 << 32
+	if err := run(1<<32, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(1<<32+1, ctx); err == nil {
+		t.Fatal("time not reached")
+	}
+}
+
+func TestVmExec_OpCheckSequenceVerify(t *testing.T) {
+	tx := &Transaction{Inputs: []*Input{{}, {Sequence: 10}}}
+	run := func(n int64, index int) error {
+		vm := NewVm(*SequenceLockScript(uint32(n), &Script{}))
+		vm.SetEnv(VMEnvTxContext, &TxContext{Tx: tx, Index: index})
+		return vm.Exec()
+	}
+	for _, n := range []int64{0, 10, SequenceLockTimeDisabled | 100} {
+		if err := run(n, 1); err != nil {
+			t.Fatal(n, err)
+		}
+	}
+	for _, n := range []int64{11, SequenceLockTimeTypeFlag | 1} {
+		if err := run(n, 1); err == nil {
+			t.Fatal(n)
+		}
+	}
+	if err := run(1, 0); err == nil {
+		t.Fatal("input without sequence")
+	}
+	tx.Inputs[1].Sequence = SequenceLockTimeDisabled | 10
+	if err := run(1, 1); err == nil {
+		t.Fatal("input sequence disabled")
+	}
+	tx.Inputs[1].Sequence = SequenceLockTimeTypeFlag | 10
+	if err := run(SequenceLockTimeTypeFlag|10, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//用 PartialTx 花费有时间锁的 P2SH 输出
+func timeLockSpend(t *testing.T, out *Output, redeem *Script, req *TxRequest) (*Transaction, error) {
+	p, err := CreatePartialTx([]*Output{out}, req, MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.AddRedeemScript(redeem) != 1 {
+		t.Fatal("redeem script")
+	}
+	if n, err := p.Sign(getTestWallet_(2)); n != 1 || err != nil {
+		t.Fatal(n, err)
+	}
+	return p.Finalize()
+}
+
+func TestTxPool_LockTime(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	redeem := LockTimeScript(3, buildP2PKHOutput(getTestWallet_(2).PublicKey()))
+	addr := P2SHAddress(redeem)
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w1.Address())[0].TxHash].Outputs[0]
+	fund, _ := BuildTx([]*Output{prev}, w1.Request(addr, 30, "cltv"), MockGlobalEvn.UnixTime())
+	if r := pool.Submit(fund); r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	<-pool.txCh
+	appendTestBlock(t, pool, fund)
+	out := fund.Outputs[1]
+	req := &TxRequest{From: addr, To: w1.Address(), Fee: 10}
+	//LockTime 小于脚本要求
+	if _, err := timeLockSpend(t, out, redeem, req); err == nil {
+		t.Fatal("spend without lock time")
+	}
+	req.LockTime = 3
+	tx, err := timeLockSpend(t, out, redeem, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//下一个区块高度为 2，交易还不是 final
+	if r := pool.Submit(tx); r.Err() == nil || !strings.Contains(r.Err().Error(), "not final") {
+		t.Fatal(r.Err())
+	}
+	b, _ := pool.Chain.NewBlock((&Miner{p: pool, w: w1}).createNewBlockTx([]*Transaction{tx}))
+	for r := b.TryHash(); ; r = b.TryHash() {
+		if r.Ok {
+			b.UpdateHash(r)
+			break
+		}
+	}
+	if err = pool.Chain.Append(b); err == nil || !strings.Contains(err.Error(), "not final") {
+		t.Fatal(err)
+	}
+	appendTestBlock(t, pool)
+	appendTestBlock(t, pool)
+	if r := pool.Submit(tx); r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	<-pool.txCh
+	appendTestBlock(t, pool, tx)
+}
+
+func TestTxPool_SequenceLock(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	redeem := SequenceLockScript(2, buildP2PKHOutput(getTestWallet_(2).PublicKey()))
+	addr := P2SHAddress(redeem)
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w1.Address())[0].TxHash].Outputs[0]
+	fund, _ := BuildTx([]*Output{prev}, w1.Request(addr, 30, "csv"), MockGlobalEvn.UnixTime())
+	if r := pool.Submit(fund); r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	<-pool.txCh
+	appendTestBlock(t, pool, fund)
+	out := fund.Outputs[1]
+	req := &TxRequest{From: addr, To: w1.Address(), Fee: 10}
+	if _, err := timeLockSpend(t, out, redeem, req); err == nil {
+		t.Fatal("spend without sequence")
+	}
+	req.Sequence = 2
+	tx, err := timeLockSpend(t, out, redeem, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//输出在高度 1 确认，高度 3 才能花费
+	if r := pool.Submit(tx); r.Err() == nil || !strings.Contains(r.Err().Error(), "sequence lock") {
+		t.Fatal(r.Err())
+	}
+	appendTestBlock(t, pool)
+	if r := pool.Submit(tx); r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	//按时间的相对时间锁，单位为 512 秒
+	tx.Inputs[0].Sequence = SequenceLockTimeTypeFlag | 2
+	confirmed := BlockUnixTime(pool.Chain.BlockHeights[1])
+	if err = pool.Chain.CheckTxLocks(tx, 10, confirmed+1023); err == nil {
+		t.Fatal("time lock not reached")
+	}
+	if err = pool.Chain.CheckTxLocks(tx, 10, confirmed+1024); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"fmt"
 	"github.com/shengdoushi/base58"
 	"golang.org/x/crypto/ripemd160"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 )
 
 func ErrWrap(msg string, err error) error {
@@ -18,6 +21,29 @@ func ErrWrapf(format string, a ...interface{}) error {
 	return fmt.Errorf(format, a...)
 }
 
+//先写同目录下名字随机的临时文件，设置权限后再替换 path
+//不会覆盖其他文件，也不会留下写了一半的文件
+func WriteFileAtomic(path string, b []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(b); err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	return err
+}
+
 func Base58(b []byte) string {
 	return base58.Encode(b, base58.BitcoinAlphabet)
 }
@@ -92,7 +118,6 @@ func Reverse(r []byte) []byte {
 	return runes
 }
 
-
 func merkleRoot(bs [][]byte) []byte {
 	l := len(bs)
 	if l == 0 {
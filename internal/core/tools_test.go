@@ -2,6 +2,9 @@ package core
 
 import (
 	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -75,3 +78,28 @@ func TestMerkleRoot(t *testing.T) {
 		t.Fatal("merklet fail")
 	}
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "f")
+	_ = ioutil.WriteFile(path, []byte("old"), 0644)
+	if err = WriteFileAtomic(path, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "new" {
+		t.Fatal("content", string(b))
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0600 {
+		t.Fatal("perm", fi.Mode())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatal("tmp file left")
+	}
+	if err = WriteFileAtomic(filepath.Join(dir, "no", "f"), nil, 0600); err == nil {
+		t.Fatal("missing dir")
+	}
+}
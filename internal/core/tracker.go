@@ -0,0 +1,295 @@
+package core
+
+import (
+	"sort"
+	"sync"
+)
+
+// ==================================== Wallet Tracker ====================================
+// 跟踪一组地址的交易历史和余额
+// 通过事件总线发现区块和交易池中与地址相关的交易，确认数每次查询时从链上计算，分叉切换后自动更新
+// 区块断开时仍在交易池中的交易回到未确认状态，直到重新打包或因冲突被移除
+// 其他交易(包括 coinbase)作废，花费它们输出的交易也一起移除
+// 共识没有 coinbase 成熟期，coinbase 输出确认后即计入已确认余额
+
+type WalletTracker struct {
+	pool *TxPool
+	mu   sync.RWMutex
+	//key address
+	addresses map[string]bool
+	//与地址相关的交易，包括未确认的 key tx hash
+	txs  map[string]*Transaction
+	sub  *Subscription
+	done chan bool
+}
+
+//单笔交易对钱包的影响
+type WalletTx struct {
+	Hash string
+	//未确认时为 0
+	Confirmations uint64
+	Height        uint64
+	Timestamp     int64
+	//转入钱包地址的总额
+	Received int64
+	//钱包地址作为输入花费的总额
+	Sent     int64
+	Coinbase bool
+}
+
+type WalletBalance struct {
+	Confirmed   int64
+	Unconfirmed int64
+}
+
+// ==================================== func below ====================================
+
+//创建并从链和交易池中扫描已有的交易
+func NewWalletTracker(pool *TxPool, addresses []string) *WalletTracker {
+	w := &WalletTracker{
+		pool:      pool,
+		addresses: make(map[string]bool),
+		txs:       make(map[string]*Transaction),
+	}
+	for _, it := range addresses {
+		if addr, err := CanonicalAddress(it); err == nil {
+			it = addr
+		}
+		w.addresses[it] = true
+	}
+	w.Rescan()
+	return w
+}
+
+//开始处理事件，先订阅再重新扫描，创建之后发生的事件不会遗漏
+//订阅不丢弃事件，余额和确认数不会因为处理慢而出错
+func (w *WalletTracker) Start() {
+	w.sub = w.pool.Chain.Events.SubscribeUnbounded(nil)
+	w.Rescan()
+	w.done = make(chan bool)
+	go func() {
+		defer close(w.done)
+		for e := range w.sub.C {
+			w.handle(e)
+		}
+	}()
+}
+
+func (w *WalletTracker) Stop() {
+	if w.sub == nil {
+		return
+	}
+	w.sub.Unsubscribe()
+	<-w.done
+}
+
+//加入地址并扫描它已有的交易
+func (w *WalletTracker) AddAddress(address string) error {
+	address, err := CanonicalAddress(address)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.addresses[address] = true
+	w.mu.Unlock()
+	w.Rescan()
+	return nil
+}
+
+func (w *WalletTracker) Addresses() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	r := make([]string, 0, len(w.addresses))
+	for it := range w.addresses {
+		r = append(r, it)
+	}
+	sort.Strings(r)
+	return r
+}
+
+//重新扫描主链和交易池
+func (w *WalletTracker) Rescan() {
+	found := make([]*Transaction, 0)
+	for _, a := range w.Addresses() {
+		found = append(found, w.pool.Chain.AddressHistory(a)...)
+	}
+	found = append(found, w.pool.PendingTx()...)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, t := range found {
+		if w.isMine(t) {
+			w.txs[t.Hash] = t
+		}
+	}
+}
+
+func (w *WalletTracker) isMine(t *Transaction) bool {
+	for _, in := range t.Inputs {
+		if w.addresses[in.Output.Address] {
+			return true
+		}
+	}
+	for _, o := range t.Outputs {
+		if w.addresses[o.Address] {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *WalletTracker) handle(e *Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch e.Type {
+	case EventTxAccepted:
+		if w.isMine(e.Tx) {
+			w.txs[e.Tx.Hash] = e.Tx
+		}
+	case EventTxEvicted:
+		if _, ok := w.pool.Chain.TxHeight(e.Tx.Hash); !ok {
+			delete(w.txs, e.Tx.Hash)
+		}
+	case EventBlockConnected:
+		for _, t := range e.Block.Tx {
+			if w.isMine(t) {
+				w.txs[t.Hash] = t
+			}
+		}
+		w.removeConflicts(e.Block)
+	case EventBlockDisconnected:
+		dropped := make(map[string]bool)
+		for _, t := range e.Block.Tx {
+			if _, ok := w.pool.GetPendingTx(t.Hash); isCoinbase(t) || !ok {
+				dropped[t.Hash] = true
+			}
+		}
+		w.removeDescendants(dropped)
+	}
+}
+
+//移除交易以及未确认的后代交易，它们花费的输出已不存在
+func (w *WalletTracker) removeDescendants(dropped map[string]bool) {
+	for len(dropped) > 0 {
+		next := make(map[string]bool)
+		for hash, t := range w.txs {
+			if dropped[hash] {
+				delete(w.txs, hash)
+				continue
+			}
+			if _, ok := w.pool.Chain.TxHeight(hash); ok {
+				continue
+			}
+			for _, in := range t.Inputs {
+				if dropped[in.Output.TxHash] {
+					next[hash] = true
+					break
+				}
+			}
+		}
+		dropped = next
+	}
+}
+
+//未确认的交易与区块中的交易花费了相同的输出，已经不可能被确认
+func (w *WalletTracker) removeConflicts(b *Block) {
+	spent := make(map[Utxo]string)
+	for _, t := range b.Tx {
+		for _, in := range t.Inputs {
+			spent[*newUtxo(in.Output)] = t.Hash
+		}
+	}
+	for hash, t := range w.txs {
+		for _, in := range t.Inputs {
+			if by, ok := spent[*newUtxo(in.Output)]; ok && by != hash {
+				delete(w.txs, hash)
+				break
+			}
+		}
+	}
+}
+
+//挖矿奖励交易，没有输入，创世交易除外
+func isCoinbase(t *Transaction) bool {
+	return t.Type == NormalTx && len(t.Inputs) == 0
+}
+
+//交易的确认数，tip 为查询开始时的最高区块
+func (w *WalletTracker) confirmations(t *Transaction, tip uint64) (uint64, uint64) {
+	h, ok := w.pool.Chain.TxHeight(t.Hash)
+	if !ok {
+		return 0, 0
+	}
+	if h > tip {
+		return h, 1
+	}
+	return h, tip - h + 1
+}
+
+//交易历史，未确认的在前，之后按区块从新到旧
+func (w *WalletTracker) History() []*WalletTx {
+	tip := w.pool.Chain.Tip().Height
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	r := make([]*WalletTx, 0, len(w.txs))
+	for _, t := range w.txs {
+		wt := &WalletTx{
+			Hash:      t.Hash,
+			Timestamp: t.Timestamp,
+			Coinbase:  isCoinbase(t),
+		}
+		wt.Height, wt.Confirmations = w.confirmations(t, tip)
+		for _, in := range t.Inputs {
+			if w.addresses[in.Output.Address] {
+				wt.Sent += in.Output.Fee
+			}
+		}
+		for _, o := range t.Outputs {
+			if w.addresses[o.Address] {
+				wt.Received += o.Fee
+			}
+		}
+		r = append(r, wt)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		a, b := r[i], r[j]
+		if (a.Confirmations == 0) != (b.Confirmations == 0) {
+			return a.Confirmations == 0
+		}
+		if a.Height != b.Height {
+			return a.Height > b.Height
+		}
+		if a.Timestamp != b.Timestamp {
+			return a.Timestamp > b.Timestamp
+		}
+		return a.Hash < b.Hash
+	})
+	return r
+}
+
+//余额: 未花费的输出按所在交易的状态分类，被未确认交易花费的输出不再计入
+func (w *WalletTracker) Balance() *WalletBalance {
+	tip := w.pool.Chain.Tip().Height
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	spent := make(map[Utxo]bool)
+	for _, t := range w.txs {
+		for _, in := range t.Inputs {
+			spent[*newUtxo(in.Output)] = true
+		}
+	}
+	r := new(WalletBalance)
+	for _, t := range w.txs {
+		_, conf := w.confirmations(t, tip)
+		for _, o := range t.Outputs {
+			if !w.addresses[o.Address] || spent[*newUtxo(o)] {
+				continue
+			}
+			if conf == 0 {
+				r.Unconfirmed += o.Fee
+			} else {
+				r.Confirmed += o.Fee
+			}
+		}
+	}
+	return r
+}
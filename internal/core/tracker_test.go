@@ -0,0 +1,123 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func waitTracker(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("wait tracker timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWalletTracker(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1, w9 := getTestWallet_(1), getTestWallet_(9)
+	tracker := NewWalletTracker(pool, []string{w1.Address()})
+	if err := tracker.AddAddress(w9.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.AddAddress("nope"); err == nil {
+		t.Fatal("invalid address")
+	}
+	tracker.Start()
+	defer tracker.Stop()
+	if len(tracker.History()) != 2 || *tracker.Balance() != (WalletBalance{Confirmed: 2 * GenesisCoinCount}) {
+		t.Fatal("genesis", tracker.Balance())
+	}
+	//0->1, 1->2, 8->9 与钱包相关
+	b := newTestBlock(t, pool)
+	waitTracker(t, func() bool { return len(tracker.History()) == 5 })
+	h := tracker.History()
+	if h[0].Confirmations != 0 || h[4].Confirmations != 1 || h[4].Height != 0 {
+		t.Fatal("history order")
+	}
+	//w1 的创世输出已被未确认交易花费
+	if *tracker.Balance() != (WalletBalance{Confirmed: GenesisCoinCount, Unconfirmed: GenesisCoinCount - 2 + 1 + 9}) {
+		t.Fatal("pending balance", tracker.Balance())
+	}
+	if err := pool.Chain.Append(b); err != nil {
+		t.Fatal(err)
+	}
+	waitTracker(t, func() bool { return len(tracker.History()) == 6 })
+	h = tracker.History()
+	if h[0].Hash != b.Tx[0].Hash || !h[0].Coinbase || h[0].Confirmations != 1 || h[0].Received != CoinBaseCount {
+		t.Fatal("coinbase", h[0])
+	}
+	for _, it := range h {
+		if it.Hash == b.Tx[2].Hash && (it.Sent != GenesisCoinCount || it.Received != GenesisCoinCount-2) {
+			t.Fatal("sent", it)
+		}
+	}
+	//coinbase 没有成熟期，确认后即可花费
+	if *tracker.Balance() != (WalletBalance{Confirmed: 2*GenesisCoinCount + 8 + CoinBaseCount}) {
+		t.Fatal("confirmed balance", tracker.Balance())
+	}
+	//断开区块后 coinbase 作废，其他交易回到未确认
+	if _, err := pool.Chain.DisconnectTip(); err != nil {
+		t.Fatal(err)
+	}
+	waitTracker(t, func() bool { return len(tracker.History()) == 5 })
+	if *tracker.Balance() != (WalletBalance{Confirmed: GenesisCoinCount, Unconfirmed: GenesisCoinCount - 2 + 1 + 9}) {
+		t.Fatal("balance after reorg", tracker.Balance())
+	}
+}
+
+//断开区块后，不在交易池中的交易和花费 coinbase 的交易一起作废
+func TestWalletTracker_DisconnectDropsTx(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1, w9 := getTestWallet_(1), getTestWallet_(9)
+	tracker := NewWalletTracker(pool, []string{w1.Address(), w9.Address()})
+	tracker.Start()
+	defer tracker.Stop()
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w1.Address())[0].TxHash].Outputs[0]
+	tx, err := BuildTx([]*Output{prev}, w1.Request(getTestWallet_(2).Address(), 10, "drop"), MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := appendTestBlock(t, pool, tx)
+	child, err := BuildTx([]*Output{b.Tx[0].Outputs[0]}, w9.Request(w1.Address(), 5, "child"), MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := pool.Submit(child); r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	<-pool.txCh
+	waitTracker(t, func() bool { return len(tracker.History()) == 5 })
+	if _, err = pool.Chain.DisconnectTip(); err != nil {
+		t.Fatal(err)
+	}
+	waitTracker(t, func() bool { return len(tracker.History()) == 2 })
+	if *tracker.Balance() != (WalletBalance{Confirmed: 2 * GenesisCoinCount}) {
+		t.Fatal("balance after disconnect", tracker.Balance())
+	}
+}
+
+//Start 之前接受的交易和处理不过来时的事件都不会遗漏
+func TestWalletTracker_NoLostEvents(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet_(1)
+	tracker := NewWalletTracker(pool, []string{w1.Address()})
+	//0->1, 1->2
+	newTestBlock(t, pool)
+	tracker.Start()
+	defer tracker.Stop()
+	if len(tracker.History()) != 3 {
+		t.Fatal("tx before start", len(tracker.History()))
+	}
+	//处理协程被阻塞时继续发布事件
+	tracker.mu.Lock()
+	for i := 0; i < 2000; i++ {
+		pool.Chain.Events.Publish(&Event{Type: EventTxEvicted, Tx: &Transaction{Hash: "evicted"}})
+	}
+	late := &Transaction{Hash: "late", Outputs: []*Output{{Address: w1.Address(), Fee: 1}}}
+	pool.Chain.Events.Publish(&Event{Type: EventTxAccepted, Tx: late})
+	tracker.mu.Unlock()
+	waitTracker(t, func() bool { return len(tracker.History()) == 4 })
+}
@@ -1,21 +1,68 @@
 package core
 
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/woodyDM/simple-block-chain/internal/metrics"
+	"math"
+	"sync"
+)
+
+//交易被拒绝的原因，用作指标的标签
+const (
+	RejectInvalid      = "invalid"
+	RejectMissingInput = "missing_input"
+	RejectDoubleSpend  = "double_spend"
+	RejectScript       = "script"
+	RejectOutput       = "output"
+	RejectInsufficient = "insufficient"
+	RejectDuplicate    = "duplicate"
+	RejectNonFinal     = "non_final"
+)
+
 type TxPool struct {
-	Chain     *BlockChain
-	usedUtxo  UtxoDatabase
+	Chain    *BlockChain
+	usedUtxo UtxoDatabase
+	//已进入交易池但还未打包的交易 key tx hash
+	pending   map[string]*Transaction
+	pendingMu sync.RWMutex
 	txReqCh   chan *TxRequest
 	txRespCh  chan *TxResponse
+	rawTxCh   chan *Transaction
+	rawRespCh chan *TxResponse
 	txCh      chan *Transaction
 	txBlockCh chan *Block
 	endl      chan bool
+	//进入交易池的交易数
+	Accepted *metrics.Counter
+	//按原因统计被拒绝的交易数
+	Rejected *metrics.CounterVec
+	//不为空时，没有指定手续费的请求按估算的费率支付
+	FeeEstimator *FeeEstimator
 }
 
 type TxRequest struct {
-	From  string
-	To    string
-	Fee   int64
+	From string
+	//单个收款方时使用 To 和 Fee，多个收款方时使用 Recipients
+	To string
+	//转账金额
+	Fee        int64
+	Recipients []*Recipient
+	//交易手续费，输入减去输出的差额，由打包的矿工获得
+	TxFee int64
 	Extra string
-	w     *Wallet
+	//选择输入的策略，为空时使用 DefaultCoinSelector
+	Selector CoinSelector
+	//交易的 LockTime 和每个输入的 Sequence，花费有时间锁的输出时需要
+	LockTime int64
+	Sequence uint32
+	w        *Wallet
+}
+
+//收款地址和金额
+type Recipient struct {
+	Address string
+	Amount  int64
 }
 
 type TxResponse struct {
@@ -29,15 +76,26 @@ func NewErrTxResponse(err error) *TxResponse {
 	}
 }
 
+//记录拒绝原因并返回错误响应
+func (p *TxPool) reject(reason string, err error) *TxResponse {
+	p.Rejected.With(reason).Inc()
+	return NewErrTxResponse(err)
+}
+
 func NewTxPool(c *BlockChain) *TxPool {
 	pool := TxPool{
 		Chain:     c,
 		usedUtxo:  NewInMemUtxoDatabase(),
+		pending:   make(map[string]*Transaction),
 		txReqCh:   make(chan *TxRequest),
 		txRespCh:  make(chan *TxResponse),
+		rawTxCh:   make(chan *Transaction),
+		rawRespCh: make(chan *TxResponse),
 		txCh:      make(chan *Transaction, 100),
 		txBlockCh: make(chan *Block, 0),
 		endl:      make(chan bool),
+		Accepted:  metrics.NewCounter(),
+		Rejected:  metrics.NewCounterVec("reason"),
 	}
 	go pool.start()
 	return &pool
@@ -56,9 +114,15 @@ func (p *TxPool) start() {
 		case req := <-p.txReqCh:
 			resp := p.transform0(req)
 			if resp.err == nil {
-				p.txCh <- resp.tx
+				p.onAccepted(resp.tx)
 			}
 			p.txRespCh <- resp
+		case tx := <-p.rawTxCh:
+			resp := p.accept(tx)
+			if resp.err == nil {
+				p.onAccepted(resp.tx)
+			}
+			p.rawRespCh <- resp
 		case block := <-p.txBlockCh:
 			p.receiveBlock(block)
 		}
@@ -69,15 +133,17 @@ func (p *TxPool) start() {
 func (p *TxPool) Transform(tx *TxRequest) *TxResponse {
 	extraB := []byte(tx.Extra)
 	if len(extraB) > ExtraLen {
-		return NewErrTxResponse(ErrWrapf("Extra len exceed max len"))
+		return p.reject(RejectInvalid, ErrWrapf("Extra len exceed max len"))
 	}
 	_, e := AddressToRipemd160PubKey(tx.w.Address())
 	if e != nil {
-		return NewErrTxResponse(ErrWrap("Invalid address", e))
+		return p.reject(RejectInvalid, ErrWrap("Invalid address", e))
+	}
+	if err := checkRecipients(tx.recipients()); err != nil {
+		return p.reject(RejectInvalid, err)
 	}
-	fee := tx.Fee
-	if fee <= 0 {
-		return NewErrTxResponse(ErrWrapf("Invalid fee %d", fee))
+	if tx.TxFee < 0 {
+		return p.reject(RejectInvalid, ErrWrapf("Invalid tx fee %d", tx.TxFee))
 	}
 	p.txReqCh <- tx
 	return <-p.txRespCh
@@ -87,20 +153,31 @@ func (p *TxPool) transform0(tx *TxRequest) *TxResponse {
 	valid := p.Chain.GetUtxo(tx.From)
 	used := p.usedUtxo.GetUtxo(tx.From)
 	unused := filterUsedUtxo(valid, used)
-	thisUtxo := pickUtxo(unused, tx.Fee)
-	if thisUtxo == nil {
-		Log.Debug("Not enough utxo for ", tx)
-		return NewErrTxResponse(ErrWrapf("No enough utxo for %s", tx.From))
+	var thisUtxo []*Utxo
+	var selectErr error
+	selectInputs := func(target int64) ([]*Output, error) {
+		if thisUtxo, selectErr = tx.selector().Select(unused, target); selectErr != nil {
+			return nil, selectErr
+		}
+		return p.prevOutputs(thisUtxo)
+	}
+	transaction, err := p.buildTx(tx, selectInputs)
+	if selectErr != nil {
+		Log.Debug("Not enough utxo for ", tx, ": ", selectErr)
+		return p.reject(RejectInsufficient, ErrWrap("No enough utxo for "+tx.From, selectErr))
 	} else {
-		transaction, err := p.createNormalTx(thisUtxo, tx)
 		if err != nil {
-			return NewErrTxResponse(err)
+			return p.reject(RejectInvalid, err)
 		}
 		err = transaction.UpdateHash()
 		if err != nil {
-			return NewErrTxResponse(err)
+			return p.reject(RejectInvalid, err)
 		}
-		for _, it := range unused {
+		//与外部交易相同，必须能进入下一个区块，否则 utxo 会一直被占用
+		if err = p.Chain.CheckTxLocks(transaction, p.Chain.Tip().Height+1, p.Chain.Env.UnixTime()); err != nil {
+			return p.reject(RejectNonFinal, err)
+		}
+		for _, it := range thisUtxo {
 			p.usedUtxo.AddUtxo(it)
 		}
 		Log.Info("TxPool put transaction ", transaction.Hash, " to pool. Request is ", tx)
@@ -111,6 +188,227 @@ func (p *TxPool) transform0(tx *TxRequest) *TxResponse {
 	}
 }
 
+//提交外部已签名的交易
+func (p *TxPool) Submit(tx *Transaction) *TxResponse {
+	if tx == nil {
+		return p.reject(RejectInvalid, ErrWrapf("Empty transaction"))
+	}
+	p.rawTxCh <- tx
+	return <-p.rawRespCh
+}
+
+//所有收款方
+func (r *TxRequest) recipients() []*Recipient {
+	if len(r.Recipients) != 0 {
+		return r.Recipients
+	}
+	return []*Recipient{{Address: r.To, Amount: r.Fee}}
+}
+
+//转账总额，不含手续费
+func (r *TxRequest) Amount() (int64, error) {
+	var total int64 = 0
+	for _, it := range r.recipients() {
+		var err error
+		if total, err = addAmount(total, it.Amount); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+//选择输入的目标金额: 转账总额加手续费
+func (r *TxRequest) Target() (int64, error) {
+	amount, err := r.Amount()
+	if err != nil {
+		return 0, err
+	}
+	return addAmount(amount, r.TxFee)
+}
+
+//金额相加，结果超过 int64 时返回错误，避免溢出后凭空产生金额
+func addAmount(total, amount int64) (int64, error) {
+	if amount < 0 || total > math.MaxInt64-amount {
+		return 0, ErrWrapf("Amount overflow %d + %d", total, amount)
+	}
+	return total + amount, nil
+}
+
+//金额必须为正且总额不溢出，地址有效且不重复
+func checkRecipients(rs []*Recipient) error {
+	seen := make(map[string]bool)
+	var total int64 = 0
+	for _, it := range rs {
+		if it.Amount <= 0 {
+			return ErrWrapf("Invalid fee %d to %s", it.Amount, it.Address)
+		}
+		var err error
+		if total, err = addAmount(total, it.Amount); err != nil {
+			return err
+		}
+		address, err := CanonicalAddress(it.Address)
+		if err != nil {
+			return ErrWrap("Invalid address "+it.Address, err)
+		}
+		//两种写法的同一个地址也算重复
+		if seen[address] {
+			return ErrWrapf("Duplicate output address %s", it.Address)
+		}
+		seen[address] = true
+	}
+	return nil
+}
+
+func (r *TxRequest) selector() CoinSelector {
+	if r.Selector == nil {
+		return DefaultCoinSelector
+	}
+	return r.Selector
+}
+
+func (r *TxResponse) Tx() *Transaction {
+	return r.tx
+}
+
+func (r *TxResponse) Err() error {
+	return r.err
+}
+
+//校验外部交易: 输入必须是未使用的utxo且脚本校验通过，输出总和不能超过输入总和
+func (p *TxPool) accept(tx *Transaction) *TxResponse {
+	if tx.Type != NormalTx {
+		return p.reject(RejectInvalid, ErrWrapf("Invalid tx type %d", tx.Type))
+	}
+	if len(tx.Inputs) == 0 || len(tx.Outputs) == 0 {
+		return p.reject(RejectInvalid, ErrWrapf("Tx without input or output"))
+	}
+	if len(tx.Extra) > ExtraLen {
+		return p.reject(RejectInvalid, ErrWrapf("Extra len exceed max len"))
+	}
+	if tx.LockTime < 0 {
+		return p.reject(RejectInvalid, ErrWrapf("Invalid lock time %d", tx.LockTime))
+	}
+	used := make(map[Utxo]bool)
+	spent := make([]*Utxo, 0)
+	var totalIn int64 = 0
+	//交易最早进入下一个区块
+	height, now := p.Chain.Tip().Height+1, p.Chain.Env.UnixTime()
+	for i, in := range tx.Inputs {
+		inTx, exist := p.Chain.GetTx(in.Output.TxHash)
+		if !exist {
+			return p.reject(RejectMissingInput, ErrWrapf("Transaction %s not found !", in.Output.TxHash))
+		}
+		idx := in.Output.TxIndex
+		if idx < 0 || idx >= len(inTx.Outputs) {
+			return p.reject(RejectMissingInput, ErrWrapf("Transaction %s out of index [%d] of total [%d]", inTx.Hash, idx, len(inTx.Outputs)))
+		}
+		//以链上的output为准
+		output := inTx.Outputs[idx]
+		u := newUtxo(output)
+		if used[*u] || !containsUtxo(p.Chain.GetUtxo(u.Address), u) || containsUtxo(p.usedUtxo.GetUtxo(u.Address), u) {
+			return p.reject(RejectDoubleSpend, ErrWrapf("Input %d spends unavailable utxo %s:%d", i, u.TxHash, u.TxOutputIndex))
+		}
+		//签名覆盖花费的输出，先替换再校验
+		in.Output = output
+		ctx := &TxContext{Tx: tx, Index: i, Height: height, Time: now}
+		if err := verifyScript(in.Script, output.Script, ctx); err != nil {
+			return p.reject(RejectScript, ErrWrap("script verify fail", err))
+		}
+		used[*u] = true
+		spent = append(spent, u)
+		var err error
+		if totalIn, err = addAmount(totalIn, output.Fee); err != nil {
+			return p.reject(RejectInvalid, err)
+		}
+	}
+	if err := p.Chain.CheckTxLocks(tx, height, now); err != nil {
+		return p.reject(RejectNonFinal, err)
+	}
+	addresses := make(map[string]bool)
+	var totalOut int64 = 0
+	for i, o := range tx.Outputs {
+		//OP_RETURN 输出没有地址，金额可以为 0
+		if o.Script.IsUnspendable() {
+			if err := checkNullDataOutput(o); err != nil {
+				return p.reject(RejectOutput, ErrWrap("Invalid null data output", err))
+			}
+			if addresses[o.Address] {
+				return p.reject(RejectOutput, ErrWrapf("Duplicate null data output"))
+			}
+			addresses[o.Address] = true
+			o.TxIndex = i
+			var err error
+			if totalOut, err = addAmount(totalOut, o.Fee); err != nil {
+				return p.reject(RejectOutput, err)
+			}
+			continue
+		}
+		if o.Fee <= 0 {
+			return p.reject(RejectOutput, ErrWrapf("Invalid output fee %d", o.Fee))
+		}
+		if addresses[o.Address] {
+			return p.reject(RejectOutput, ErrWrapf("Duplicate output address %s", o.Address))
+		}
+		addresses[o.Address] = true
+		sc, err := AddressToScript(o.Address)
+		if err != nil {
+			return p.reject(RejectOutput, ErrWrap("Invalid output address", err))
+		}
+		//utxo 按地址索引，只接受 Base58Check 写法
+		if canonical, _ := CanonicalAddress(o.Address); canonical != o.Address {
+			return p.reject(RejectOutput, ErrWrapf("Output %d address %s is not canonical", i, o.Address))
+		}
+		if !bytes.Equal(sc.CalHash(), o.Script.CalHash()) {
+			return p.reject(RejectOutput, ErrWrapf("Output %d script mismatch address %s", i, o.Address))
+		}
+		o.TxIndex = i
+		if totalOut, err = addAmount(totalOut, o.Fee); err != nil {
+			return p.reject(RejectOutput, err)
+		}
+	}
+	if totalOut > totalIn {
+		return p.reject(RejectInsufficient, ErrWrapf("Output %d exceed input %d", totalOut, totalIn))
+	}
+	if err := tx.UpdateHash(); err != nil {
+		return p.reject(RejectInvalid, err)
+	}
+	if _, exist := p.Chain.GetTx(tx.Hash); exist {
+		return p.reject(RejectDuplicate, ErrWrapf("Transaction %s already in chain", tx.Hash))
+	}
+	for _, u := range spent {
+		p.usedUtxo.AddUtxo(u)
+	}
+	Log.Info("TxPool accept transaction ", tx.Hash)
+	return &TxResponse{
+		tx:  tx,
+		err: nil,
+	}
+}
+
+//只接受 NullDataScript 构建的 OP_RETURN 输出
+func checkNullDataOutput(o *Output) error {
+	if o.Address != "" || o.Fee < 0 {
+		return ErrWrapf("null data output with address %s fee %d", o.Address, o.Fee)
+	}
+	s := *o.Script
+	if len(s) == 1 {
+		return nil
+	}
+	if len(s) != 3 || !bytes.Equal(s[1], OpPushDataA) || len(s[2]) > MaxNullDataLen {
+		return ErrWrapf("invalid null data script %s", o.Script.Asm())
+	}
+	return nil
+}
+
+func containsUtxo(list []*Utxo, u *Utxo) bool {
+	for _, it := range list {
+		if *it == *u {
+			return true
+		}
+	}
+	return false
+}
+
 func pickUtxo(uxto []*Utxo, fee int64) []*Utxo {
 	used := make([]*Utxo, 0)
 	var total int64 = 0
@@ -125,76 +423,182 @@ func pickUtxo(uxto []*Utxo, fee int64) []*Utxo {
 }
 
 //使用utxo 构建 交易
-func (p *TxPool) createNormalTx(used []*Utxo, tx *TxRequest) (*Transaction, error) {
-	trans := &Transaction{
-		Timestamp: p.Chain.Env.UnixTime(),
-		Type:      NormalTx,
-		Extra:     []byte(tx.Extra),
+//没有指定手续费且有估算结果时按费率支付，否则使用请求中的手续费
+func (p *TxPool) buildTx(tx *TxRequest, selectInputs func(target int64) ([]*Output, error)) (*Transaction, error) {
+	ts := p.Chain.Env.UnixTime()
+	if tx.TxFee == 0 && p.FeeEstimator != nil {
+		if rate, err := p.FeeEstimator.EstimateFee(DefaultFeeTarget, FeeConservative); err == nil {
+			return BuildTxWithFeeRate(tx, rate, selectInputs, ts)
+		}
 	}
-	w := tx.w
-	//build input
-	inputs := make([]*Input, 0)
-	var total int64 = 0
+	target, err := tx.Target()
+	if err != nil {
+		return nil, err
+	}
+	prevOuts, err := selectInputs(target)
+	if err != nil {
+		return nil, err
+	}
+	return BuildTx(prevOuts, tx, ts)
+}
+
+//utxo 对应的之前交易的输出
+func (p *TxPool) prevOutputs(used []*Utxo) ([]*Output, error) {
+	prevOuts := make([]*Output, 0)
 	for _, it := range used {
-		if inTx, exist := p.Chain.Tx[it.TxHash]; !exist {
+		if inTx, exist := p.Chain.GetTx(it.TxHash); !exist {
 			return nil, ErrWrapf("Transaction %s not found !", it.TxHash)
 		} else {
 			i := len(inTx.Outputs)
 			if i <= it.TxOutputIndex {
 				return nil, ErrWrapf("Transaction %s out of index [%d] of total [%d]", it.TxHash, it.TxOutputIndex, i)
 			}
-			//create input
-			output := inTx.Outputs[it.TxOutputIndex]
-			script, err := buildP2PKHInput([]byte(inTx.Hash), tx.w)
-			if err != nil {
-				return nil, ErrWrap("can't create tx", err)
-			}
-			err = VerifyScript(inTx.Hash, script, output.Script)
-			if err != nil {
-				return nil, ErrWrap("script verify fail", err)
-			}
-			in := &Input{
-				Script: script,
-				Output: output,
-			}
-			inputs = append(inputs, in)
-			total += output.Fee
+			prevOuts = append(prevOuts, inTx.Outputs[it.TxOutputIndex])
+		}
+	}
+	return prevOuts, nil
+}
+
+//使用之前交易的 output 构建交易，并用 TxRequest 中的钱包签名
+//可以在不运行交易池的客户端使用，结果通过 TxPool.Submit 提交
+func BuildTx(prevOuts []*Output, tx *TxRequest, timestamp int64) (*Transaction, error) {
+	w := tx.w
+	if w == nil {
+		return nil, ErrWrapf("No wallet to sign tx")
+	}
+	trans, err := buildUnsignedTx(prevOuts, tx.recipients(), tx.TxFee, changeTolerance(tx.selector()), w.Address(), tx.Extra, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	tx.setLocks(trans)
+	for i, in := range trans.Inputs {
+		hash, err := trans.SigHash(i)
+		if err != nil {
+			return nil, ErrWrap("can't create tx", err)
+		}
+		if in.Script, err = buildP2PKHInput(hash, w); err != nil {
+			return nil, ErrWrap("can't create tx", err)
+		}
+		if err = VerifyScript(trans, i); err != nil {
+			return nil, ErrWrap("script verify fail", err)
+		}
+	}
+	if err := trans.UpdateHash(); err != nil {
+		return nil, err
+	}
+	return trans, nil
+}
+
+//签名前设置时间锁，之后需要重新计算 hash
+func (r *TxRequest) setLocks(t *Transaction) {
+	t.LockTime = r.LockTime
+	for _, in := range t.Inputs {
+		in.Sequence = r.Sequence
+	}
+}
+
+//构建输入脚本为空的交易，找零付给 change 地址，找零不超过 tolerance 时作为手续费
+func buildUnsignedTx(prevOuts []*Output, recipients []*Recipient, txFee, tolerance int64, change, extra string, timestamp int64) (*Transaction, error) {
+	trans := &Transaction{
+		Timestamp: timestamp,
+		Type:      NormalTx,
+		Extra:     []byte(extra),
+	}
+	//build input
+	inputs := make([]*Input, 0, len(prevOuts))
+	var total int64 = 0
+	for _, output := range prevOuts {
+		inputs = append(inputs, &Input{
+			Script: &Script{},
+			Output: output,
+		})
+		var err error
+		if total, err = addAmount(total, output.Fee); err != nil {
+			return nil, err
 		}
 	}
 	trans.Inputs = inputs
 	//build output
-	left := total - tx.Fee
+	if err := checkRecipients(recipients); err != nil {
+		return nil, err
+	}
+	if txFee < 0 {
+		return nil, ErrWrapf("Invalid tx fee %d", txFee)
+	}
+	var amount int64 = 0
+	for _, it := range recipients {
+		var err error
+		if amount, err = addAmount(amount, it.Amount); err != nil {
+			return nil, err
+		}
+	}
+	need, err := addAmount(amount, txFee)
+	if err != nil {
+		return nil, err
+	}
+	left := total - need
 	if left < 0 {
-		panic("expect bonus >=0 ")
+		return nil, ErrWrapf("No enough input %d for %d and tx fee %d", total, amount, txFee)
+	}
+	if left <= tolerance {
+		left = 0
+	}
+	outputs := make([]*Output, 0, len(recipients)+1)
+	change, err = CanonicalAddress(change)
+	if err != nil {
+		return nil, ErrWrap("invalid change address", err)
 	}
-	outputs := make([]*Output, 0)
 	if left > 0 {
 		//create left output
-		o1 := &Output{
-			Fee:     left,
-			Script:  buildP2PKHOutput(w.PublicKey()),
-			Address: w.Address(),
+		sc, err := AddressToScript(change)
+		if err != nil {
+			return nil, ErrWrap("can't build change script", err)
 		}
-		outputs = append(outputs, o1)
-	}
-	sc, err := buildP2PKHOutputWithAddress(tx.To)
-	if err != nil {
-		return nil, ErrWrap("can't build output script", err)
+		outputs = append(outputs, &Output{
+			Fee:     left,
+			Script:  sc,
+			Address: change,
+		})
 	}
-	o2 := &Output{
-		Fee:     tx.Fee,
-		Script:  sc,
-		Address: tx.To,
+	//每个地址只能有一个输出，付给自己时合并到找零输出
+	for _, it := range recipients {
+		address, err := CanonicalAddress(it.Address)
+		if err != nil {
+			return nil, ErrWrap("can't build output script", err)
+		}
+		if address == change && left > 0 {
+			outputs[0].Fee += it.Amount
+			continue
+		}
+		sc, err := AddressToScript(address)
+		if err != nil {
+			return nil, ErrWrap("can't build output script", err)
+		}
+		outputs = append(outputs, &Output{
+			Fee:     it.Amount,
+			Script:  sc,
+			Address: address,
+		})
 	}
-	outputs = append(outputs, o2)
 	for i, it := range outputs {
 		it.TxIndex = i
 	}
 	trans.Outputs = outputs
+	if err := trans.UpdateHash(); err != nil {
+		return nil, err
+	}
 	return trans, nil
 }
 
+func (p *TxPool) onAccepted(tx *Transaction) {
+	p.Accepted.Inc()
+	p.addPending(tx)
+	p.txCh <- tx
+	p.Chain.Events.Publish(&Event{Type: EventTxAccepted, Tx: tx})
+}
+
 func (p *TxPool) receiveBlock(block *Block) {
+	p.evictConflicts(block)
 	for _, o := range block.Tx {
 		for _, i := range o.Inputs {
 			out := i.Output
@@ -204,9 +608,93 @@ func (p *TxPool) receiveBlock(block *Block) {
 			}
 		}
 	}
+	p.removePending(block)
 	Log.Info("Remove used utxos ")
 }
 
+//交易池中与区块花费了相同utxo、但没有被打包的交易已经无效，移出交易池
+func (p *TxPool) evictConflicts(block *Block) {
+	spent := make(map[Utxo]bool)
+	included := make(map[string]bool)
+	for _, t := range block.Tx {
+		included[t.Hash] = true
+		for _, in := range t.Inputs {
+			spent[*newUtxo(in.Output)] = true
+		}
+	}
+	evicted := make([]*Transaction, 0)
+	p.pendingMu.Lock()
+	for hash, t := range p.pending {
+		if included[hash] {
+			continue
+		}
+		for _, in := range t.Inputs {
+			if spent[*newUtxo(in.Output)] {
+				delete(p.pending, hash)
+				evicted = append(evicted, t)
+				break
+			}
+		}
+	}
+	p.pendingMu.Unlock()
+	for _, t := range evicted {
+		for _, in := range t.Inputs {
+			u := newUtxo(in.Output)
+			//与区块冲突的utxo在 receiveBlock 中移除
+			if !spent[*u] {
+				_ = p.usedUtxo.RemoveUtxo(u)
+			}
+		}
+		Log.Info("TxPool evict transaction ", t.Hash, " conflict with block ", block.Hash)
+		p.Chain.Events.Publish(&Event{Type: EventTxEvicted, Tx: t, Reason: "conflict"})
+	}
+}
+
+func (p *TxPool) addPending(tx *Transaction) {
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	p.pending[tx.Hash] = tx
+}
+
+func (p *TxPool) removePending(block *Block) {
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	for _, t := range block.Tx {
+		delete(p.pending, t.Hash)
+	}
+}
+
+func (p *TxPool) GetPendingTx(hash string) (*Transaction, bool) {
+	p.pendingMu.RLock()
+	defer p.pendingMu.RUnlock()
+	t, ok := p.pending[hash]
+	return t, ok
+}
+
+//交易池中还未打包的交易
+func (p *TxPool) PendingTx() []*Transaction {
+	p.pendingMu.RLock()
+	defer p.pendingMu.RUnlock()
+	r := make([]*Transaction, 0, len(p.pending))
+	for _, t := range p.pending {
+		r = append(r, t)
+	}
+	return r
+}
+
+//交易池中还未打包的交易的总字节数, 以传输格式(json)计算
+func (p *TxPool) PendingBytes() int {
+	p.pendingMu.RLock()
+	defer p.pendingMu.RUnlock()
+	n := 0
+	for _, t := range p.pending {
+		if b, err := json.Marshal(t); err == nil {
+			n += len(b)
+		}
+	}
+	return n
+}
+
 func filterUsedUtxo(valid []*Utxo, used []*Utxo) []*Utxo {
 	r := make([]*Utxo, 0)
 	uMap := make(map[Utxo]bool)
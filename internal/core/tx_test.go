@@ -1,6 +1,7 @@
 package core
 
 import (
+	"math"
 	"strings"
 	"testing"
 )
@@ -164,3 +165,267 @@ func uxto(add, txHash string, idx int, fee int64) *Utxo {
 		Fee:           fee,
 	}
 }
+
+func TestTxPool_Submit(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	w2 := getTestWallet2()
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w1.Address())[0].TxHash].Outputs[0]
+	tx, err := BuildTx([]*Output{prev}, w1.Request(w2.Address(), 30, "raw"), MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := EncodeRawTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeRawTx(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := pool.Submit(decoded)
+	if resp.Err() != nil {
+		t.Fatal(resp.Err())
+	}
+	if resp.Tx().Hash != tx.Hash {
+		t.Fatal("hash should not change")
+	}
+	if len(pool.usedUtxo.GetUtxo(w1.Address())) != 1 {
+		t.Fatal("should use one")
+	}
+	//双花
+	again, _ := DecodeRawTx(raw)
+	if resp = pool.Submit(again); resp.Err() == nil {
+		t.Fatal("double spend should fail")
+	}
+	if !strings.Contains(resp.Err().Error(), "unavailable utxo") {
+		t.Fatal(resp.Err())
+	}
+}
+
+func TestTxPool_Submit_Invalid(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	w2 := getTestWallet2()
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w1.Address())[0].TxHash].Outputs[0]
+	build := func() *Transaction {
+		tx, err := BuildTx([]*Output{prev}, w1.Request(w2.Address(), 30, "raw"), MockGlobalEvn.UnixTime())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	//输出超过输入
+	tx := build()
+	tx.Outputs[0].Fee += 1
+	resignTestTx(t, tx, w1)
+	if resp := pool.Submit(tx); resp.Err() == nil || !strings.Contains(resp.Err().Error(), "exceed input") {
+		t.Fatal("should exceed", resp.Err())
+	}
+	//输出总额溢出后小于输入
+	tx = build()
+	tx.Outputs[0].Fee, tx.Outputs[1].Fee = math.MaxInt64, math.MaxInt64
+	tx.Outputs = append(tx.Outputs, &Output{Fee: 2, Script: buildP2PKHOutput(getTestWallet_(3).PublicKey()), Address: getTestWallet_(3).Address(), TxIndex: 2})
+	resignTestTx(t, tx, w1)
+	if resp := pool.Submit(tx); resp.Err() == nil || !strings.Contains(resp.Err().Error(), "overflow") {
+		t.Fatal("should overflow", resp.Err())
+	}
+	//别人的签名
+	tx = build()
+	hash, _ := tx.SigHash(0)
+	other, _ := buildP2PKHInput(hash, w2)
+	tx.Inputs[0].Script = other
+	if resp := pool.Submit(tx); resp.Err() == nil || !strings.Contains(resp.Err().Error(), "script verify fail") {
+		t.Fatal("should fail verify", resp.Err())
+	}
+	//输出脚本与地址不符
+	tx = build()
+	tx.Outputs[1].Address = w1.Address()
+	if resp := pool.Submit(tx); resp.Err() == nil {
+		t.Fatal("should fail address")
+	}
+	if len(pool.usedUtxo.GetUtxo(w1.Address())) != 0 {
+		t.Fatal("nothing should be used")
+	}
+}
+
+func TestCreateNormalTx_Recipients(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	rs := []*Recipient{
+		{Address: getTestWallet_(1).Address(), Amount: 10},
+		{Address: getTestWallet_(2).Address(), Amount: 20},
+		{Address: getTestWallet_(3).Address(), Amount: 30},
+	}
+	resp := pool.Transform(w1.RequestMany(rs, "batch"))
+	if resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	tx := resp.tx
+	if len(tx.Outputs) != 4 || tx.Outputs[0].Fee != GenesisCoinCount-60 || tx.Outputs[0].Address != w1.Address() {
+		t.Fatal("change output")
+	}
+	for i, it := range rs {
+		o := tx.Outputs[i+1]
+		if o.Address != it.Address || o.Fee != it.Amount || o.TxIndex != i+1 {
+			t.Fatal("output", i)
+		}
+	}
+	//付给自己的金额合并到找零输出
+	w2 := getTestWallet2()
+	resp = pool.Transform(w2.RequestMany([]*Recipient{
+		{Address: w2.Address(), Amount: 5},
+		{Address: w1.Address(), Amount: 7},
+	}, ""))
+	if resp.err != nil {
+		t.Fatal(resp.err)
+	}
+	if len(resp.tx.Outputs) != 2 || resp.tx.Outputs[0].Fee != GenesisCoinCount-7 {
+		t.Fatal("self payment should merge into change")
+	}
+	bad := [][]*Recipient{
+		{{Address: w1.Address(), Amount: 1}, {Address: w1.Address(), Amount: 2}},
+		{{Address: w1.Address(), Amount: 0}},
+		{{Address: "nope", Amount: 1}},
+	}
+	for i, it := range bad {
+		if resp = pool.Transform(getTestWallet_(4).RequestMany(it, "")); resp.err == nil {
+			t.Fatal("should reject", i)
+		}
+	}
+}
+
+//收款总额溢出后会变成负数，不能凭空产生金额
+func TestTxPool_Transform_AmountOverflow(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	rs := []*Recipient{
+		{Address: getTestWallet_(2).Address(), Amount: math.MaxInt64},
+		{Address: getTestWallet_(3).Address(), Amount: math.MaxInt64},
+		{Address: getTestWallet_(4).Address(), Amount: 1},
+	}
+	if resp := pool.Transform(w1.RequestMany(rs, "")); resp.Err() == nil || !strings.Contains(resp.Err().Error(), "overflow") {
+		t.Fatal(resp.Err())
+	}
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w1.Address())[0].TxHash].Outputs[0]
+	if _, err := BuildTx([]*Output{prev}, w1.RequestMany(rs, ""), MockGlobalEvn.UnixTime()); err == nil {
+		t.Fatal("build overflow tx")
+	}
+	//加上手续费后溢出
+	req := w1.Request(getTestWallet_(2).Address(), math.MaxInt64, "")
+	req.TxFee = 1
+	if _, err := req.Target(); err == nil {
+		t.Fatal("target overflow")
+	}
+	if resp := pool.Transform(req); resp.Err() == nil {
+		t.Fatal("transform overflow")
+	}
+	if len(pool.usedUtxo.GetUtxo(w1.Address())) != 0 {
+		t.Fatal("nothing should be used")
+	}
+}
+
+//压缩公钥的钱包，输入脚本中的公钥为 33 字节
+func TestBuildTx_CompressedWallet(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	c := RestoreWallet(getTestWallet2().PrivateKey())
+	c.compressed = true
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w1.Address())[0].TxHash].Outputs[0]
+	tx, err := BuildTx([]*Output{prev}, w1.Request(c.Address(), 30, ""), MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := tx.Outputs[1]
+	if out.Address != c.Address() {
+		t.Fatal("output address")
+	}
+	spend, err := BuildTx([]*Output{out}, c.Request(w1.Address(), 10, ""), MockGlobalEvn.UnixTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyScript(spend, 0); err != nil {
+		t.Fatal(err)
+	}
+	//未压缩公钥的签名脚本对应另一个地址
+	u := RestoreWallet(c.PrivateKey())
+	if _, err = BuildTx([]*Output{out}, u.Request(w1.Address(), 10, ""), MockGlobalEvn.UnixTime()); err == nil {
+		t.Fatal("uncompressed key should not spend")
+	}
+}
+
+func TestTxPool_NullDataOutput(t *testing.T) {
+	pool := NewTxPool(Genesis(MockGlobalEvn))
+	w1 := getTestWallet()
+	w2 := getTestWallet2()
+	prev := pool.Chain.Tx[pool.Chain.GetUtxo(w1.Address())[0].TxHash].Outputs[0]
+	build := func(data []byte, fee int64) *Transaction {
+		tx, err := BuildTx([]*Output{prev}, w1.Request(w2.Address(), 30, "data"), MockGlobalEvn.UnixTime())
+		if err != nil {
+			t.Fatal(err)
+		}
+		//从找零中销毁 fee
+		tx.Outputs[0].Fee -= fee
+		tx.Outputs = append(tx.Outputs, &Output{Fee: fee, Script: &Script{OpReturnA, OpPushDataA, data}})
+		resignTestTx(t, tx, w1)
+		return tx
+	}
+	//数据过长，或者带有地址
+	if resp := pool.Submit(build(make([]byte, MaxNullDataLen+1), 0)); resp.Err() == nil {
+		t.Fatal("null data too long")
+	}
+	tx := build([]byte("hello"), 0)
+	tx.Outputs[2].Address = w2.Address()
+	resignTestTx(t, tx, w1)
+	if resp := pool.Submit(tx); resp.Err() == nil {
+		t.Fatal("null data with address")
+	}
+	tx = build([]byte("hello"), 1)
+	if resp := pool.Submit(tx); resp.Err() != nil {
+		t.Fatal(resp.Err())
+	}
+	<-pool.txCh
+	//OP_RETURN 输出不进入utxo，销毁的金额不能再花费
+	appendTestBlock(t, pool, tx)
+	if len(pool.Chain.GetUtxo("")) != 0 || pool.Chain.Balance(w1.Address()) != GenesisCoinCount-31 {
+		t.Fatal("null data utxo", pool.Chain.Balance(w1.Address()))
+	}
+	if _, err := pool.Chain.DisconnectTip(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//修改交易后重新签名 P2PKH 输入
+func resignTestTx(t *testing.T, tx *Transaction, w *Wallet) {
+	for i, in := range tx.Inputs {
+		hash, err := tx.SigHash(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if in.Script, err = buildP2PKHInput(hash, w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.UpdateHash(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//打包交易池中已接受的交易并连接到链上
+func appendTestBlock(t *testing.T, pool *TxPool, txs ...*Transaction) *Block {
+	m := &Miner{p: pool, w: getTestWallet_(9)}
+	b, err := pool.Chain.NewBlock(m.createNewBlockTx(txs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r := b.TryHash(); ; r = b.TryHash() {
+		if r.Ok {
+			b.UpdateHash(r)
+			break
+		}
+	}
+	if err = pool.Chain.Append(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -2,7 +2,11 @@ package core
 
 import (
 	"bytes"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 )
 
 type OpCode byte
@@ -21,7 +25,62 @@ const (
 	//栈 （true,C,D,E)
 	OpCheckSign = 0x04
 
+	//脚本下一个数据作为数字入栈，必须是最短编码，见 ScriptNum
+	OpPushNum = 0x10
+	//出栈 b，a，a+b 入栈
+	OpAdd = 0x11
+	//出栈 b，a，a-b 入栈
+	OpSub = 0x12
+	//出栈 b，a，比较结果 true/false 入栈
+	OpNumEqual           = 0x13
+	OpLessThan           = 0x14
+	OpGreaterThan        = 0x15
+	OpLessThanOrEqual    = 0x16
+	OpGreaterThanOrEqual = 0x17
+	//出栈 2 个元素，字节相同时 true 入栈
+	OpEqual = 0x18
+
+	//出栈，为 true 时执行到 OP_ELSE 或 OP_ENDIF 之间的部分，可以嵌套
+	OpIf = 0x20
+	//与 OP_IF 相反
+	OpNotIf = 0x21
+	OpElse  = 0x22
+	OpEndIf = 0x23
+	//出栈，不为 true 时报错
+	OpVerify = 0x24
+	//执行到即失败，以它开头的输出不可花费，可以携带数据
+	OpReturn = 0x25
+
+	//出栈
+	OpDrop = 0x28
+	//交换栈顶两个元素
+	OpSwap = 0x29
+	//复制第二个元素到栈顶
+	OpOver = 0x2a
+	//出栈 n，复制第 n 个元素(栈顶为 0)到栈顶
+	OpPick = 0x2b
+	//出栈 n，把第 n 个元素移动到栈顶
+	OpRoll = 0x2c
+	//栈顶元素 SHA256
+	OpSha256 = 0x2d
+	//栈 (n, pubKey_n ... pubKey_1, m, sign_m ... sign_1)
+	//m 个签名按顺序与 n 个公钥匹配，全部校验通过时 true 入栈，否则报错
+	OpCheckMultiSig = 0x2e
+	//栈顶数字不能大于交易的 LockTime，且同为高度或同为时间，不出栈
+	OpCheckLockTimeVerify = 0x2f
+	//栈顶数字不能大于输入 Sequence 中的相对时间锁，且类型相同，不出栈
+	OpCheckSequenceVerify = 0x30
+
+	//签名的摘要 Transaction.SigHash
 	VMEnvHash = "VM_TX_HASH"
+	//*TxContext，花费输出的交易和包含它的区块
+	VMEnvTxContext = "VM_TX_CONTEXT"
+	//数字操作数的最大字节数，运算结果可以超过，但不能再作为操作数
+	scriptNumLen = 4
+	//时间锁操作数的最大字节数，4 字节的时间在 2038 年溢出
+	lockTimeNumLen = 5
+	//OP_RETURN 输出携带数据的最大长度
+	MaxNullDataLen = 80
 )
 
 var (
@@ -35,8 +94,52 @@ var (
 	OpSha160A     = []byte{OpSha160}
 	OpEqVerifyA   = []byte{OpEqVerify}
 	OpCheckSignA  = []byte{OpCheckSign}
+	OpPushNumA    = []byte{OpPushNum}
+	OpReturnA     = []byte{OpReturn}
+
+	OpCheckMultiSigA = []byte{OpCheckMultiSig}
+	OpEqualA         = []byte{OpEqual}
+	OpDropA          = []byte{OpDrop}
+
+	OpCheckLockTimeVerifyA = []byte{OpCheckLockTimeVerify}
+	OpCheckSequenceVerifyA = []byte{OpCheckSequenceVerify}
 )
 
+//脚本的可读形式中使用的操作码名称
+var opNames = map[OpCode]string{
+	OpPushData:  "OP_PUSHDATA",
+	OpDuplicate: "OP_DUP",
+	OpSha160:    "OP_SHA160",
+	OpEqVerify:  "OP_EQUALVERIFY",
+	OpCheckSign: "OP_CHECKSIG",
+
+	OpPushNum:            "OP_PUSHNUM",
+	OpAdd:                "OP_ADD",
+	OpSub:                "OP_SUB",
+	OpNumEqual:           "OP_NUMEQUAL",
+	OpLessThan:           "OP_LESSTHAN",
+	OpGreaterThan:        "OP_GREATERTHAN",
+	OpLessThanOrEqual:    "OP_LESSTHANOREQUAL",
+	OpGreaterThanOrEqual: "OP_GREATERTHANOREQUAL",
+	OpEqual:              "OP_EQUAL",
+	OpIf:                 "OP_IF",
+	OpNotIf:              "OP_NOTIF",
+	OpElse:               "OP_ELSE",
+	OpEndIf:              "OP_ENDIF",
+	OpVerify:             "OP_VERIFY",
+	OpReturn:             "OP_RETURN",
+	OpDrop:               "OP_DROP",
+	OpSwap:               "OP_SWAP",
+	OpOver:               "OP_OVER",
+	OpPick:               "OP_PICK",
+	OpRoll:               "OP_ROLL",
+	OpSha256:             "OP_SHA256",
+	OpCheckMultiSig:      "OP_CHECKMULTISIG",
+
+	OpCheckLockTimeVerify: "OP_CHECKLOCKTIMEVERIFY",
+	OpCheckSequenceVerify: "OP_CHECKSEQUENCEVERIFY",
+}
+
 func init() {
 	opExecMap = make(map[OpCode]OpExec)
 	opExecMap[OpPushData] = &OpPushDataExec{}
@@ -46,6 +149,32 @@ func init() {
 	opExecMap[OpCheckSign] = &OpCheckSignExec{
 		checkFn: Verify,
 	}
+	opExecMap[OpPushNum] = &OpPushNumExec{}
+	opExecMap[OpAdd] = &OpNumBinaryExec{fn: func(a, b int64) []byte { return ScriptNum(a + b) }}
+	opExecMap[OpSub] = &OpNumBinaryExec{fn: func(a, b int64) []byte { return ScriptNum(a - b) }}
+	opExecMap[OpNumEqual] = &OpNumBinaryExec{fn: func(a, b int64) []byte { return scriptBool(a == b) }}
+	opExecMap[OpLessThan] = &OpNumBinaryExec{fn: func(a, b int64) []byte { return scriptBool(a < b) }}
+	opExecMap[OpGreaterThan] = &OpNumBinaryExec{fn: func(a, b int64) []byte { return scriptBool(a > b) }}
+	opExecMap[OpLessThanOrEqual] = &OpNumBinaryExec{fn: func(a, b int64) []byte { return scriptBool(a <= b) }}
+	opExecMap[OpGreaterThanOrEqual] = &OpNumBinaryExec{fn: func(a, b int64) []byte { return scriptBool(a >= b) }}
+	opExecMap[OpEqual] = &OpEqualExec{}
+	opExecMap[OpIf] = &OpIfExec{}
+	opExecMap[OpNotIf] = &OpIfExec{not: true}
+	opExecMap[OpElse] = &OpElseExec{}
+	opExecMap[OpEndIf] = &OpEndIfExec{}
+	opExecMap[OpVerify] = &OpVerifyExec{}
+	opExecMap[OpReturn] = &OpReturnExec{}
+	opExecMap[OpDrop] = &OpDropExec{}
+	opExecMap[OpSwap] = &OpSwapExec{}
+	opExecMap[OpOver] = &OpOverExec{}
+	opExecMap[OpPick] = &OpPickExec{}
+	opExecMap[OpRoll] = &OpPickExec{roll: true}
+	opExecMap[OpSha256] = &OpSha256Exec{}
+	opExecMap[OpCheckMultiSig] = &OpCheckMultiSigExec{
+		checkFn: Verify,
+	}
+	opExecMap[OpCheckLockTimeVerify] = &OpCheckLockTimeVerifyExec{}
+	opExecMap[OpCheckSequenceVerify] = &OpCheckSequenceVerifyExec{}
 }
 
 type OpPushDataExec struct{}
@@ -121,6 +250,281 @@ func (o *OpCheckSignExec) exe(v *Vm) error {
 	return nil
 }
 
+// ==================================== Extended OpCodes ====================================
+
+type OpPushNumExec struct{}
+
+//数字二元运算，出栈 b，a，fn(a, b) 入栈
+type OpNumBinaryExec struct {
+	fn func(a, b int64) []byte
+}
+type OpEqualExec struct{}
+type OpIfExec struct {
+	not bool
+}
+type OpElseExec struct{}
+type OpEndIfExec struct{}
+type OpVerifyExec struct{}
+type OpReturnExec struct{}
+type OpDropExec struct{}
+type OpSwapExec struct{}
+type OpOverExec struct{}
+type OpPickExec struct {
+	roll bool
+}
+type OpSha256Exec struct{}
+type OpCheckMultiSigExec struct {
+	checkFn func(msgHash, sign, pubKey []byte) bool
+}
+type OpCheckLockTimeVerifyExec struct{}
+type OpCheckSequenceVerifyExec struct{}
+
+func (o *OpPushNumExec) exe(v *Vm) error {
+	if v.op+1 >= len(v.script) {
+		return ErrWrapf("Invalid op code!Next script element is nil\n")
+	}
+	if _, err := parseScriptNum(v.script[v.op+1]); err != nil {
+		return ErrWrap("Invalid opPushNum", err)
+	}
+	v.stack.push(CopyBytes(v.script[v.op+1]))
+	v.op += 2
+	return nil
+}
+
+func (o *OpNumBinaryExec) exe(v *Vm) error {
+	b, err := v.popNum()
+	if err != nil {
+		return err
+	}
+	a, err := v.popNum()
+	if err != nil {
+		return err
+	}
+	v.stack.push(o.fn(a, b))
+	v.op += 1
+	return nil
+}
+
+func (o *OpEqualExec) exe(v *Vm) error {
+	if v.stack.size() < 2 {
+		return ErrWrapf("Invalid opEqual \n")
+	}
+	b1, _ := v.stack.pop()
+	b2, _ := v.stack.pop()
+	v.stack.push(scriptBool(bytes.Equal(b1, b2)))
+	v.op += 1
+	return nil
+}
+
+//不执行的分支中也要记录嵌套，此时不出栈
+func (o *OpIfExec) exe(v *Vm) error {
+	cond := false
+	if v.executing() {
+		b, err := v.stack.pop()
+		if err != nil {
+			return ErrWrap("Invalid opIf", err)
+		}
+		cond = castToBool(b) != o.not
+	}
+	v.cond = append(v.cond, cond)
+	v.op += 1
+	return nil
+}
+
+func (o *OpElseExec) exe(v *Vm) error {
+	if len(v.cond) == 0 {
+		return ErrWrapf("OP_ELSE without OP_IF")
+	}
+	v.cond[len(v.cond)-1] = !v.cond[len(v.cond)-1]
+	v.op += 1
+	return nil
+}
+
+func (o *OpEndIfExec) exe(v *Vm) error {
+	if len(v.cond) == 0 {
+		return ErrWrapf("OP_ENDIF without OP_IF")
+	}
+	v.cond = v.cond[:len(v.cond)-1]
+	v.op += 1
+	return nil
+}
+
+func (o *OpVerifyExec) exe(v *Vm) error {
+	b, err := v.stack.pop()
+	if err != nil {
+		return ErrWrap("Invalid opVerify", err)
+	}
+	if !castToBool(b) {
+		return ErrWrapf("Verify failed")
+	}
+	v.op += 1
+	return nil
+}
+
+func (o *OpReturnExec) exe(v *Vm) error {
+	return ErrWrapf("OP_RETURN executed, script is unspendable")
+}
+
+func (o *OpDropExec) exe(v *Vm) error {
+	if _, err := v.stack.pop(); err != nil {
+		return ErrWrap("Invalid opDrop", err)
+	}
+	v.op += 1
+	return nil
+}
+
+func (o *OpSwapExec) exe(v *Vm) error {
+	if v.stack.size() < 2 {
+		return ErrWrapf("Invalid opSwap \n")
+	}
+	n := v.stack.size()
+	v.stack.data[n-1], v.stack.data[n-2] = v.stack.data[n-2], v.stack.data[n-1]
+	v.op += 1
+	return nil
+}
+
+func (o *OpOverExec) exe(v *Vm) error {
+	b, err := v.stack.nth(1)
+	if err != nil {
+		return ErrWrap("Invalid opOver", err)
+	}
+	v.stack.push(CopyBytes(b))
+	v.op += 1
+	return nil
+}
+
+func (o *OpPickExec) exe(v *Vm) error {
+	n, err := v.popNum()
+	if err != nil {
+		return err
+	}
+	if n < 0 || n >= int64(v.stack.size()) {
+		return ErrWrapf("Invalid opPick index %d of stack size %d", n, v.stack.size())
+	}
+	b, _ := v.stack.nth(int(n))
+	if o.roll {
+		i := v.stack.size() - 1 - int(n)
+		v.stack.data = append(v.stack.data[:i], v.stack.data[i+1:]...)
+	} else {
+		b = CopyBytes(b)
+	}
+	v.stack.push(b)
+	v.op += 1
+	return nil
+}
+
+func (o *OpSha256Exec) exe(v *Vm) error {
+	bs, err := v.stack.pop()
+	if err != nil {
+		return ErrWrap("Invalid opSha256", err)
+	}
+	v.stack.push(Sha256(bs))
+	v.op += 1
+	return nil
+}
+
+//签名和公钥都按压栈的顺序，每个公钥最多匹配一个签名
+func (o *OpCheckMultiSigExec) exe(v *Vm) error {
+	n, err := v.popNum()
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > MaxMultiSigKeys || n > int64(v.stack.size()) {
+		return ErrWrapf("Invalid opCheckMultiSig key count %d", n)
+	}
+	keys := v.stack.popN(int(n))
+	m, err := v.popNum()
+	if err != nil {
+		return err
+	}
+	if m < 1 || m > n || m > int64(v.stack.size()) {
+		return ErrWrapf("Invalid opCheckMultiSig signature count %d of %d", m, n)
+	}
+	signs := v.stack.popN(int(m))
+	hash, ok := v.GetEnv(VMEnvHash)
+	if !ok {
+		return ErrWrapf("No hash found!\n")
+	}
+	h := hash.([]byte)
+	k := 0
+	for i, sign := range signs {
+		for k < len(keys) && !o.checkFn(h, sign, keys[k]) {
+			k++
+		}
+		if k == len(keys) {
+			return ErrWrapf("MultiSig check failed at signature %d", i)
+		}
+		k++
+	}
+	v.stack.push(CodeTrue)
+	v.op += 1
+	return nil
+}
+
+//交易的 LockTime 不小于要求，交易 final 时说明已经到达该高度或时间
+func (o *OpCheckLockTimeVerifyExec) exe(v *Vm) error {
+	n, ctx, err := v.lockTimeOperand()
+	if err != nil {
+		return ErrWrap("Invalid opCheckLockTimeVerify", err)
+	}
+	lockTime := ctx.Tx.LockTime
+	if (n < LockTimeThreshold) != (lockTime < LockTimeThreshold) {
+		return ErrWrapf("Lock time type mismatch, require %d, tx lock time %d", n, lockTime)
+	}
+	if n > lockTime {
+		return ErrWrapf("Lock time %d not reached, tx lock time %d", n, lockTime)
+	}
+	v.op += 1
+	return nil
+}
+
+//输入的 Sequence 不小于要求，区块校验时保证相对时间锁已经满足
+func (o *OpCheckSequenceVerifyExec) exe(v *Vm) error {
+	n, ctx, err := v.lockTimeOperand()
+	if err != nil {
+		return ErrWrap("Invalid opCheckSequenceVerify", err)
+	}
+	//操作数禁用相对时间锁时什么也不做
+	if n&SequenceLockTimeDisabled == 0 {
+		sequence := int64(ctx.Tx.Inputs[ctx.Index].Sequence)
+		if sequence&SequenceLockTimeDisabled != 0 {
+			return ErrWrapf("Input %d sequence %d disables relative lock time", ctx.Index, sequence)
+		}
+		if n&SequenceLockTimeTypeFlag != sequence&SequenceLockTimeTypeFlag {
+			return ErrWrapf("Sequence type mismatch, require %d, input sequence %d", n, sequence)
+		}
+		if n&SequenceLockTimeMask > sequence&SequenceLockTimeMask {
+			return ErrWrapf("Sequence %d not reached, input sequence %d", n, sequence)
+		}
+	}
+	v.op += 1
+	return nil
+}
+
+//时间锁的操作数为栈顶的非负数，不出栈
+func (v *Vm) lockTimeOperand() (int64, *TxContext, error) {
+	b, err := v.stack.peek()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := parseScriptNumLen(b, lockTimeNumLen)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n < 0 {
+		return 0, nil, ErrWrapf("Negative lock time %d", n)
+	}
+	c, ok := v.GetEnv(VMEnvTxContext)
+	if !ok {
+		return 0, nil, ErrWrapf("No tx context found!")
+	}
+	ctx := c.(*TxContext)
+	if ctx.Index < 0 || ctx.Index >= len(ctx.Tx.Inputs) {
+		return 0, nil, ErrWrapf("Invalid input index %d", ctx.Index)
+	}
+	return n, ctx, nil
+}
+
 type OpExec interface {
 	exe(v *Vm) error
 }
@@ -131,6 +535,8 @@ type Vm struct {
 	script  Script
 	execMap map[OpCode]OpExec
 	env     map[string]interface{}
+	//OP_IF 的执行条件，全部为 true 时才执行
+	cond []bool
 }
 
 func NewVm(script Script) *Vm {
@@ -180,6 +586,11 @@ func (v *Vm) Exec() error {
 		if !exist {
 			return ErrWrapf("Invalid opCode :%v ", opSlice[0])
 		}
+		//不执行的分支只处理流程控制
+		if !v.executing() && !isFlowControl(code) {
+			v.op += opLen(code)
+			continue
+		}
 		Log.Debug("Run op code: ", code, " at pos [", v.op, "]")
 		err := exec.exe(v)
 		if err != nil {
@@ -188,6 +599,9 @@ func (v *Vm) Exec() error {
 			return err
 		}
 	}
+	if len(v.cond) != 0 {
+		return ErrWrapf("Unbalanced conditional, OP_ENDIF expected")
+	}
 	stackSize := v.stack.size()
 	if stackSize == 0 {
 		return nil
@@ -199,6 +613,153 @@ func (v *Vm) Exec() error {
 	return VmExecErr
 }
 
+func (v *Vm) executing() bool {
+	for _, it := range v.cond {
+		if !it {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *Vm) popNum() (int64, error) {
+	b, err := v.stack.pop()
+	if err != nil {
+		return 0, ErrWrap("Invalid number operand", err)
+	}
+	return parseScriptNum(b)
+}
+
+func isFlowControl(code OpCode) bool {
+	return code == OpIf || code == OpNotIf || code == OpElse || code == OpEndIf
+}
+
+//操作码和它携带的数据占用的元素个数
+func opLen(code OpCode) int {
+	if code == OpPushData || code == OpPushNum {
+		return 2
+	}
+	return 1
+}
+
+//脚本中数字的编码: 小端，最高字节的最高位为符号位，0 为空
+func ScriptNum(n int64) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+	neg := n < 0
+	abs := uint64(n)
+	if neg {
+		abs = uint64(-n)
+	}
+	r := make([]byte, 0, 9)
+	for abs > 0 {
+		r = append(r, byte(abs))
+		abs >>= 8
+	}
+	//最高位已被占用时增加一个字节放符号
+	if r[len(r)-1]&0x80 != 0 {
+		if neg {
+			r = append(r, 0x80)
+		} else {
+			r = append(r, 0x00)
+		}
+	} else if neg {
+		r[len(r)-1] |= 0x80
+	}
+	return r
+}
+
+func parseScriptNum(b []byte) (int64, error) {
+	return parseScriptNumLen(b, scriptNumLen)
+}
+
+//只接受不超过 maxLen 字节的最短编码
+func parseScriptNumLen(b []byte, maxLen int) (int64, error) {
+	if len(b) > maxLen {
+		return 0, ErrWrapf("Script number overflow, %d bytes", len(b))
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	//最高字节只有符号位时，次高字节的最高位必须为 1
+	if b[len(b)-1]&0x7f == 0 && (len(b) == 1 || b[len(b)-2]&0x80 == 0) {
+		return 0, ErrWrapf("Script number not minimally encoded %x", b)
+	}
+	var r int64
+	for i, it := range b {
+		r |= int64(it) << (8 * uint(i))
+	}
+	if b[len(b)-1]&0x80 != 0 {
+		return -(r &^ (int64(0x80) << (8 * uint(len(b)-1)))), nil
+	}
+	return r, nil
+}
+
+//非 0 (包括 -0) 为 true
+func castToBool(b []byte) bool {
+	for i, it := range b {
+		if it != 0 {
+			return i != len(b)-1 || it != 0x80
+		}
+	}
+	return false
+}
+
+func scriptBool(b bool) []byte {
+	if b {
+		return CodeTrue
+	}
+	return ScriptNum(0)
+}
+
+//以 OP_RETURN 开头的脚本不可能执行成功
+func (s *Script) IsUnspendable() bool {
+	return s != nil && len(*s) > 0 && bytes.Equal((*s)[0], OpReturnA)
+}
+
+//OP_RETURN <data> 输出脚本
+func NullDataScript(data []byte) (*Script, error) {
+	if len(data) > MaxNullDataLen {
+		return nil, ErrWrapf("Null data len %d exceed max len %d", len(data), MaxNullDataLen)
+	}
+	return &Script{OpReturnA, OpPushDataA, CopyBytes(data)}, nil
+}
+
+//脚本的可读形式(ASM)，数据以hex表示
+//OP_DUP OP_SHA160 OP_PUSHDATA <hex> OP_EQUALVERIFY OP_CHECKSIG
+func (s *Script) Asm() string {
+	if s == nil {
+		return ""
+	}
+	r := make([]string, 0, len(*s))
+	for i := 0; i < len(*s); i++ {
+		it := (*s)[i]
+		if len(it) != 1 {
+			r = append(r, hex.EncodeToString(it))
+			continue
+		}
+		name, ok := opNames[OpCode(it[0])]
+		if !ok {
+			name = fmt.Sprintf("OP_UNKNOWN<%d>", it[0])
+		}
+		r = append(r, name)
+		if OpCode(it[0]) == OpPushData && i+1 < len(*s) {
+			i++
+			r = append(r, hex.EncodeToString((*s)[i]))
+		}
+		if OpCode(it[0]) == OpPushNum && i+1 < len(*s) {
+			i++
+			if n, err := parseScriptNum((*s)[i]); err == nil {
+				r = append(r, strconv.FormatInt(n, 10))
+			} else {
+				r = append(r, hex.EncodeToString((*s)[i]))
+			}
+		}
+	}
+	return strings.Join(r, " ")
+}
+
 type Stack struct {
 	data [][]byte
 }
@@ -222,6 +783,23 @@ func (s *Stack) peek() ([]byte, error) {
 	return s.data[s.size()-1], nil
 }
 
+//出栈 n 个元素，按压栈的顺序返回
+func (s *Stack) popN(n int) [][]byte {
+	i := s.size() - n
+	r := make([][]byte, n)
+	copy(r, s.data[i:])
+	s.data = s.data[:i]
+	return r
+}
+
+//第 i 个元素，栈顶为 0
+func (s *Stack) nth(i int) ([]byte, error) {
+	if i < 0 || i >= s.size() {
+		return nil, EmptyStackErr
+	}
+	return s.data[s.size()-1-i], nil
+}
+
 func (s *Stack) pop() ([]byte, error) {
 	if s.size() == 0 {
 		return nil, EmptyStackErr
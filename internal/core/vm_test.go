@@ -221,3 +221,269 @@ func TestVmExec_OpSign(t *testing.T) {
 	}
 
 }
+
+func TestScript_Asm(t *testing.T) {
+	s := Script{OpDuplicateA, OpPushDataA, {0xab, 0x01}, {0x7f}}
+	if s.Asm() != "OP_DUP OP_PUSHDATA ab01 OP_UNKNOWN<127>" {
+		t.Fatal(s.Asm())
+	}
+}
+
+func TestScriptNum(t *testing.T) {
+	cases := map[int64]string{
+		0:     "",
+		1:     "01",
+		-1:    "81",
+		127:   "7f",
+		128:   "8000",
+		-128:  "8080",
+		255:   "ff00",
+		256:   "0001",
+		-256:  "0081",
+		32767: "ff7f",
+		32768: "008000",
+	}
+	for n, h := range cases {
+		b := ScriptNum(n)
+		if hex.EncodeToString(b) != h {
+			t.Fatal(n, hex.EncodeToString(b))
+		}
+		r, err := parseScriptNum(b)
+		if err != nil || r != n {
+			t.Fatal(n, r, err)
+		}
+	}
+	//非最短编码和超长
+	for _, h := range []string{"00", "80", "0100", "0180", "7f00", "0000000001"} {
+		b, _ := hex.DecodeString(h)
+		if _, err := parseScriptNum(b); err == nil {
+			t.Fatal(h)
+		}
+	}
+}
+
+func TestVmExec_Arithmetic(t *testing.T) {
+	num := func(n int64) [][]byte {
+		return [][]byte{OpPushNumA, ScriptNum(n)}
+	}
+	script := func(parts ...[][]byte) Script {
+		s := Script{}
+		for _, it := range parts {
+			s = append(s, it...)
+		}
+		return s
+	}
+	ok := []Script{
+		script(num(2), num(3), [][]byte{{OpAdd}}, num(5), [][]byte{{OpNumEqual}}),
+		script(num(2), num(3), [][]byte{{OpSub}}, num(-1), [][]byte{{OpNumEqual}}),
+		script(num(2), num(3), [][]byte{{OpLessThan}}),
+		script(num(3), num(2), [][]byte{{OpGreaterThan}}),
+		script(num(3), num(3), [][]byte{{OpLessThanOrEqual}}),
+		script(num(-3), num(-3), [][]byte{{OpGreaterThanOrEqual}}),
+		script(num(1000), num(-1000), [][]byte{{OpAdd}, {OpPushData}, {}, {OpEqual}}),
+	}
+	for i, s := range ok {
+		if err := NewVm(s).Exec(); err != nil {
+			t.Fatal(i, s.Asm(), err)
+		}
+	}
+	fail := []Script{
+		script(num(3), num(2), [][]byte{{OpLessThan}}),
+		script(num(2), num(3), [][]byte{{OpAdd}}, num(6), [][]byte{{OpNumEqual}}),
+		//非最短编码
+		{OpPushNumA, {0x02, 0x00}},
+		//操作数超过 4 字节
+		{OpPushDataA, {1, 2, 3, 4, 5}, OpPushNumA, {1}, {OpAdd}},
+		script(num(1), [][]byte{{OpAdd}}),
+	}
+	for i, s := range fail {
+		if err := NewVm(s).Exec(); err == nil {
+			t.Fatal(i, s.Asm())
+		}
+	}
+	//运算结果可以超过 4 字节
+	vm := NewVm(script(num(0x7fffffff), num(1), [][]byte{{OpAdd}}))
+	_ = vm.Exec()
+	if p, _ := vm.stack.peek(); hex.EncodeToString(p) != "0000008000" {
+		t.Fatal(hex.EncodeToString(p))
+	}
+}
+
+func TestVmExec_OpIf(t *testing.T) {
+	cases := []struct {
+		s    Script
+		want string
+	}{
+		{Script{OpPushNumA, {1}, {OpIf}, OpPushNumA, {2}, {OpElse}, OpPushNumA, {3}, {OpEndIf}}, "02"},
+		{Script{OpPushNumA, {}, {OpIf}, OpPushNumA, {2}, {OpElse}, OpPushNumA, {3}, {OpEndIf}}, "03"},
+		{Script{OpPushNumA, {}, {OpNotIf}, OpPushNumA, {2}, {OpEndIf}}, "02"},
+		//嵌套，不执行的分支中的 OP_IF 不出栈
+		{Script{OpPushNumA, {}, {OpIf}, {OpIf}, OpPushNumA, {2}, {OpElse}, OpPushNumA, {3}, {OpEndIf}, {OpElse}, OpPushNumA, {4}, {OpEndIf}}, "04"},
+		{Script{OpPushNumA, {1}, OpPushNumA, {}, {OpIf}, OpPushNumA, {2}, {OpElse}, {OpIf}, OpPushNumA, {3}, {OpEndIf}, {OpEndIf}}, "03"},
+		//不执行的分支中的 OP_RETURN 没有影响
+		{Script{OpPushNumA, {}, {OpIf}, OpReturnA, {OpEndIf}, OpPushNumA, {5}}, "05"},
+	}
+	for i, c := range cases {
+		vm := NewVm(c.s)
+		if err := vm.Exec(); err != VmExecErr {
+			t.Fatal(i, c.s.Asm(), err)
+		}
+		if p, _ := vm.stack.peek(); vm.stack.size() != 1 || hex.EncodeToString(p) != c.want {
+			t.Fatal(i, c.s.Asm(), hex.EncodeToString(p))
+		}
+	}
+	for _, s := range []Script{
+		{OpPushNumA, {1}, {OpIf}},
+		{{OpElse}},
+		{{OpEndIf}},
+		{{OpIf}},
+	} {
+		if err := NewVm(s).Exec(); err == nil || err == VmExecErr {
+			t.Fatal(s.Asm(), err)
+		}
+	}
+}
+
+func TestVmExec_OpVerify(t *testing.T) {
+	if err := NewVm(Script{OpPushNumA, {1}, {OpVerify}}).Exec(); err != nil {
+		t.Fatal(err)
+	}
+	//-0 为 false
+	for _, s := range []Script{{OpPushNumA, {}, {OpVerify}}, {OpPushDataA, {0x80}, {OpVerify}}, {{OpVerify}}} {
+		if err := NewVm(s).Exec(); err == nil {
+			t.Fatal(s.Asm())
+		}
+	}
+}
+
+func TestVmExec_OpReturn(t *testing.T) {
+	s, err := NullDataScript([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.IsUnspendable() || s.Asm() != "OP_RETURN OP_PUSHDATA 68656c6c6f" {
+		t.Fatal(s.Asm())
+	}
+	vm := NewVm(*ConcatScript(&Script{OpPushNumA, {1}}, s))
+	if err = vm.Exec(); err == nil || !strings.Contains(err.Error(), "OP_RETURN") {
+		t.Fatal(err)
+	}
+	if _, err = NullDataScript(make([]byte, MaxNullDataLen+1)); err == nil {
+		t.Fatal("data too long")
+	}
+	if buildP2PKHOutput(getTestWallet().PublicKey()).IsUnspendable() {
+		t.Fatal("p2pkh unspendable")
+	}
+}
+
+func TestVmExec_StackOps(t *testing.T) {
+	push := func(bs ...byte) Script {
+		s := Script{}
+		for _, b := range bs {
+			s = append(s, OpPushDataA, []byte{b})
+		}
+		return s
+	}
+	cases := []struct {
+		s    Script
+		want string
+	}{
+		{append(push(1, 2), []byte{OpDrop}), "01"},
+		{append(push(1, 2), []byte{OpSwap}), "0201"},
+		{append(push(1, 2), []byte{OpOver}), "010201"},
+		{append(push(1, 2, 3), OpPushNumA, []byte{2}, []byte{OpPick}), "01020301"},
+		{append(push(1, 2, 3), OpPushNumA, []byte{}, []byte{OpPick}), "01020303"},
+		{append(push(1, 2, 3), OpPushNumA, []byte{2}, []byte{OpRoll}), "020301"},
+		{append(push(1, 2, 3), OpPushNumA, []byte{1}, []byte{OpRoll}), "010302"},
+	}
+	for i, c := range cases {
+		vm := NewVm(c.s)
+		_ = vm.Exec()
+		got := ""
+		for _, it := range vm.stack.data {
+			got += hex.EncodeToString(it)
+		}
+		if got != c.want {
+			t.Fatal(i, c.s.Asm(), got)
+		}
+	}
+	for _, s := range []Script{
+		{{OpDrop}},
+		append(push(1), []byte{OpSwap}),
+		append(push(1), []byte{OpOver}),
+		append(push(1), OpPushNumA, []byte{1}, []byte{OpPick}),
+		append(push(1), OpPushNumA, []byte{0x81}, []byte{OpRoll}),
+	} {
+		if err := NewVm(s).Exec(); err == nil || err == VmExecErr {
+			t.Fatal(s.Asm(), err)
+		}
+	}
+	//OP_PICK 复制的元素与原元素互不影响
+	vm := NewVm(append(push(7), OpPushNumA, []byte{}, []byte{OpPick}))
+	_ = vm.Exec()
+	vm.stack.data[1][0] = 8
+	if vm.stack.data[0][0] != 7 {
+		t.Fatal("pick should copy")
+	}
+}
+
+func TestVmExec_OpSha256(t *testing.T) {
+	s := Script{OpPushDataA, []byte("abc"), {OpSha256}}
+	vm := NewVm(s)
+	_ = vm.Exec()
+	p, _ := vm.stack.peek()
+	if hex.EncodeToString(p) != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Fatal(hex.EncodeToString(p))
+	}
+}
+
+func TestScript_AsmExtended(t *testing.T) {
+	s := Script{OpPushNumA, ScriptNum(-5), {OpIf}, {OpSha256}, {OpElse}, {OpDrop}, {OpEndIf}, OpPushNumA, {0x00}}
+	if s.Asm() != "OP_PUSHNUM -5 OP_IF OP_SHA256 OP_ELSE OP_DROP OP_ENDIF OP_PUSHNUM 00" {
+		t.Fatal(s.Asm())
+	}
+}
+
+func TestVmExec_OpCheckMultiSig(t *testing.T) {
+	//签名与公钥相同即为有效
+	check := &OpCheckMultiSigExec{checkFn: func(hash, sign, pubKey []byte) bool {
+		return bytes.Equal(sign, pubKey)
+	}}
+	//2-of-3
+	out := Script{OpPushNumA, {2}, OpPushDataA, {1}, OpPushDataA, {2}, OpPushDataA, {3}, OpPushNumA, {3}, OpCheckMultiSigA}
+	run := func(in Script) error {
+		vm := NewVm(*ConcatScript(&in, &out))
+		vm.SetEnv(VMEnvHash, []byte("any"))
+		vm.CustomExec(OpCheckMultiSig, check)
+		return vm.Exec()
+	}
+	for _, in := range []Script{
+		{OpPushDataA, {1}, OpPushDataA, {2}},
+		{OpPushDataA, {1}, OpPushDataA, {3}},
+		{OpPushDataA, {2}, OpPushDataA, {3}},
+	} {
+		if err := run(in); err != nil {
+			t.Fatal(in.Asm(), err)
+		}
+	}
+	for _, in := range []Script{
+		//顺序与公钥不同
+		{OpPushDataA, {3}, OpPushDataA, {1}},
+		//同一个签名不能用两次
+		{OpPushDataA, {1}, OpPushDataA, {1}},
+		{OpPushDataA, {1}, OpPushDataA, {4}},
+		//签名不够
+		{OpPushDataA, {1}},
+	} {
+		if err := run(in); err == nil {
+			t.Fatal(in.Asm())
+		}
+	}
+	//m 大于 n
+	vm := NewVm(Script{OpPushDataA, {1}, OpPushDataA, {1}, OpPushNumA, {2}, OpPushDataA, {1}, OpPushNumA, {1}, OpCheckMultiSigA})
+	vm.SetEnv(VMEnvHash, []byte("any"))
+	vm.CustomExec(OpCheckMultiSig, check)
+	if err := vm.Exec(); err == nil || !strings.Contains(err.Error(), "signature count") {
+		t.Fatal(err)
+	}
+}
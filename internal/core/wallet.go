@@ -9,35 +9,186 @@ import (
 )
 
 const (
-	Version      byte = 0x0
-	PubKeyLen         = 64
-	LenVersion        = 1
-	LenCheckSum       = 4
-	LenRipemd160      = 20
+	//主网的地址版本，其他网络见 NetParams
+	Version byte = 0x0
+	//公钥为定长的 X||Y 各 32 字节，也接受 33 字节的压缩公钥
+	PubKeyLen           = 64
+	CompressedPubKeyLen = 33
+	//签名为定长的 r||s 各 32 字节，s 必须不大于 n/2
+	SignatureLen = 64
+	coordLen     = 32
+	LenVersion   = 1
+	LenCheckSum  = 4
+	LenRipemd160 = 20
+	//版本 + 私钥 + 校验和，不含压缩标记
+	wifLen            = LenVersion + coordLen + LenCheckSum
+	wifCompressedFlag = 0x01
 )
 
+//n/2，用于 low-S 规则
+var halfOrder = new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+
 type Wallet struct {
 	priv *ecdsa.PrivateKey
+	//使用压缩公钥，地址和输入脚本都随之变化，由 WIF 的压缩标记决定
+	compressed bool
 }
 
+//默认为 64 字节公钥，从压缩格式的 WIF 导入时为 33 字节
 func (a *Wallet) PublicKey() []byte {
-	return append(a.priv.X.Bytes(), a.priv.Y.Bytes()...)
+	if a.compressed {
+		return a.CompressedPublicKey()
+	}
+	return pubKeyBytes(a.priv.X, a.priv.Y)
+}
+
+//33 字节压缩公钥，与 PublicKey 对应不同的地址
+func (a *Wallet) CompressedPublicKey() []byte {
+	return compressPubKey(a.priv.X, a.priv.Y)
+}
+
+//公钥坐标补齐到 32 字节后拼接，big.Int.Bytes() 会去掉前导0
+func pubKeyBytes(x, y *big.Int) []byte {
+	return ConcatBytes(padBytes(x.Bytes(), coordLen), padBytes(y.Bytes(), coordLen))
+}
+
+func compressPubKey(x, y *big.Int) []byte {
+	r := make([]byte, CompressedPubKeyLen)
+	r[0] = 0x02 + byte(y.Bit(0))
+	copy(r[1:], padBytes(x.Bytes(), coordLen))
+	return r
+}
+
+//解压缩 33 字节公钥，P-256 的 p ≡ 3 (mod 4)，y = (x^3 - 3x + b)^((p+1)/4)
+func decompressPubKey(b []byte) (*big.Int, *big.Int, error) {
+	if len(b) != CompressedPubKeyLen || (b[0] != 0x02 && b[0] != 0x03) {
+		return nil, nil, ErrWrapf("invalid compressed public key")
+	}
+	params := elliptic.P256().Params()
+	p := params.P
+	x := new(big.Int).SetBytes(b[1:])
+	if x.Cmp(p) >= 0 {
+		return nil, nil, ErrWrapf("invalid compressed public key")
+	}
+	x3 := new(big.Int).Exp(x, big.NewInt(3), p)
+	threeX := new(big.Int).Mul(x, big.NewInt(3))
+	y2 := new(big.Int).Sub(x3, threeX)
+	y2.Add(y2, params.B)
+	y2.Mod(y2, p)
+	e := new(big.Int).Add(p, big.NewInt(1))
+	e.Rsh(e, 2)
+	y := new(big.Int).Exp(y2, e, p)
+	if new(big.Int).Exp(y, big.NewInt(2), p).Cmp(y2) != 0 {
+		return nil, nil, ErrWrapf("invalid compressed public key: not on curve")
+	}
+	if y.Bit(0) != uint(b[0]&1) {
+		y.Sub(p, y)
+	}
+	return x, y, nil
+}
+
+//解析 64 字节或 33 字节公钥，并检查点在曲线上
+func ParsePublicKey(b []byte) (*ecdsa.PublicKey, error) {
+	var x, y *big.Int
+	switch len(b) {
+	case PubKeyLen:
+		x = new(big.Int).SetBytes(b[:coordLen])
+		y = new(big.Int).SetBytes(b[coordLen:])
+		p := elliptic.P256().Params().P
+		if x.Cmp(p) >= 0 || y.Cmp(p) >= 0 || !elliptic.P256().IsOnCurve(x, y) {
+			return nil, ErrWrapf("invalid public key: not on curve")
+		}
+	case CompressedPubKeyLen:
+		var err error
+		if x, y, err = decompressPubKey(b); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrWrapf("invalid public key size %d", len(b))
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
 }
 
+//定长 32 字节私钥
 func (a *Wallet) PrivateKey() []byte {
-	return a.priv.D.Bytes()
+	return padBytes(a.priv.D.Bytes(), coordLen)
+}
+
+//Wallet Import Format: Base58Check(版本 + 32 字节私钥 [+ 0x01 压缩标记])，版本为当前网络的 PrivateKeyVersion
+func (a *Wallet) WIF() string {
+	b := ConcatBytes([]byte{ActiveNet().PrivateKeyVersion}, a.PrivateKey())
+	if a.compressed {
+		b = append(b, wifCompressedFlag)
+	}
+	return Base58(ConcatBytes(b, Sha256(Sha256(b))[:LenCheckSum]))
+}
+
+func (a *Wallet) IsCompressed() bool {
+	return a.compressed
 }
 
-//Version = 1 byte of 0 (zero); on the test network, this is 1 byte of 111
+//解析 WIF 私钥，带压缩标记时钱包使用压缩公钥的地址
+func ParseWIF(s string) (*Wallet, error) {
+	b, err := Base58Decode(s)
+	if err != nil {
+		return nil, ErrWrap("invalid wif", err)
+	}
+	l := len(b)
+	if l != wifLen && l != wifLen+1 {
+		return nil, ErrWrapf("invalid wif size %d", l)
+	}
+	payload := b[:l-LenCheckSum]
+	if !bytes.Equal(b[l-LenCheckSum:], Sha256(Sha256(payload))[:LenCheckSum]) {
+		return nil, ErrWrapf("invalid wif checksum")
+	}
+	if active := ActiveNet(); payload[0] != active.PrivateKeyVersion {
+		if n, ok := netByPrivateKeyVersion(payload[0]); ok {
+			return nil, ErrWrapf("private key is for network %s, active network is %s", n.Name, active.Name)
+		}
+		return nil, ErrWrapf("invalid wif version %d", payload[0])
+	}
+	compressed := len(payload) == LenVersion+coordLen+1
+	if compressed && payload[len(payload)-1] != wifCompressedFlag {
+		return nil, ErrWrapf("invalid wif compression flag")
+	}
+	d := new(big.Int).SetBytes(payload[LenVersion : LenVersion+coordLen])
+	if d.Sign() == 0 || d.Cmp(elliptic.P256().Params().N) >= 0 {
+		return nil, ErrWrapf("invalid private key")
+	}
+	w := RestoreWallet(d.Bytes())
+	w.compressed = compressed
+	return w, nil
+}
+
+//Version = 当前网络的 AddressVersion, 主网为 0
 //Key hash = Version concatenated with RIPEMD-160(SHA-256(public key))
 //Checksum = 1st 4 bytes of SHA-256(SHA-256(Key hash))
 //Bitcoin Address = Base58Encode(Key hash concatenated with Checksum)
 func (a *Wallet) Address() string {
-	pub := a.PublicKey()
-	mid := Sha160(Sha256(pub))
-	checkSum := Sha256(Sha256(ConcatBytes([]byte{Version}, mid)))[:LenCheckSum]
+	return pubKeyAddress(a.PublicKey())
+}
+
+func pubKeyAddress(pub []byte) string {
+	return Ripemd160ToAddress(Sha160(Sha256(pub)))
+}
+
+//公钥 hash 编码为当前网络的地址
+func Ripemd160ToAddress(mid []byte) string {
+	version := ActiveNet().AddressVersion
+	checkSum := Sha256(Sha256(ConcatBytes([]byte{version}, mid)))[:LenCheckSum]
 	// 1byte version + 20 byte sha160 + 4 byte checksum
-	return Base58(ConcatBytes([]byte{Version}, mid, checkSum))
+	return Base58(ConcatBytes([]byte{version}, mid, checkSum))
+}
+
+//bech32 格式的地址，与 Address 对应同一个公钥 hash
+func (a *Wallet) Bech32Address() string {
+	return Ripemd160ToBech32Address(Sha160(Sha256(a.PublicKey())))
+}
+
+func Ripemd160ToBech32Address(mid []byte) string {
+	//hrp 和 program 长度固定，不会出错
+	r, _ := EncodeBech32Address(ActiveNet().Bech32HRP, Bech32AddressVersion, mid)
+	return r
 }
 
 //使用私钥签名
@@ -46,59 +197,167 @@ func (a *Wallet) Sign(msg []byte) ([]byte, error) {
 	if err != nil {
 		return nil, ErrWrap("sign error", err)
 	}
-	return append(r.Bytes(), s.Bytes()...), nil
+	//(r, s) 和 (r, n-s) 都是有效签名，只使用较小的 s 避免签名被篡改
+	if s.Cmp(halfOrder) > 0 {
+		s.Sub(elliptic.P256().Params().N, s)
+	}
+	return ConcatBytes(padBytes(r.Bytes(), coordLen), padBytes(s.Bytes(), coordLen)), nil
+}
+
+//解析定长签名，只接受 1 <= r < n 和 1 <= s <= n/2 的规范形式
+func ParseSignature(sign []byte) (*big.Int, *big.Int, error) {
+	if len(sign) != SignatureLen {
+		return nil, nil, ErrWrapf("invalid signature size %d", len(sign))
+	}
+	r := new(big.Int).SetBytes(sign[:coordLen])
+	s := new(big.Int).SetBytes(sign[coordLen:])
+	if r.Sign() == 0 || r.Cmp(elliptic.P256().Params().N) >= 0 {
+		return nil, nil, ErrWrapf("invalid signature r")
+	}
+	if s.Sign() == 0 || s.Cmp(halfOrder) > 0 {
+		return nil, nil, ErrWrapf("non-canonical signature s")
+	}
+	return r, s, nil
+}
+
+//校验交易第 i 个输入的脚本，没有区块信息，用于构建交易后的检查
+func VerifyScript(t *Transaction, i int) error {
+	if i < 0 || i >= len(t.Inputs) {
+		return ErrWrapf("Input %d out of range", i)
+	}
+	in := t.Inputs[i]
+	return verifyScript(in.Script, in.Output.Script, &TxContext{Tx: t, Index: i})
+}
+
+//P2SH 输出需要再执行输入中的赎回脚本
+func verifyScript(in, out *Script, ctx *TxContext) error {
+	if _, ok := p2shScriptHash(out); ok {
+		return verifyP2SH(in, out, ctx)
+	}
+	return execScript(ConcatScript(in, out), ctx)
 }
 
-func VerifyScript(txHash string, in, out *Script) error {
-	vm := NewVm(*ConcatScript(in, out))
-	vm.SetEnv(VMEnvHash, []byte(txHash))
+//签名校验使用花费交易的摘要，见 Transaction.SigHash
+func execScript(s *Script, ctx *TxContext) error {
+	hash, err := ctx.Tx.SigHash(ctx.Index)
+	if err != nil {
+		return err
+	}
+	vm := NewVm(*s)
+	vm.SetEnv(VMEnvHash, hash)
+	vm.SetEnv(VMEnvTxContext, ctx)
 	return vm.Exec()
 }
 
-//使用pubKey 校验 msgHash 的签名是否正确
+//使用pubKey 校验 msgHash 的签名是否正确，公钥和签名都必须是规范编码
 func Verify(msgHash, sign, pubKey []byte) bool {
-	pubLen := len(pubKey)
-	if pubLen != PubKeyLen {
-		Log.Info("Found size invalid pub key")
+	pub, err := ParsePublicKey(pubKey)
+	if err != nil {
+		Log.Info("Found invalid pub key: ", err)
 		return false
 	}
-	x := new(big.Int)
-	y := new(big.Int)
-	x.SetBytes(pubKey[:(pubLen / 2)])
-	y.SetBytes(pubKey[(pubLen / 2):])
-
-	r := new(big.Int)
-	s := new(big.Int)
-	sigLen := len(sign)
-	r.SetBytes(sign[:(sigLen / 2)])
-	s.SetBytes(sign[(sigLen / 2):])
-	pub := &ecdsa.PublicKey{
-		Curve: elliptic.P256(),
-		X:     x,
-		Y:     y,
+	r, s, err := ParseSignature(sign)
+	if err != nil {
+		Log.Info("Found invalid signature: ", err)
+		return false
 	}
 	return ecdsa.Verify(pub, msgHash, r, s)
 }
 
+//解析 Base58Check 或 bech32 地址，返回公钥 hash
 func AddressToRipemd160PubKey(add string) ([]byte, error) {
+	if n, ok := netByBech32Address(add); ok {
+		return bech32ToRipemd160PubKey(add, n)
+	}
+	version, result, err := decodeBase58Address(add)
+	if err != nil {
+		return nil, err
+	}
+	active := ActiveNet()
+	if version == active.ScriptAddressVersion {
+		return nil, ErrWrapf("address %s is a script hash address", add)
+	}
+	if version != active.AddressVersion {
+		return nil, addressVersionError(add, version)
+	}
+	return result, nil
+}
+
+//解析 Base58Check 编码的 P2PKH 或 P2SH 地址，返回版本字节和 hash
+func decodeBase58Address(add string) (byte, []byte, error) {
 	bs, err := Base58Decode(add)
 	if err != nil {
-		return nil, ErrWrap("address convert failed", err)
+		return 0, nil, ErrWrap("address convert failed", err)
 	}
 	l := len(bs)
 	//
 	if l != LenVersion+LenRipemd160+LenCheckSum {
-		return nil, ErrWrapf("invalid address,size %d", l)
-	}
-	if bs[0] != Version {
-		return nil, ErrWrapf("invalid version,%d", bs[0])
+		return 0, nil, ErrWrapf("invalid address,size %d", l)
 	}
 	result := bs[LenVersion : LenVersion+LenRipemd160]
 	doubleSha := Sha256(Sha256(bs[:LenVersion+LenRipemd160]))
 	if !bytes.Equal(bs[LenVersion+LenRipemd160:], doubleSha[:LenCheckSum]) {
-		return nil, ErrWrapf("invalid address,checksum failed")
+		return 0, nil, ErrWrapf("invalid address,checksum failed")
 	}
-	return result, nil
+	return bs[0], result, nil
+}
+
+//校验和正确时才能确定是其他网络的地址
+func addressVersionError(add string, version byte) error {
+	n, ok := netByAddressVersion(version)
+	if !ok {
+		n, ok = netByScriptAddressVersion(version)
+	}
+	if ok {
+		return ErrWrapf("address %s is for network %s, active network is %s", add, n.Name, ActiveNet().Name)
+	}
+	return ErrWrapf("invalid version,%d", version)
+}
+
+func bech32ToRipemd160PubKey(add string, n *NetParams) ([]byte, error) {
+	version, program, err := DecodeBech32Address(n.Bech32HRP, add)
+	if err != nil {
+		return nil, ErrWrap("invalid address "+add, err)
+	}
+	if active := ActiveNet(); n != active {
+		return nil, ErrWrapf("address %s is for network %s, active network is %s", add, n.Name, active.Name)
+	}
+	if version != Bech32AddressVersion || len(program) != LenRipemd160 {
+		return nil, ErrWrapf("unsupported address version %d with size %d", version, len(program))
+	}
+	return program, nil
+}
+
+//bech32 地址校验失败时可能出错的字符下标，用于提示输入错误
+func AddressErrorPositions(add string) []int {
+	if _, ok := netByBech32Address(add); !ok {
+		return nil
+	}
+	if _, _, _, err := Bech32Decode(add); err != nil {
+		if e, ok := err.(*Bech32Error); ok {
+			return e.Positions
+		}
+	}
+	return nil
+}
+
+//同一个公钥 hash 的两种写法都转换为 Base58Check 地址，输出和 utxo 都使用该地址
+//多重签名地址和 P2SH 地址只有一种写法
+func CanonicalAddress(add string) (string, error) {
+	if s, ok, err := multiSigAddressScript(add); ok {
+		if err != nil {
+			return "", err
+		}
+		return multiSigScriptAddress(s), nil
+	}
+	if h, err := AddressToScriptHash(add); err == nil {
+		return ScriptHashToAddress(h), nil
+	}
+	key, err := AddressToRipemd160PubKey(add)
+	if err != nil {
+		return "", err
+	}
+	return Ripemd160ToAddress(key), nil
 }
 
 //从私钥byte中还原账户
@@ -110,8 +369,8 @@ func RestoreWallet(b []byte) *Wallet {
 	priv := new(ecdsa.PrivateKey)
 	priv.PublicKey.Curve = c
 	priv.D = D
-	priv.PublicKey.X, priv.PublicKey.Y = c.ScalarBaseMult(priv.D.Bytes())
-	return &Wallet{priv}
+	priv.PublicKey.X, priv.PublicKey.Y = c.ScalarBaseMult(padBytes(priv.D.Bytes(), coordLen))
+	return &Wallet{priv: priv}
 }
 
 //生成一个全新账户
@@ -125,17 +384,32 @@ func NewWallet() (*Wallet, error) {
 }
 
 func (a *Wallet) Transform(p *TxPool, address string, fee int64, extra string) *TxResponse {
-	req := TxRequest{
+	req := a.Request(address, fee, extra)
+	Log.Info("Wallet submit transform from ", a.Address(), " to ", address, " with fee ", fee, " and extra", extra)
+	return p.Transform(req)
+}
+
+//由本钱包签名的转账请求
+func (a *Wallet) Request(address string, fee int64, extra string) *TxRequest {
+	return &TxRequest{
 		From:  a.Address(),
 		To:    address,
 		Fee:   fee,
 		Extra: extra,
 		w:     a,
 	}
-	Log.Info("Wallet submit transform from ", a.Address(), " to ", address, " with fee ", fee, " and extra", extra)
-	return p.Transform(&req)
+}
+
+//付给多个收款方的请求
+func (a *Wallet) RequestMany(recipients []*Recipient, extra string) *TxRequest {
+	return &TxRequest{
+		From:       a.Address(),
+		Recipients: recipients,
+		Extra:      extra,
+		w:          a,
+	}
 }
 
 func GetTestWallet(i int) *Wallet {
 	return RestoreWallet(GenesisPrivateKeys[i])
-}
\ No newline at end of file
+}
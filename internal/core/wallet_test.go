@@ -2,6 +2,10 @@ package core
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/hex"
+	"math/big"
 	"strconv"
 	"strings"
 	"testing"
@@ -86,3 +90,104 @@ func getTestWallet_(i int) *Wallet {
 func getTestWallet2() *Wallet {
 	return RestoreWallet(GenesisPrivateKeys[1])
 }
+
+//找到 X 坐标有前导0的私钥，旧的编码会得到 63 字节公钥
+func TestWallet_FixedWidth(t *testing.T) {
+	var w *Wallet
+	for i := 1; ; i++ {
+		w = RestoreWallet(big.NewInt(int64(i)).Bytes())
+		if len(w.priv.X.Bytes()) < coordLen {
+			break
+		}
+	}
+	if len(w.PublicKey()) != PubKeyLen || len(w.PrivateKey()) != coordLen {
+		t.Fatal("key size", len(w.PublicKey()), len(w.PrivateKey()))
+	}
+	msg := Sha256([]byte("fixed width"))
+	for i := 0; i < 300; i++ {
+		sign, err := w.Sign(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sign) != SignatureLen || !Verify(msg, sign, w.PublicKey()) {
+			t.Fatal("sign", i)
+		}
+	}
+}
+
+func TestVerify_Canonical(t *testing.T) {
+	w := getTestWallet()
+	msg := Sha256([]byte("canonical"))
+	sign, _ := w.Sign(msg)
+	if !Verify(msg, sign, w.CompressedPublicKey()) {
+		t.Fatal("compressed public key should verify")
+	}
+	//high-S 的签名在数学上有效，但不是规范形式
+	r, s, err := ParseSignature(sign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	highS := new(big.Int).Sub(elliptic.P256().Params().N, s)
+	if !ecdsa.Verify(&w.priv.PublicKey, msg, r, highS) {
+		t.Fatal("high s should be valid ecdsa")
+	}
+	malleated := ConcatBytes(padBytes(r.Bytes(), coordLen), padBytes(highS.Bytes(), coordLen))
+	if Verify(msg, malleated, w.PublicKey()) {
+		t.Fatal("high s should be rejected")
+	}
+	if Verify(msg, ConcatBytes(sign, []byte{0}), w.PublicKey()) || Verify(msg, sign[1:], w.PublicKey()) {
+		t.Fatal("signature size should be checked")
+	}
+	if Verify(msg, sign, w.PublicKey()[1:]) {
+		t.Fatal("public key size should be checked")
+	}
+	bad := CopyBytes(w.PublicKey())
+	bad[PubKeyLen-1] ^= 1
+	if _, err = ParsePublicKey(bad); err == nil {
+		t.Fatal("point not on curve")
+	}
+	pub, err := ParsePublicKey(w.CompressedPublicKey())
+	if err != nil || !bytes.Equal(pubKeyBytes(pub.X, pub.Y), w.PublicKey()) {
+		t.Fatal("decompress", err)
+	}
+}
+
+func TestWallet_WIF(t *testing.T) {
+	//比特币的 WIF 测试向量，编码与曲线无关
+	key, _ := hex.DecodeString("0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d")
+	w, err := ParseWIF("5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ")
+	if err != nil || !bytes.Equal(w.PrivateKey(), key) || w.IsCompressed() {
+		t.Fatal(err)
+	}
+	c, err := ParseWIF("KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617")
+	if err != nil || !bytes.Equal(c.PrivateKey(), key) || !c.IsCompressed() {
+		t.Fatal(err)
+	}
+	if w.WIF() != "5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ" || c.WIF() != "KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617" {
+		t.Fatal("encode wif")
+	}
+	//压缩标记决定地址
+	if len(c.PublicKey()) != CompressedPubKeyLen || c.Address() != pubKeyAddress(w.CompressedPublicKey()) || c.Address() == w.Address() {
+		t.Fatal("compressed address")
+	}
+	sign, _ := c.Sign(Sha256([]byte("msg")))
+	if !Verify(Sha256([]byte("msg")), sign, c.PublicKey()) {
+		t.Fatal("compressed sign")
+	}
+	wif := GetTestWallet(2).WIF()
+	b, _ := Base58Decode(wif)
+	b[5] ^= 1
+	for _, it := range []string{"", "abc", Base58(b), Base58(make([]byte, wifLen))} {
+		if _, err = ParseWIF(it); err == nil {
+			t.Fatal("invalid wif", it)
+		}
+	}
+	SetActiveNet(TestNetParams)
+	defer SetActiveNet(MainNetParams)
+	if _, err = ParseWIF(wif); err == nil || !strings.Contains(err.Error(), "network main") {
+		t.Fatal(err)
+	}
+	if r, err := ParseWIF(GetTestWallet(2).WIF()); err != nil || r.Address() != GetTestWallet(2).Address() {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,332 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ==================================== Metrics ====================================
+// Prometheus 文本格式(0.0.4)的指标，不依赖第三方库
+// 指标本身可以在任意协程中并发更新，Registry 负责输出
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+//单个指标的输出
+type Collector interface {
+	Type() string
+	Write(w io.Writer, name string) error
+}
+
+type Counter struct {
+	bits uint64
+}
+
+type Gauge struct {
+	bits uint64
+}
+
+//抓取时才计算的 gauge
+type GaugeFunc func() float64
+
+//抓取时才读取的 counter, 用于转发其他对象上的计数
+type CounterFunc func() float64
+
+//带一个标签的 counter
+type CounterVec struct {
+	label string
+	mu    sync.RWMutex
+	m     map[string]*Counter
+}
+
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+type Registry struct {
+	mu    sync.RWMutex
+	items []*item
+	names map[string]bool
+}
+
+type item struct {
+	name string
+	help string
+	c    Collector
+}
+
+// ==================================== func below ====================================
+
+func NewCounter() *Counter {
+	return &Counter{}
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+//counter 只增不减，负数忽略
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	addFloat(&c.bits, v)
+}
+
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+func (c *Counter) Type() string {
+	return "counter"
+}
+
+func (c *Counter) Write(w io.Writer, name string) error {
+	return writeSample(w, name, "", c.Value())
+}
+
+func NewGauge() *Gauge {
+	return &Gauge{}
+}
+
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+func (g *Gauge) Add(v float64) {
+	addFloat(&g.bits, v)
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func (g *Gauge) Type() string {
+	return "gauge"
+}
+
+func (g *Gauge) Write(w io.Writer, name string) error {
+	return writeSample(w, name, "", g.Value())
+}
+
+func (f GaugeFunc) Type() string {
+	return "gauge"
+}
+
+func (f GaugeFunc) Write(w io.Writer, name string) error {
+	return writeSample(w, name, "", f())
+}
+
+func (f CounterFunc) Type() string {
+	return "counter"
+}
+
+func (f CounterFunc) Write(w io.Writer, name string) error {
+	return writeSample(w, name, "", f())
+}
+
+func NewCounterVec(label string) *CounterVec {
+	return &CounterVec{
+		label: label,
+		m:     make(map[string]*Counter),
+	}
+}
+
+func (v *CounterVec) With(value string) *Counter {
+	v.mu.RLock()
+	c, ok := v.m[value]
+	v.mu.RUnlock()
+	if ok {
+		return c
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok = v.m[value]; !ok {
+		c = NewCounter()
+		v.m[value] = c
+	}
+	return c
+}
+
+func (v *CounterVec) Value(value string) float64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if c, ok := v.m[value]; ok {
+		return c.Value()
+	}
+	return 0
+}
+
+func (v *CounterVec) Type() string {
+	return "counter"
+}
+
+//按标签值排序输出，保证每次抓取顺序一致
+func (v *CounterVec) Write(w io.Writer, name string) error {
+	v.mu.RLock()
+	values := make([]string, 0, len(v.m))
+	for it := range v.m {
+		values = append(values, it)
+	}
+	v.mu.RUnlock()
+	sort.Strings(values)
+	for _, it := range values {
+		if err := writeSample(w, name, label(v.label, it), v.With(it).Value()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//buckets 为各个桶的上界，需要递增，+Inf 桶自动添加
+func NewHistogram(buckets []float64) *Histogram {
+	b := make([]float64, 0, len(buckets))
+	for _, it := range buckets {
+		if !math.IsInf(it, 1) {
+			b = append(b, it)
+		}
+	}
+	sort.Float64s(b)
+	return &Histogram{
+		buckets: b,
+		counts:  make([]uint64, len(b)),
+	}
+}
+
+//以 start 开始，每次乘以 factor 的 n 个桶
+func ExponentialBuckets(start, factor float64, n int) []float64 {
+	r := make([]float64, n)
+	for i := range r {
+		r[i] = start
+		start *= factor
+	}
+	return r
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, it := range h.buckets {
+		if v <= it {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) Type() string {
+	return "histogram"
+}
+
+func (h *Histogram) Write(w io.Writer, name string) error {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+	for i, it := range h.buckets {
+		if err := writeSample(w, name+"_bucket", label("le", formatFloat(it)), float64(counts[i])); err != nil {
+			return err
+		}
+	}
+	if err := writeSample(w, name+"_bucket", label("le", "+Inf"), float64(count)); err != nil {
+		return err
+	}
+	if err := writeSample(w, name+"_sum", "", sum); err != nil {
+		return err
+	}
+	return writeSample(w, name+"_count", "", float64(count))
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+//按注册顺序输出；名字重复时 panic，属于编码错误
+func (r *Registry) Register(name, help string, c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.items = append(r.items, &item{name: name, help: help, c: c})
+}
+
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.RLock()
+	items := append([]*item(nil), r.items...)
+	r.mu.RUnlock()
+	bw := bufio.NewWriter(w)
+	for _, it := range items {
+		if _, err := io.WriteString(bw, "# HELP "+it.name+" "+escapeHelp(it.help)+"\n"); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(bw, "# TYPE "+it.name+" "+it.c.Type()+"\n"); err != nil {
+			return err
+		}
+		if err := it.c.Write(bw, it.name); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func addFloat(bits *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(bits)
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(bits, old, n) {
+			return
+		}
+	}
+}
+
+func writeSample(w io.Writer, name, labels string, v float64) error {
+	_, err := io.WriteString(w, name+labels+" "+formatFloat(v)+"\n")
+	return err
+}
+
+func label(name, value string) string {
+	return "{" + name + "=\"" + escapeLabel(value) + "\"}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
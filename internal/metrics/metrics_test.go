@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounter()
+	c.Add(2)
+	c.Add(-1)
+	c.Inc()
+	g := NewGauge()
+	g.Set(1.5)
+	v := NewCounterVec("reason")
+	v.With("b").Inc()
+	v.With(`a"\`).Add(2)
+	h := NewHistogram([]float64{1, 0.1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(3)
+	r.Register("c_total", "A counter.\nsecond line", c)
+	r.Register("g", "A gauge.", g)
+	r.Register("f", "A func.", GaugeFunc(func() float64 { return 7 }))
+	r.Register("v_total", "A vec.", v)
+	r.Register("h_seconds", "A histogram.", h)
+	buf := new(bytes.Buffer)
+	if err := r.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	expect := `# HELP c_total A counter.\nsecond line
+# TYPE c_total counter
+c_total 3
+# HELP g A gauge.
+# TYPE g gauge
+g 1.5
+# HELP f A func.
+# TYPE f gauge
+f 7
+# HELP v_total A vec.
+# TYPE v_total counter
+v_total{reason="a\"\\"} 2
+v_total{reason="b"} 1
+# HELP h_seconds A histogram.
+# TYPE h_seconds histogram
+h_seconds_bucket{le="0.1"} 1
+h_seconds_bucket{le="1"} 2
+h_seconds_bucket{le="+Inf"} 3
+h_seconds_sum 3.55
+h_seconds_count 3
+`
+	if buf.String() != expect {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestRegistry_Duplicate(t *testing.T) {
+	r := NewRegistry()
+	r.Register("a", "", NewGauge())
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate should panic")
+		}
+	}()
+	r.Register("a", "", NewGauge())
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	b := ExponentialBuckets(1, 2, 4)
+	if len(b) != 4 || b[3] != 8 {
+		t.Fatal(b)
+	}
+	if !strings.HasPrefix(formatFloat(0.001), "0.001") {
+		t.Fatal(formatFloat(0.001))
+	}
+}
@@ -0,0 +1,173 @@
+package p2p
+
+import (
+	"encoding/hex"
+	"github.com/woodyDM/simple-block-chain/internal/core"
+	"net"
+	"sync"
+	"time"
+)
+
+//收到对方消息时的回调
+type Handler func(p *Peer, msg []byte)
+
+//节点: 通过 Transport 接受和发起连接，并维护已连接的对端
+type Node struct {
+	transport Transport
+	handler   Handler
+	listener  net.Listener
+	mu        sync.RWMutex
+	peers     map[*Peer]bool
+}
+
+type Peer struct {
+	Conn
+	Inbound     bool
+	ConnectedAt time.Time
+	node        *Node
+}
+
+type PeerInfo struct {
+	Addr        string
+	Inbound     bool
+	Identity    string
+	ConnectedAt int64
+}
+
+// ==================================== func below ====================================
+
+func NewNode(t Transport, h Handler) *Node {
+	return &Node{
+		transport: t,
+		handler:   h,
+		peers:     make(map[*Peer]bool),
+	}
+}
+
+func (n *Node) Listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errWrap("p2p listen", err)
+	}
+	n.listener = l
+	core.Log.Info("P2P listen on ", l.Addr())
+	go n.accept(l)
+	return nil
+}
+
+func (n *Node) Addr() net.Addr {
+	if n.listener == nil {
+		return nil
+	}
+	return n.listener.Addr()
+}
+
+func (n *Node) accept(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			core.Log.Info("P2P listener stop ", err)
+			return
+		}
+		go func() {
+			conn, err := n.transport.Server(c)
+			if err != nil {
+				core.Log.Info("P2P handshake with ", c.RemoteAddr(), " failed ", err)
+				return
+			}
+			n.addPeer(conn, true)
+		}()
+	}
+}
+
+func (n *Node) Connect(addr string) (*Peer, error) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, errWrap("p2p dial", err)
+	}
+	conn, err := n.transport.Client(c)
+	if err != nil {
+		return nil, err
+	}
+	return n.addPeer(conn, false), nil
+}
+
+func (n *Node) addPeer(c Conn, inbound bool) *Peer {
+	p := &Peer{
+		Conn:        c,
+		Inbound:     inbound,
+		ConnectedAt: time.Now(),
+		node:        n,
+	}
+	n.mu.Lock()
+	n.peers[p] = true
+	n.mu.Unlock()
+	core.Log.Info("P2P peer connected ", c.RemoteAddr(), " inbound ", inbound)
+	go p.readLoop()
+	return p
+}
+
+func (p *Peer) readLoop() {
+	defer p.Close()
+	for {
+		msg, err := p.ReadMessage()
+		if err != nil {
+			core.Log.Debug("P2P peer ", p.RemoteAddr(), " read fail ", err)
+			return
+		}
+		if p.node.handler != nil {
+			p.node.handler(p, msg)
+		}
+	}
+}
+
+func (p *Peer) Close() error {
+	p.node.mu.Lock()
+	delete(p.node.peers, p)
+	p.node.mu.Unlock()
+	return p.Conn.Close()
+}
+
+func (p *Peer) Info() *PeerInfo {
+	return &PeerInfo{
+		Addr:        p.RemoteAddr().String(),
+		Inbound:     p.Inbound,
+		Identity:    hex.EncodeToString(p.RemoteIdentity()),
+		ConnectedAt: p.ConnectedAt.Unix(),
+	}
+}
+
+func (n *Node) Peers() []*Peer {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	r := make([]*Peer, 0, len(n.peers))
+	for p := range n.peers {
+		r = append(r, p)
+	}
+	return r
+}
+
+func (n *Node) PeerCount() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return len(n.peers)
+}
+
+//向所有对端发送消息
+func (n *Node) Broadcast(msg []byte) {
+	for _, p := range n.Peers() {
+		if err := p.WriteMessage(msg); err != nil {
+			core.Log.Info("P2P send to ", p.RemoteAddr(), " failed ", err)
+			_ = p.Close()
+		}
+	}
+}
+
+func (n *Node) Close() {
+	if n.listener != nil {
+		_ = n.listener.Close()
+	}
+	for _, p := range n.Peers() {
+		_ = p.Close()
+	}
+}
@@ -0,0 +1,288 @@
+package p2p
+
+import (
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ==================================== Secure ====================================
+//加密传输
+//握手:
+// 1. client -> server: hello = 临时X25519公钥(32) | 身份标记(1) | [身份公钥(32)]
+// 2. server -> client: hello
+// 3. 双方 shared = X25519(临时私钥, 对方临时公钥), 用 HKDF-SHA256(shared, salt = SHA256(clientHello||serverHello))
+//    派生两个方向的 ChaCha20-Poly1305 key
+// 4. client -> server, server -> client: 加密的认证帧, 内容为身份私钥对 SHA256(role||clientHello||serverHello) 的签名,
+//    没有身份时为空
+//握手失败时关闭连接
+//之后每个消息为一帧: 4 byte 长度 + 密文, nonce 为每个方向上递增的计数器
+
+const (
+	lenX25519    = 32
+	hasIdentity  = 0x01
+	noIdentity   = 0x00
+	handshakeKdf = "simple-block-chain p2p v1"
+	roleClient   = "client"
+	roleServer   = "server"
+	//hello 的最大长度，握手完成前不接受更大的帧
+	maxHelloSize = lenX25519 + 1 + ed25519.PublicKeySize
+	//握手需要在这个时间内完成，避免连接后不发送数据的对端一直占用连接
+	DefaultHandshakeTimeout = 10 * time.Second
+)
+
+var (
+	HandshakeErr   = errors.New("Handshake failed ")
+	NotAllowedErr  = errors.New("Peer identity not allowed ")
+	NonceExhausted = errors.New("Nonce exhausted ")
+)
+
+type SecureTransport struct {
+	//本节点身份私钥, 可以为nil
+	Identity ed25519.PrivateKey
+	//不为空时，只接受身份公钥在列表中的节点, key 为公钥hex
+	AllowList map[string]bool
+	//为 0 时使用 DefaultHandshakeTimeout
+	HandshakeTimeout time.Duration
+}
+
+type secureConn struct {
+	net.Conn
+	remoteId ed25519.PublicKey
+	readMu   sync.Mutex
+	writeMu  sync.Mutex
+	rAead    cipher.AEAD
+	wAead    cipher.AEAD
+	rNonce   uint64
+	wNonce   uint64
+}
+
+func NewSecureTransport(identity ed25519.PrivateKey, allow ...ed25519.PublicKey) *SecureTransport {
+	t := &SecureTransport{
+		Identity:  identity,
+		AllowList: make(map[string]bool),
+	}
+	for _, it := range allow {
+		t.Allow(it)
+	}
+	return t
+}
+
+func (t *SecureTransport) Allow(pub ed25519.PublicKey) {
+	if t.AllowList == nil {
+		t.AllowList = make(map[string]bool)
+	}
+	t.AllowList[hex.EncodeToString(pub)] = true
+}
+
+func (t *SecureTransport) Client(c net.Conn) (Conn, error) {
+	return t.handshake(c, true)
+}
+
+func (t *SecureTransport) Server(c net.Conn) (Conn, error) {
+	return t.handshake(c, false)
+}
+
+func (t *SecureTransport) handshake(c net.Conn, client bool) (Conn, error) {
+	timeout := t.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	if err := c.SetDeadline(time.Now().Add(timeout)); err != nil {
+		_ = c.Close()
+		return nil, errWrap("set handshake deadline", err)
+	}
+	sc, err := t.handshake0(c, client)
+	if err == nil {
+		err = c.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return sc, nil
+}
+
+func (t *SecureTransport) handshake0(c net.Conn, client bool) (*secureConn, error) {
+	ephPriv := make([]byte, lenX25519)
+	if _, err := io.ReadFull(rand.Reader, ephPriv); err != nil {
+		return nil, errWrap("generate ephemeral key", err)
+	}
+	ephPub, err := curve25519.X25519(ephPriv, curve25519.Basepoint)
+	if err != nil {
+		return nil, errWrap("generate ephemeral key", err)
+	}
+	hello := t.hello(ephPub)
+	var clientHello, serverHello, remoteHello []byte
+	if client {
+		if err = writeFrame(c, hello); err != nil {
+			return nil, errWrap("send hello", err)
+		}
+		if serverHello, err = readFrameLimit(c, maxHelloSize); err != nil {
+			return nil, errWrap("read hello", err)
+		}
+		clientHello, remoteHello = hello, serverHello
+	} else {
+		if clientHello, err = readFrameLimit(c, maxHelloSize); err != nil {
+			return nil, errWrap("read hello", err)
+		}
+		serverHello, remoteHello = hello, clientHello
+	}
+	remoteEph, remoteId, err := parseHello(remoteHello)
+	if err != nil {
+		return nil, err
+	}
+	if !client {
+		if err = writeFrame(c, hello); err != nil {
+			return nil, errWrap("send hello", err)
+		}
+	}
+	shared, err := curve25519.X25519(ephPriv, remoteEph)
+	if err != nil {
+		return nil, errWrap("key exchange", err)
+	}
+	transcript := append(append([]byte{}, clientHello...), serverHello...)
+	salt := sha256.Sum256(transcript)
+	keys := make([]byte, 2*chacha20poly1305.KeySize)
+	if _, err = io.ReadFull(hkdf.New(sha256.New, shared, salt[:], []byte(handshakeKdf)), keys); err != nil {
+		return nil, errWrap("derive key", err)
+	}
+	c2s, _ := chacha20poly1305.New(keys[:chacha20poly1305.KeySize])
+	s2c, _ := chacha20poly1305.New(keys[chacha20poly1305.KeySize:])
+	sc := &secureConn{Conn: c, remoteId: remoteId}
+	localRole, remoteRole := roleServer, roleClient
+	if client {
+		sc.wAead, sc.rAead = c2s, s2c
+		localRole, remoteRole = roleClient, roleServer
+	} else {
+		sc.wAead, sc.rAead = s2c, c2s
+	}
+	if client {
+		if err = t.sendAuth(sc, localRole, transcript); err != nil {
+			return nil, err
+		}
+		if err = t.checkAuth(sc, remoteRole, transcript); err != nil {
+			return nil, err
+		}
+	} else {
+		if err = t.checkAuth(sc, remoteRole, transcript); err != nil {
+			return nil, err
+		}
+		if err = t.sendAuth(sc, localRole, transcript); err != nil {
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+func (t *SecureTransport) hello(ephPub []byte) []byte {
+	if t.Identity == nil {
+		return append(append([]byte{}, ephPub...), noIdentity)
+	}
+	pub := t.Identity.Public().(ed25519.PublicKey)
+	return append(append(append([]byte{}, ephPub...), hasIdentity), pub...)
+}
+
+func parseHello(b []byte) ([]byte, ed25519.PublicKey, error) {
+	if len(b) == lenX25519+1 && b[lenX25519] == noIdentity {
+		return b[:lenX25519], nil, nil
+	}
+	if len(b) == lenX25519+1+ed25519.PublicKeySize && b[lenX25519] == hasIdentity {
+		return b[:lenX25519], ed25519.PublicKey(b[lenX25519+1:]), nil
+	}
+	return nil, nil, HandshakeErr
+}
+
+func authMessage(role string, transcript []byte) []byte {
+	h := sha256.Sum256(append([]byte(role), transcript...))
+	return h[:]
+}
+
+func (t *SecureTransport) sendAuth(sc *secureConn, role string, transcript []byte) error {
+	sig := make([]byte, 0)
+	if t.Identity != nil {
+		sig = ed25519.Sign(t.Identity, authMessage(role, transcript))
+	}
+	if err := sc.WriteMessage(sig); err != nil {
+		return errWrap("send auth", err)
+	}
+	return nil
+}
+
+func (t *SecureTransport) checkAuth(sc *secureConn, role string, transcript []byte) error {
+	sig, err := sc.ReadMessage()
+	if err != nil {
+		return errWrap("read auth", err)
+	}
+	if sc.remoteId == nil {
+		if len(sig) != 0 {
+			return HandshakeErr
+		}
+	} else if !ed25519.Verify(sc.remoteId, authMessage(role, transcript), sig) {
+		return HandshakeErr
+	}
+	if len(t.AllowList) == 0 {
+		return nil
+	}
+	if sc.remoteId == nil || !t.AllowList[hex.EncodeToString(sc.remoteId)] {
+		return NotAllowedErr
+	}
+	return nil
+}
+
+func nonce(n uint64) []byte {
+	b := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(b[chacha20poly1305.NonceSize-8:], n)
+	return b
+}
+
+func (c *secureConn) ReadMessage() ([]byte, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	frame, err := readFrame(c.Conn)
+	if err != nil {
+		return nil, err
+	}
+	if c.rNonce == ^uint64(0) {
+		return nil, NonceExhausted
+	}
+	msg, err := c.rAead.Open(nil, nonce(c.rNonce), frame, nil)
+	if err != nil {
+		_ = c.Conn.Close()
+		return nil, errWrap("decrypt message", err)
+	}
+	c.rNonce++
+	return msg, nil
+}
+
+func (c *secureConn) WriteMessage(msg []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if len(msg)+c.wAead.Overhead() > MaxFrameSize {
+		return FrameTooLargeErr
+	}
+	if c.wNonce == ^uint64(0) {
+		return NonceExhausted
+	}
+	frame := c.wAead.Seal(nil, nonce(c.wNonce), msg, nil)
+	c.wNonce++
+	return writeFrame(c.Conn, frame)
+}
+
+func (c *secureConn) RemoteIdentity() ed25519.PublicKey {
+	if c.remoteId == nil {
+		return nil
+	}
+	return append(ed25519.PublicKey{}, c.remoteId...)
+}
@@ -0,0 +1,105 @@
+package p2p
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+const (
+	MaxFrameSize = 16 << 20 //单个消息最大 16M
+	lenFrameSize = 4
+)
+
+var (
+	FrameTooLargeErr = errors.New("Frame too large ")
+)
+
+//Transport 在已建立的 net.Conn 上完成握手，返回按消息收发的 Conn
+//Client 由发起连接的一方调用, Server 由接受连接的一方调用
+type Transport interface {
+	Client(c net.Conn) (Conn, error)
+	Server(c net.Conn) (Conn, error)
+}
+
+type Conn interface {
+	ReadMessage() ([]byte, error)
+	WriteMessage(msg []byte) error
+	//对方的身份公钥，对方没有身份时为nil
+	RemoteIdentity() ed25519.PublicKey
+	RemoteAddr() net.Addr
+	Close() error
+}
+
+// ==================================== Plain ====================================
+//明文传输，只做消息分帧，用于测试或可信网络
+type PlainTransport struct{}
+
+type plainConn struct {
+	net.Conn
+}
+
+func NewPlainTransport() Transport {
+	return &PlainTransport{}
+}
+
+func (t *PlainTransport) Client(c net.Conn) (Conn, error) {
+	return &plainConn{c}, nil
+}
+
+func (t *PlainTransport) Server(c net.Conn) (Conn, error) {
+	return &plainConn{c}, nil
+}
+
+func (c *plainConn) ReadMessage() ([]byte, error) {
+	return readFrame(c.Conn)
+}
+
+func (c *plainConn) WriteMessage(msg []byte) error {
+	return writeFrame(c.Conn, msg)
+}
+
+func (c *plainConn) RemoteIdentity() ed25519.PublicKey {
+	return nil
+}
+
+// ==================================== Frame ====================================
+//4 byte 大端长度 + 内容
+func writeFrame(w io.Writer, b []byte) error {
+	if len(b) > MaxFrameSize {
+		return FrameTooLargeErr
+	}
+	buf := make([]byte, lenFrameSize+len(b))
+	binary.BigEndian.PutUint32(buf, uint32(len(b)))
+	copy(buf[lenFrameSize:], b)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	return readFrameLimit(r, MaxFrameSize)
+}
+
+//超过 max 的帧在读取内容之前就拒绝
+func readFrameLimit(r io.Reader, max int) ([]byte, error) {
+	head := make([]byte, lenFrameSize)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(head)
+	if uint64(size) > uint64(max) {
+		return nil, FrameTooLargeErr
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func errWrap(msg string, err error) error {
+	return fmt.Errorf("%s: %v ", msg, err)
+}
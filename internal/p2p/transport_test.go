@@ -0,0 +1,216 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type handshakeResult struct {
+	conn Conn
+	err  error
+}
+
+func pipeHandshake(client, server Transport) (handshakeResult, handshakeResult) {
+	c1, c2 := net.Pipe()
+	ch := make(chan handshakeResult)
+	go func() {
+		conn, err := server.Server(c2)
+		ch <- handshakeResult{conn, err}
+	}()
+	conn, err := client.Client(c1)
+	return handshakeResult{conn, err}, <-ch
+}
+
+func newIdentity(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub, priv
+}
+
+func testRoundTrip(t *testing.T, a, b Conn) {
+	msg := []byte("你好 block")
+	go func() {
+		_ = a.WriteMessage(msg)
+		_ = a.WriteMessage([]byte{})
+	}()
+	r, err := b.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r, msg) {
+		t.Fatal("message mismatch")
+	}
+	r, err = b.ReadMessage()
+	if err != nil || len(r) != 0 {
+		t.Fatal("empty message", err)
+	}
+}
+
+func TestPlainTransport(t *testing.T) {
+	c, s := pipeHandshake(NewPlainTransport(), NewPlainTransport())
+	if c.err != nil || s.err != nil {
+		t.Fatal("plain handshake")
+	}
+	testRoundTrip(t, c.conn, s.conn)
+	testRoundTrip(t, s.conn, c.conn)
+}
+
+func TestSecureTransport_Anonymous(t *testing.T) {
+	c, s := pipeHandshake(NewSecureTransport(nil), NewSecureTransport(nil))
+	if c.err != nil || s.err != nil {
+		t.Fatal(c.err, s.err)
+	}
+	if c.conn.RemoteIdentity() != nil || s.conn.RemoteIdentity() != nil {
+		t.Fatal("should be anonymous")
+	}
+	testRoundTrip(t, c.conn, s.conn)
+	testRoundTrip(t, s.conn, c.conn)
+}
+
+func TestSecureTransport_AllowList(t *testing.T) {
+	cPub, cPriv := newIdentity(t)
+	sPub, sPriv := newIdentity(t)
+	c, s := pipeHandshake(NewSecureTransport(cPriv, sPub), NewSecureTransport(sPriv, cPub))
+	if c.err != nil || s.err != nil {
+		t.Fatal(c.err, s.err)
+	}
+	if !bytes.Equal(c.conn.RemoteIdentity(), sPub) || !bytes.Equal(s.conn.RemoteIdentity(), cPub) {
+		t.Fatal("identity mismatch")
+	}
+	testRoundTrip(t, c.conn, s.conn)
+}
+
+func TestSecureTransport_NotAllowed(t *testing.T) {
+	_, cPriv := newIdentity(t)
+	_, sPriv := newIdentity(t)
+	otherPub, _ := newIdentity(t)
+	c, s := pipeHandshake(NewSecureTransport(cPriv), NewSecureTransport(sPriv, otherPub))
+	if s.err != NotAllowedErr {
+		t.Fatal("server should reject", s.err)
+	}
+	if c.err == nil {
+		t.Fatal("client handshake should fail when server closed")
+	}
+	//匿名节点也不能通过白名单
+	c, s = pipeHandshake(NewSecureTransport(nil), NewSecureTransport(sPriv, otherPub))
+	if s.err != NotAllowedErr || c.err == nil {
+		t.Fatal("anonymous should be rejected", s.err)
+	}
+}
+
+func TestSecureTransport_PlainPeerClosed(t *testing.T) {
+	c1, c2 := net.Pipe()
+	go func() {
+		_ = writeFrame(c1, []byte("not a hello"))
+	}()
+	_, err := NewSecureTransport(nil).Server(c2)
+	if err != HandshakeErr {
+		t.Fatal("should fail handshake", err)
+	}
+	//握手失败后连接已关闭
+	if _, err = c2.Write([]byte{1}); err == nil {
+		t.Fatal("conn should be closed")
+	}
+}
+
+func TestSecureTransport_HandshakeTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	st := NewSecureTransport(nil)
+	st.HandshakeTimeout = 50 * time.Millisecond
+	start := time.Now()
+	//对端连接后不发送任何数据
+	if _, err := st.Server(c2); err == nil || time.Since(start) > 2*time.Second {
+		t.Fatal("handshake should time out", err)
+	}
+}
+
+func TestSecureTransport_LargeHello(t *testing.T) {
+	c1, c2 := net.Pipe()
+	go func() {
+		_, _ = c1.Write([]byte{0, 1, 0, 0})
+	}()
+	//只读到帧长度就拒绝，不等待 64K 的内容
+	if _, err := NewSecureTransport(nil).Server(c2); err == nil || !strings.Contains(err.Error(), FrameTooLargeErr.Error()) {
+		t.Fatal("large hello should be rejected", err)
+	}
+}
+
+func TestSecureTransport_Tampered(t *testing.T) {
+	c1, c2 := net.Pipe()
+	m1, m2 := net.Pipe()
+	//中间人转发握手，然后篡改第一条消息
+	go func() {
+		for i := 0; i < 2; i++ {
+			f, _ := readFrame(c2)
+			_ = writeFrame(m1, f)
+		}
+		f, _ := readFrame(c2)
+		f[0] ^= 0xff
+		_ = writeFrame(m1, f)
+	}()
+	go func() {
+		for {
+			f, err := readFrame(m1)
+			if err != nil {
+				return
+			}
+			_ = writeFrame(c2, f)
+		}
+	}()
+	ch := make(chan handshakeResult)
+	go func() {
+		conn, err := NewSecureTransport(nil).Server(m2)
+		ch <- handshakeResult{conn, err}
+	}()
+	conn, err := NewSecureTransport(nil).Client(c1)
+	s := <-ch
+	if err != nil || s.err != nil {
+		t.Fatal(err, s.err)
+	}
+	go func() {
+		_ = conn.WriteMessage([]byte("pay 100"))
+	}()
+	if _, err = s.conn.ReadMessage(); err == nil {
+		t.Fatal("tampered message should fail")
+	}
+}
+
+func TestNode_Peers(t *testing.T) {
+	received := make(chan []byte, 1)
+	server := NewNode(NewPlainTransport(), func(p *Peer, msg []byte) {
+		received <- msg
+	})
+	if err := server.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client := NewNode(NewPlainTransport(), nil)
+	defer client.Close()
+	p, err := client.Connect(server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.PeerCount() != 1 || p.Inbound {
+		t.Fatal("client peer")
+	}
+	client.Broadcast([]byte("block"))
+	select {
+	case msg := <-received:
+		if string(msg) != "block" {
+			t.Fatal("msg")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout")
+	}
+	if server.PeerCount() != 1 || !server.Peers()[0].Inbound {
+		t.Fatal("server peer")
+	}
+}